@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/dustin/go-humanize"
+	"github.com/go-faster/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/tdakkota/docker-logql/internal/dockerlog"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+func cacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage container log cache",
+		Example: heredoc.Doc(`
+# List cached container logs.
+docker logql cache ls
+
+# Remove every cached container log.
+docker logql cache clear
+		`),
+	}
+	cmd.AddCommand(cacheListCmd())
+	cmd.AddCommand(cacheClearCmd())
+	return cmd
+}
+
+func cacheListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls",
+		Short: "List cached container logs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, ok, err := openExistingCache()
+			if err != nil {
+				return err
+			}
+
+			var entries []dockerlog.CacheEntry
+			if ok {
+				entries, err = cache.Entries()
+				if err != nil {
+					return errors.Wrap(err, "list entries")
+				}
+			}
+
+			var (
+				w     = tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+				total int64
+			)
+			fmt.Fprintln(w, "CONTAINER ID\tSTREAMS\tSINCE\tUNTIL\tCOMPLETE\tSIZE\tLAST USED")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+					shortID(e.ContainerID),
+					strings.Join(e.Streams, ","),
+					formatCacheTime(e.Since),
+					formatCacheTime(e.Until),
+					e.Complete,
+					humanize.IBytes(uint64(e.Size)),
+					humanize.Time(e.LastUsed),
+				)
+				total += e.Size
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "\nTotal size: %s\n", humanize.IBytes(uint64(total)))
+			return err
+		},
+	}
+}
+
+func cacheClearCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear",
+		Short: "Remove every cached container log",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache, ok, err := openExistingCache()
+			if err != nil {
+				return err
+			}
+
+			var total int64
+			if ok {
+				entries, err := cache.Entries()
+				if err != nil {
+					return errors.Wrap(err, "list entries")
+				}
+				for _, e := range entries {
+					total += e.Size
+				}
+
+				if err := cache.Clear(); err != nil {
+					return errors.Wrap(err, "clear")
+				}
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "Total reclaimed space: %s\n", humanize.IBytes(uint64(total)))
+			return err
+		},
+	}
+}
+
+// shortID returns truncated container ID, like Docker CLI does.
+func shortID(id string) string {
+	const shortLen = 12
+	if len(id) > shortLen {
+		return id[:shortLen]
+	}
+	return id
+}
+
+func formatCacheTime(ts otelstorage.Timestamp) string {
+	return ts.AsTime().Local().Format(time.DateTime)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+// chartOptions defines chart time axis and size.
+type chartOptions struct {
+	start, end time.Time
+	step       time.Duration
+	// width is a terminal width.
+	width int
+}
+
+// lineChartHeight is a line chart height in rows.
+const lineChartHeight = 10
+
+func (opts chartOptions) steps() int {
+	if opts.step <= 0 || opts.end.Before(opts.start) {
+		return 1
+	}
+	return int(opts.end.Sub(opts.start)/opts.step) + 1
+}
+
+func (opts chartOptions) timeFormat() string {
+	if opts.end.Sub(opts.start) < 24*time.Hour {
+		return time.TimeOnly
+	}
+	return "01-02 15:04"
+}
+
+// chartSeries is a series aligned to the time axis.
+type chartSeries struct {
+	name   string
+	color  string
+	values []float64 // NaN, if there is no value.
+}
+
+// alignSeries aligns matrix series to given number of columns.
+//
+// If there are more steps than columns, column value is a maximum of its steps
+// to make spikes visible.
+func alignSeries(matrix lokiapi.Matrix, opts chartOptions, columns int) []chartSeries {
+	var (
+		steps  = opts.steps()
+		result = make([]chartSeries, 0, len(matrix))
+		colors colorPicker
+	)
+	columns = max(min(columns, steps), 1)
+
+	for _, s := range matrix {
+		values := make([]float64, columns)
+		for i := range values {
+			values[i] = math.NaN()
+		}
+
+		for _, p := range s.Values {
+			step, v, ok := opts.point(p)
+			if !ok {
+				continue
+			}
+
+			col := step * columns / steps
+			if cur := values[col]; math.IsNaN(cur) || v > cur {
+				values[col] = v
+			}
+		}
+
+		result = append(result, chartSeries{
+			name:   formatLabels(s.Metric.Value),
+			values: values,
+		})
+	}
+	slices.SortFunc(result, func(a, b chartSeries) int {
+		return strings.Compare(a.name, b.name)
+	})
+	for i := range result {
+		result[i].color = colors.Pick(result[i].name)
+	}
+	return result
+}
+
+// point returns time axis step and value of given point.
+//
+// Returns false, if value is invalid or point is out of the axis.
+func (opts chartOptions) point(p lokiapi.FPoint) (step int, v float64, _ bool) {
+	v, err := strconv.ParseFloat(p.V, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if opts.step > 0 {
+		step = int(math.Round(float64(prometheusTime(p.T).Sub(opts.start)) / float64(opts.step)))
+	}
+	if step < 0 || step >= opts.steps() {
+		return 0, 0, false
+	}
+	return step, v, true
+}
+
+// matrixRange returns range of matrix values on the time axis.
+func matrixRange(matrix lokiapi.Matrix, opts chartOptions) (low, high float64) {
+	var values []float64
+	for _, s := range matrix {
+		for _, p := range s.Values {
+			if _, v, ok := opts.point(p); ok {
+				values = append(values, v)
+			}
+		}
+	}
+	return valuesRange([]chartSeries{{values: values}})
+}
+
+// valuesRange returns range of finite values of given series.
+func valuesRange(series []chartSeries) (low, high float64) {
+	low, high = math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, v := range s.values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			low = min(low, v)
+			high = max(high, v)
+		}
+	}
+	if low > high {
+		return 0, 0
+	}
+	return low, high
+}
+
+func formatChartValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// appendTimeAxis appends time axis of given width.
+func appendTimeAxis(buf []byte, opts chartOptions, indent, width int) []byte {
+	var (
+		format = opts.timeFormat()
+		start  = opts.start.Format(format)
+		end    = opts.end.Format(format)
+	)
+	buf = appendSpaces(buf, indent)
+	buf = append(buf, start...)
+	if gap := width - len(start) - len(end); gap > 0 {
+		buf = appendSpaces(buf, gap)
+		buf = append(buf, end...)
+	}
+	return append(buf, '\n')
+}
+
+func appendSpaces(buf []byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		buf = append(buf, ' ')
+	}
+	return buf
+}
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// renderSparklines writes a sparkline per series.
+func renderSparklines(stdout io.Writer, opts renderOptions, r lokiapi.MatrixResult) error {
+	var nameWidth int
+	for _, s := range r.Result {
+		nameWidth = max(nameWidth, len(formatLabels(s.Metric.Value)))
+	}
+	const statsWidth = 32
+	columns := max(opts.chart.width-nameWidth-statsWidth, 10)
+
+	var (
+		series = alignSeries(r.Result, opts.chart, columns)
+		buf    []byte
+	)
+	for _, s := range series {
+		buf = appendColored(buf[:0], opts, s.color, s.name)
+		buf = appendSpaces(buf, nameWidth-len(s.name)+1)
+
+		low, high := valuesRange([]chartSeries{s})
+		if opts.color {
+			buf = append(buf, s.color...)
+		}
+		for _, v := range s.values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				buf = append(buf, ' ')
+				continue
+			}
+			tick := 0
+			if high > low {
+				tick = int((v - low) / (high - low) * float64(len(sparkTicks)-1))
+			}
+			buf = append(buf, string(sparkTicks[tick])...)
+		}
+		if opts.color {
+			buf = append(buf, resetColor...)
+		}
+		buf = append(buf, " min="...)
+		buf = append(buf, formatChartValue(low)...)
+		buf = append(buf, " max="...)
+		buf = append(buf, formatChartValue(high)...)
+		buf = append(buf, '\n')
+
+		if _, err := stdout.Write(buf); err != nil {
+			return err
+		}
+	}
+	if len(series) > 0 {
+		buf = appendTimeAxis(buf[:0], opts.chart, nameWidth+1, len(series[0].values))
+		if _, err := stdout.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type chartCell struct {
+	ch    rune
+	color string
+}
+
+// renderLineChart writes all series on a single line chart.
+func renderLineChart(stdout io.Writer, opts renderOptions, r lokiapi.MatrixResult) error {
+	const height = lineChartHeight
+
+	low, high := matrixRange(r.Result, opts.chart)
+	var (
+		lowLabel   = formatChartValue(low)
+		highLabel  = formatChartValue(high)
+		labelWidth = max(len(lowLabel), len(highLabel))
+		columns    = max(opts.chart.width-labelWidth-2, 10)
+		series     = alignSeries(r.Result, opts.chart, columns)
+	)
+	if len(series) > 0 {
+		columns = len(series[0].values)
+	}
+
+	grid := make([][]chartCell, height)
+	for i := range grid {
+		grid[i] = make([]chartCell, columns)
+	}
+	toRow := func(v float64) int {
+		if high <= low {
+			return height - 1
+		}
+		return height - 1 - int(math.Round((v-low)/(high-low)*float64(height-1)))
+	}
+	for _, s := range series {
+		prevRow := -1
+		for x, v := range s.values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				prevRow = -1
+				continue
+			}
+			row := toRow(v)
+			if prevRow >= 0 {
+				// Connect with previous point.
+				for y := min(row, prevRow) + 1; y < max(row, prevRow); y++ {
+					grid[y][x] = chartCell{ch: '│', color: s.color}
+				}
+			}
+			grid[row][x] = chartCell{ch: '•', color: s.color}
+			prevRow = row
+		}
+	}
+
+	var buf []byte
+	for y, line := range grid {
+		buf = buf[:0]
+		var label string
+		switch y {
+		case 0:
+			label = highLabel
+		case height - 1:
+			label = lowLabel
+		}
+		buf = appendSpaces(buf, labelWidth-len(label))
+		buf = append(buf, label...)
+		if label != "" {
+			buf = append(buf, " ┤"...)
+		} else {
+			buf = append(buf, " │"...)
+		}
+		for _, cell := range line {
+			if cell.ch == 0 {
+				buf = append(buf, ' ')
+				continue
+			}
+			buf = appendColored(buf, opts, cell.color, string(cell.ch))
+		}
+		buf = append(buf, '\n')
+		if _, err := stdout.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	buf = appendSpaces(buf[:0], labelWidth+1)
+	buf = append(buf, "└"...)
+	buf = append(buf, strings.Repeat("─", columns)...)
+	buf = append(buf, '\n')
+	buf = appendTimeAxis(buf, opts.chart, labelWidth+2, columns)
+
+	// Legend.
+	for _, s := range series {
+		buf = append(buf, "  "...)
+		buf = appendColored(buf, opts, s.color, "•")
+		buf = append(buf, ' ')
+		buf = append(buf, s.name...)
+		buf = append(buf, '\n')
+	}
+	_, err := stdout.Write(buf)
+	return err
+}
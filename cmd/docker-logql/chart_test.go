@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+func TestAlignSeries(t *testing.T) {
+	ts := time.Date(2023, 11, 14, 22, 13, 0, 0, time.UTC)
+	opts := chartOptions{
+		start: ts,
+		end:   ts.Add(4 * time.Minute),
+		step:  time.Minute,
+	}
+	point := func(step int, v string) lokiapi.FPoint {
+		return lokiapi.FPoint{T: float64(ts.Add(time.Duration(step) * time.Minute).Unix()), V: v}
+	}
+	series := func(labels lokiapi.LabelSet, points ...lokiapi.FPoint) lokiapi.Series {
+		return lokiapi.Series{Metric: lokiapi.NewOptLabelSet(labels), Values: points}
+	}
+
+	tests := []struct {
+		name      string
+		matrix    lokiapi.Matrix
+		columns   int
+		want      []string
+		low, high float64
+	}{
+		{"Empty", nil, 5, []string{}, 0, 0},
+		{
+			"SinglePoint",
+			lokiapi.Matrix{series(nil, point(2, "3"))},
+			5,
+			[]string{"{}: [NaN NaN 3 NaN NaN]"},
+			3, 3,
+		},
+		{
+			"NaNInf",
+			lokiapi.Matrix{series(nil, point(0, "NaN"), point(1, "+Inf"), point(2, "1"), point(3, "-Inf"), point(4, "foo"))},
+			5,
+			[]string{"{}: [NaN +Inf 1 -Inf NaN]"},
+			1, 1,
+		},
+		{
+			"OnlyNaN",
+			lokiapi.Matrix{series(nil, point(0, "NaN"))},
+			5,
+			[]string{"{}: [NaN NaN NaN NaN NaN]"},
+			0, 0,
+		},
+		{
+			"OutOfAxis",
+			lokiapi.Matrix{series(nil, point(-1, "10"), point(0, "1"), point(5, "10"))},
+			5,
+			[]string{"{}: [1 NaN NaN NaN NaN]"},
+			1, 1,
+		},
+		{
+			"Columns",
+			lokiapi.Matrix{series(nil, point(0, "1"), point(1, "5"), point(2, "2"), point(3, "-3"), point(4, "-4"))},
+			2,
+			[]string{"{}: [5 -3]"},
+			-4, 5,
+		},
+		{
+			"Labels",
+			lokiapi.Matrix{
+				series(lokiapi.LabelSet{"container": "db"}, point(0, "2")),
+				series(lokiapi.LabelSet{"container": "api", "value": "label"}, point(0, "1")),
+			},
+			1,
+			[]string{
+				`{container="api", value="label"}: [1]`,
+				`{container="db"}: [2]`,
+			},
+			1, 2,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, s := range alignSeries(tt.matrix, opts, tt.columns) {
+				got = append(got, fmt.Sprintf("%s: %v", s.name, s.values))
+			}
+			require.Equal(t, tt.want, got)
+
+			low, high := matrixRange(tt.matrix, opts)
+			require.Equal(t, tt.low, low)
+			require.Equal(t, tt.high, high)
+		})
+	}
+}
+
+func TestRenderChart(t *testing.T) {
+	ts := time.Date(2023, 11, 14, 22, 13, 0, 0, time.UTC)
+	opts := renderOptions{
+		chart: chartOptions{
+			start: ts,
+			end:   ts.Add(2 * time.Minute),
+			step:  time.Minute,
+			width: 40,
+		},
+	}
+	single := lokiapi.MatrixResult{
+		Result: lokiapi.Matrix{
+			{
+				Metric: lokiapi.NewOptLabelSet(lokiapi.LabelSet{"container": "api"}),
+				Values: []lokiapi.FPoint{{T: float64(ts.Add(time.Minute).Unix()), V: "2"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		render func(*strings.Builder, renderOptions, lokiapi.MatrixResult) error
+		result lokiapi.MatrixResult
+		want   string
+	}{
+		{
+			"SparklineEmpty",
+			func(sb *strings.Builder, opts renderOptions, r lokiapi.MatrixResult) error {
+				return renderSparklines(sb, opts, r)
+			},
+			lokiapi.MatrixResult{},
+			"",
+		},
+		{
+			"SparklineSinglePoint",
+			func(sb *strings.Builder, opts renderOptions, r lokiapi.MatrixResult) error {
+				return renderSparklines(sb, opts, r)
+			},
+			single,
+			`{container="api"}  ▁  min=2 max=2` + "\n" +
+				"                  22:13:00\n",
+		},
+		{
+			"LineChartSinglePoint",
+			func(sb *strings.Builder, opts renderOptions, r lokiapi.MatrixResult) error {
+				return renderLineChart(sb, opts, r)
+			},
+			single,
+			"2 ┤   \n" +
+				"  │   \n" +
+				"  │   \n" +
+				"  │   \n" +
+				"  │   \n" +
+				"  │   \n" +
+				"  │   \n" +
+				"  │   \n" +
+				"  │   \n" +
+				"2 ┤ • \n" +
+				"  └───\n" +
+				"   22:13:00\n" +
+				`  • {container="api"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			require.NoError(t, tt.render(&sb, opts, tt.result))
+			require.Equal(t, tt.want, sb.String())
+		})
+	}
+}
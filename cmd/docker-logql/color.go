@@ -31,3 +31,23 @@ var (
 func ansi(code string) string {
 	return fmt.Sprintf("\033[%sm", code)
 }
+
+// colorPicker assigns a color to each distinct key.
+type colorPicker struct {
+	colors map[string]string
+}
+
+// Pick returns color for given key.
+func (p *colorPicker) Pick(key string) string {
+	if p.colors == nil {
+		p.colors = map[string]string{}
+	}
+	color, ok := p.colors[key]
+	if !ok {
+		// Skip the first color (grey), it is hard to read.
+		colorName := names[1+len(p.colors)%(len(names)-1)]
+		color = colors[colorName]
+		p.colors[key] = color
+	}
+	return color
+}
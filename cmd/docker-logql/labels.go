@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/docker/cli/cli/command"
+	"github.com/go-faster/errors"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/dockerlog"
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+)
+
+func labelsCmd(dcli command.Cli) *cobra.Command {
+	var timeRange timeRangeOptions
+	cmd := &cobra.Command{
+		Use:  "labels [name]",
+		Args: cobra.MaximumNArgs(1),
+		Example: heredoc.Doc(`
+# Get all label names.
+docker logql labels
+
+# Get all values of label "container_image".
+docker logql labels container_image
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			start, end, err := timeRange.Parse(time.Now())
+			if err != nil {
+				return errors.Wrap(err, "parse time range")
+			}
+
+			q, err := dockerlog.NewQuerier(dcli.Client(), dockerlog.Options{})
+			if err != nil {
+				return errors.Wrap(err, "create querier")
+			}
+			opts := logstorage.LabelsOptions{
+				Start: pcommon.NewTimestampFromTime(start),
+				End:   pcommon.NewTimestampFromTime(end),
+			}
+
+			var result []string
+			if len(args) == 0 {
+				result, err = q.LabelNames(ctx, opts)
+				if err != nil {
+					return errors.Wrap(err, "get label names")
+				}
+			} else {
+				iter, err := q.LabelValues(ctx, args[0], opts)
+				if err != nil {
+					return errors.Wrap(err, "get label values")
+				}
+				defer func() {
+					_ = iter.Close()
+				}()
+
+				if err := iterators.ForEach(iter, func(l logstorage.Label) error {
+					result = append(result, l.Value)
+					return nil
+				}); err != nil {
+					return errors.Wrap(err, "iterate label values")
+				}
+			}
+
+			return printLines(cmd.OutOrStdout(), result)
+		},
+	}
+	timeRange.Register(cmd.Flags())
+	return cmd
+}
+
+func seriesCmd(dcli command.Cli) *cobra.Command {
+	var timeRange timeRangeOptions
+	cmd := &cobra.Command{
+		Use:  "series <selector>...",
+		Args: cobra.MinimumNArgs(1),
+		Example: heredoc.Doc(`
+# Get all series.
+docker logql series '{}'
+
+# Get series of Compose project "app".
+docker logql series '{com_docker_compose_project="app"}'
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			start, end, err := timeRange.Parse(time.Now())
+			if err != nil {
+				return errors.Wrap(err, "parse time range")
+			}
+
+			selectors := make([]logql.Selector, len(args))
+			for i, arg := range args {
+				selectors[i], err = logql.ParseSelector(arg, logql.ParseOptions{})
+				if err != nil {
+					return errors.Wrapf(err, "parse selector %q", arg)
+				}
+			}
+
+			q, err := dockerlog.NewQuerier(dcli.Client(), dockerlog.Options{})
+			if err != nil {
+				return errors.Wrap(err, "create querier")
+			}
+
+			series, err := q.Series(ctx, logstorage.SeriesOptions{
+				Start:     pcommon.NewTimestampFromTime(start),
+				End:       pcommon.NewTimestampFromTime(end),
+				Selectors: selectors,
+			})
+			if err != nil {
+				return errors.Wrap(err, "get series")
+			}
+
+			result := make([]string, len(series))
+			for i, set := range series {
+				result[i] = formatLabels(set)
+			}
+			slices.Sort(result)
+
+			return printLines(cmd.OutOrStdout(), result)
+		},
+	}
+	timeRange.Register(cmd.Flags())
+	return cmd
+}
+
+func printLines(stdout io.Writer, lines []string) error {
+	var buf []byte
+	for _, line := range lines {
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	_, err := stdout.Write(buf)
+	return err
+}
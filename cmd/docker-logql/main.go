@@ -15,6 +15,11 @@ func rootCmd(dcli command.Cli) *cobra.Command {
 		Use: "logql",
 	}
 	root.AddCommand(queryCmd(dcli))
+	root.AddCommand(tailCmd(dcli))
+	root.AddCommand(labelsCmd(dcli))
+	root.AddCommand(seriesCmd(dcli))
+	root.AddCommand(serveCmd(dcli))
+	root.AddCommand(cacheCmd())
 	return root
 }
 
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/jx"
+	"github.com/go-logfmt/logfmt"
+
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+// renderJSON writes Loki-compatible query response.
+func renderJSON(stdout io.Writer, data lokiapi.QueryResponseData) error {
+	resp := lokiapi.QueryResponse{
+		Status: "success",
+		Data:   data,
+	}
+
+	e := jx.GetEncoder()
+	defer jx.PutEncoder(e)
+
+	resp.Encode(e)
+	e.RawStr("\n")
+	_, err := e.WriteTo(stdout)
+	return err
+}
+
+// renderSamples writes metric query result sample by sample.
+func renderSamples(stdout io.Writer, opts renderOptions, data lokiapi.QueryResponseData) error {
+	p := structuredPrinter{
+		out:    stdout,
+		format: opts.output,
+	}
+
+	switch t := data.Type; t {
+	case lokiapi.ScalarResultQueryResponseData:
+		point := data.ScalarResult.Result
+		return p.Print(prometheusTime(point.T), nil, "value", point.V)
+	case lokiapi.VectorResultQueryResponseData:
+		samples := slices.Clone(data.VectorResult.Result)
+		slices.SortFunc(samples, func(a, b lokiapi.Sample) int {
+			return strings.Compare(formatLabels(a.Metric.Value), formatLabels(b.Metric.Value))
+		})
+		for _, s := range samples {
+			if err := p.Print(prometheusTime(s.Value.T), s.Metric.Value, "value", s.Value.V); err != nil {
+				return err
+			}
+		}
+		return nil
+	case lokiapi.MatrixResultQueryResponseData:
+		series := slices.Clone(data.MatrixResult.Result)
+		slices.SortFunc(series, func(a, b lokiapi.Series) int {
+			return strings.Compare(formatLabels(a.Metric.Value), formatLabels(b.Metric.Value))
+		})
+		for _, s := range series {
+			for _, point := range s.Values {
+				if err := p.Print(prometheusTime(point.T), s.Metric.Value, "value", point.V); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported result %q", t)
+	}
+}
+
+// structuredPrinter writes entries and samples in machine-readable format.
+type structuredPrinter struct {
+	out    io.Writer
+	format outputFormat
+
+	buf  bytes.Buffer
+	keys []string
+	e    jx.Encoder
+}
+
+// Print writes a record with given timestamp, labels and value.
+func (p *structuredPrinter) Print(ts time.Time, labels lokiapi.LabelSet, key, value string) error {
+	if p.format == outputRaw {
+		p.buf.Reset()
+		p.buf.WriteString(value)
+		p.buf.WriteByte('\n')
+		_, err := p.out.Write(p.buf.Bytes())
+		return err
+	}
+
+	// Sort labels to get a stable output.
+	p.keys = p.keys[:0]
+	for k := range labels {
+		p.keys = append(p.keys, k)
+	}
+	slices.Sort(p.keys)
+
+	switch p.format {
+	case outputJSONL:
+		e := &p.e
+		e.Reset()
+		e.Obj(func(e *jx.Encoder) {
+			e.Field("labels", func(e *jx.Encoder) {
+				e.Obj(func(e *jx.Encoder) {
+					for _, k := range p.keys {
+						e.Field(k, func(e *jx.Encoder) {
+							e.Str(labels[k])
+						})
+					}
+				})
+			})
+			e.Field("timestamp", func(e *jx.Encoder) {
+				e.Str(ts.UTC().Format(time.RFC3339Nano))
+			})
+			e.Field(key, func(e *jx.Encoder) {
+				e.Str(value)
+			})
+		})
+		e.RawStr("\n")
+		_, err := e.WriteTo(p.out)
+		return err
+	case outputLogfmt:
+		p.buf.Reset()
+		enc := logfmt.NewEncoder(&p.buf)
+		if err := enc.EncodeKeyval("ts", ts.UTC().Format(time.RFC3339Nano)); err != nil {
+			return errors.Wrap(err, "encode timestamp")
+		}
+		for _, k := range p.keys {
+			if err := enc.EncodeKeyval(logfmtLabelKey(labels, k, key), labels[k]); err != nil {
+				return errors.Wrapf(err, "encode label %q", k)
+			}
+		}
+		if err := enc.EncodeKeyval(key, value); err != nil {
+			return errors.Wrapf(err, "encode %s", key)
+		}
+		if err := enc.EndRecord(); err != nil {
+			return err
+		}
+		_, err := p.out.Write(p.buf.Bytes())
+		return err
+	default:
+		return errors.Errorf("unexpected output format %q", p.format)
+	}
+}
+
+// logfmtLabelKey returns logfmt key of given label.
+//
+// Labels colliding with timestamp or value key are prefixed with underscore.
+func logfmtLabelKey(labels lokiapi.LabelSet, label, valueKey string) string {
+	key := label
+	for {
+		switch _, exists := labels[key]; {
+		case key == "ts" || key == valueKey:
+		case key != label && exists:
+		default:
+			return key
+		}
+		key = "_" + key
+	}
+}
+
+// prometheusTime converts Prometheus timestamp to time.Time.
+func prometheusTime(t float64) time.Time {
+	return time.UnixMilli(int64(math.Round(t * 1000)))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+func TestRenderStructured(t *testing.T) {
+	ts := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	streams := lokiapi.NewStreamsResultQueryResponseData(lokiapi.StreamsResult{
+		Result: lokiapi.Streams{
+			{
+				Stream: lokiapi.NewOptLabelSet(lokiapi.LabelSet{
+					"container": "api",
+					"ts":        "label",
+					"_ts":       "other",
+					"line":      "label",
+					"timestamp": "label",
+				}),
+				Values: []lokiapi.LogEntry{
+					{T: uint64(ts.Add(time.Second).UnixNano()), V: "second\n"},
+					{T: uint64(ts.UnixNano()), V: "first line\n"},
+				},
+			},
+		},
+	})
+	matrix := lokiapi.NewMatrixResultQueryResponseData(lokiapi.MatrixResult{
+		Result: lokiapi.Matrix{
+			{
+				Metric: lokiapi.NewOptLabelSet(lokiapi.LabelSet{"value": "label"}),
+				Values: []lokiapi.FPoint{{T: float64(ts.Unix()), V: "1.5"}},
+			},
+		},
+	})
+
+	tests := []struct {
+		name   string
+		output outputFormat
+		data   lokiapi.QueryResponseData
+		want   []string
+	}{
+		{
+			"StreamsJSONL",
+			outputJSONL,
+			streams,
+			[]string{
+				`{"labels":{"_ts":"other","container":"api","line":"label","timestamp":"label","ts":"label"},"timestamp":"2023-11-14T22:13:20Z","line":"first line"}`,
+				`{"labels":{"_ts":"other","container":"api","line":"label","timestamp":"label","ts":"label"},"timestamp":"2023-11-14T22:13:21Z","line":"second"}`,
+			},
+		},
+		{
+			"StreamsLogfmt",
+			outputLogfmt,
+			streams,
+			[]string{
+				`ts=2023-11-14T22:13:20Z _ts=other container=api _line=label timestamp=label __ts=label line="first line"`,
+				`ts=2023-11-14T22:13:21Z _ts=other container=api _line=label timestamp=label __ts=label line=second`,
+			},
+		},
+		{
+			"StreamsRaw",
+			outputRaw,
+			streams,
+			[]string{"first line", "second"},
+		},
+		{
+			"MatrixJSONL",
+			outputJSONL,
+			matrix,
+			[]string{`{"labels":{"value":"label"},"timestamp":"2023-11-14T22:13:20Z","value":"1.5"}`},
+		},
+		{
+			"MatrixLogfmt",
+			outputLogfmt,
+			matrix,
+			[]string{`ts=2023-11-14T22:13:20Z _value=label value=1.5`},
+		},
+		{
+			"Scalar",
+			outputLogfmt,
+			lokiapi.NewScalarResultQueryResponseData(lokiapi.ScalarResult{
+				Result: lokiapi.FPoint{T: float64(ts.Unix()), V: "NaN"},
+			}),
+			[]string{`ts=2023-11-14T22:13:20Z value=NaN`},
+		},
+		{
+			"EmptyVector",
+			outputJSONL,
+			lokiapi.NewVectorResultQueryResponseData(lokiapi.VectorResult{}),
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			require.NoError(t, renderResult(&sb, renderOptions{output: tt.output}, tt.data))
+
+			var lines []string
+			if out := sb.String(); out != "" {
+				lines = strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			}
+			require.Equal(t, tt.want, lines)
+		})
+	}
+}
+
+func TestLogfmtLabelKey(t *testing.T) {
+	tests := []struct {
+		labels lokiapi.LabelSet
+		label  string
+		want   string
+	}{
+		{lokiapi.LabelSet{"container": "api"}, "container", "container"},
+		{lokiapi.LabelSet{"ts": ""}, "ts", "_ts"},
+		{lokiapi.LabelSet{"line": ""}, "line", "_line"},
+		{lokiapi.LabelSet{"ts": "", "_ts": ""}, "_ts", "_ts"},
+		{lokiapi.LabelSet{"ts": "", "_ts": ""}, "ts", "__ts"},
+		{lokiapi.LabelSet{"ts": "", "_ts": "", "__ts": ""}, "ts", "___ts"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, logfmtLabelKey(tt.labels, tt.label, "line"), "%v %q", tt.labels, tt.label)
+	}
+}
@@ -2,16 +2,20 @@ package main
 
 import (
 	"fmt"
-	"math"
-	"strconv"
-	"strings"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
 	"time"
 
+	"github.com/docker/cli/cli/config"
+	"github.com/dustin/go-humanize"
 	"github.com/go-faster/errors"
-	"github.com/prometheus/common/model"
 	"github.com/spf13/pflag"
 
+	"github.com/tdakkota/docker-logql/internal/dockerlog"
 	"github.com/tdakkota/docker-logql/internal/lokiapi"
+	"github.com/tdakkota/docker-logql/internal/lokihandler"
 )
 
 // APIFlag is [pflag.Value] wrapping ogen optional.
@@ -61,95 +65,124 @@ func (f *APIFlag[O, S]) Type() string {
 	return fmt.Sprintf("%T", zero)
 }
 
-// parseTimeRange parses optional parameters and returns time range
-//
-// Default values:
+// timeRangeOptions defines query time range flags.
+type timeRangeOptions struct {
+	start APIFlag[*lokiapi.OptLokiTime, lokiapi.LokiTime]
+	end   APIFlag[*lokiapi.OptLokiTime, lokiapi.LokiTime]
+	since APIFlag[*lokiapi.OptPrometheusDuration, lokiapi.PrometheusDuration]
+}
+
+func (opts *timeRangeOptions) Register(set *pflag.FlagSet) {
+	opts.start = apiFlagFor[lokiapi.OptLokiTime]("`end - since`")
+	opts.end = apiFlagFor[lokiapi.OptLokiTime]("now")
+	opts.since = apiFlagFor[lokiapi.OptPrometheusDuration]("6h")
+	set.Var(&opts.start, "start", "Start of query range")
+	set.Var(&opts.end, "end", "End of query range")
+	set.Var(&opts.since, "since", "A duration used to calculate `start` relative to `end`")
+}
+
+// Parse returns time range defined by flags.
+func (opts *timeRangeOptions) Parse(now time.Time) (start, end time.Time, _ error) {
+	return lokihandler.ParseTimeRange(
+		now,
+		*opts.start.Val,
+		*opts.end.Val,
+		*opts.since.Val,
+	)
+}
+
+// multilineOptions defines multiline grouping flags.
+type multilineOptions struct {
+	enabled  bool
+	start    string
+	maxLines int
+	timeout  time.Duration
+}
+
+func (opts *multilineOptions) Register(set *pflag.FlagSet) {
+	set.BoolVar(&opts.enabled, "multiline", false, "Join continuation lines of multiline entries (e.g. stack traces)")
+	set.StringVar(&opts.start, "multiline-start", "", "Regexp matching the first line of multiline entry, implies --multiline (default: not indented line)")
+	set.IntVar(&opts.maxLines, "multiline-max-lines", 500, "Maximum number of lines in multiline entry")
+	set.DurationVar(&opts.timeout, "multiline-timeout", 3*time.Second, "Maximum time gap between lines of multiline entry")
+}
+
+// Options returns multiline grouping options.
 //
-//   - since = 6 * time.Hour
-//   - end == now
-//   - start = end.Add(-since) if not end.After(now)
-func parseTimeRange(
-	now time.Time,
-	startParam lokiapi.OptLokiTime,
-	endParam lokiapi.OptLokiTime,
-	sinceParam lokiapi.OptPrometheusDuration,
-) (start, end time.Time, err error) {
-	since := 6 * time.Hour
-	if v, ok := sinceParam.Get(); ok {
-		d, err := model.ParseDuration(string(v))
-		if err != nil {
-			return start, end, errors.Wrap(err, "parse since")
-		}
-		since = time.Duration(d)
+// Returns nil, if grouping is disabled.
+func (opts *multilineOptions) Options() (*dockerlog.MultilineOptions, error) {
+	if !opts.enabled && opts.start == "" {
+		return nil, nil
 	}
 
-	endValue := endParam.Or("")
-	end, err = parseTimestamp(endValue, now)
-	if err != nil {
-		return start, end, errors.Wrapf(err, "parse end %q", endValue)
+	r := &dockerlog.MultilineOptions{
+		MaxLines: opts.maxLines,
+		Timeout:  opts.timeout,
 	}
-
-	endOrNow := end
-	if end.After(now) {
-		endOrNow = now
+	if opts.start != "" {
+		re, err := regexp.Compile(opts.start)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse multiline start")
+		}
+		r.Start = re
 	}
+	return r, nil
+}
 
-	startValue := startParam.Or("")
-	start, err = parseTimestamp(startValue, endOrNow.Add(-since))
-	if err != nil {
-		return start, end, errors.Wrapf(err, "parse start %q", startValue)
-	}
-	return start, end, nil
+// cacheOptions defines container log cache flags.
+type cacheOptions struct {
+	enabled bool
+	maxSize string
 }
 
-func parseTimestamp(lt lokiapi.LokiTime, def time.Time) (time.Time, error) {
-	value := string(lt)
-	if value == "" {
-		return def, nil
-	}
+func (opts *cacheOptions) Register(set *pflag.FlagSet) {
+	set.BoolVar(&opts.enabled, "cache", false, "Cache container logs read using Docker API in ~/.docker/logql/cache, use 'docker logql cache clear' to remove them")
+	set.StringVar(&opts.maxSize, "cache-size", "256MiB", "Maximum size of container log cache")
+}
 
-	if strings.Contains(value, ".") {
-		if t, err := strconv.ParseFloat(value, 64); err == nil {
-			s, ns := math.Modf(t)
-			ns = math.Round(ns*1000) / 1000
-			return time.Unix(int64(s), int64(ns*float64(time.Second))), nil
-		}
+// Open opens container log cache.
+//
+// Returns nil, if cache is disabled.
+func (opts *cacheOptions) Open() (*dockerlog.Cache, error) {
+	if !opts.enabled {
+		return nil, nil
 	}
-	nanos, err := strconv.ParseInt(value, 10, 64)
+
+	size, err := humanize.ParseBytes(opts.maxSize)
 	if err != nil {
-		return time.Parse(time.RFC3339Nano, value)
+		return nil, errors.Wrap(err, "parse cache size")
 	}
-	if len(value) <= 10 {
-		return time.Unix(nanos, 0), nil
-	}
-	return time.Unix(0, nanos), nil
+	return openCache(dockerlog.CacheOptions{
+		MaxSize: int64(size),
+	})
 }
 
-func parseStep(param lokiapi.OptPrometheusDuration, start, end time.Time) (time.Duration, error) {
-	v, ok := param.Get()
-	if !ok {
-		return defaultStep(start, end), nil
-	}
-	return parseDuration(v)
+// cacheDir returns path to container log cache directory in Docker config directory.
+func cacheDir() string {
+	return filepath.Join(config.Dir(), "logql", "cache")
 }
 
-func defaultStep(start, end time.Time) time.Duration {
-	seconds := math.Max(
-		math.Floor(end.Sub(start).Seconds()/250),
-		1,
-	)
-	return time.Duration(seconds) * time.Second
+// openCache opens container log cache in Docker config directory.
+func openCache(opts dockerlog.CacheOptions) (*dockerlog.Cache, error) {
+	cache, err := dockerlog.OpenCache(cacheDir(), opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "open cache")
+	}
+	return cache, nil
 }
 
-func parseDuration(param lokiapi.PrometheusDuration) (time.Duration, error) {
-	value := string(param)
-	if !strings.ContainsAny(value, "smhdwy") {
-		f, err := strconv.ParseFloat(value, 64)
-		if err == nil {
-			d := f * float64(time.Second)
-			return time.Duration(d), nil
+// openExistingCache opens container log cache, if cache directory exists.
+//
+// Function returns false, if nothing is cached yet.
+func openExistingCache() (*dockerlog.Cache, bool, error) {
+	if _, err := os.Stat(cacheDir()); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
 		}
+		return nil, false, errors.Wrap(err, "open cache")
+	}
+	cache, err := openCache(dockerlog.CacheOptions{})
+	if err != nil {
+		return nil, false, err
 	}
-	md, err := model.ParseDuration(value)
-	return time.Duration(md), err
+	return cache, true, nil
 }
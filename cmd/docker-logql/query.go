@@ -1,33 +1,33 @@
 package main
 
 import (
-	"cmp"
-	"io"
-	"os"
-	"slices"
-	"strings"
 	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/docker/cli/cli/command"
 	"github.com/go-faster/errors"
-	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
-	"github.com/spf13/pflag"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 
 	"github.com/tdakkota/docker-logql/internal/dockerlog"
+	"github.com/tdakkota/docker-logql/internal/logql"
 	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
 	"github.com/tdakkota/docker-logql/internal/lokiapi"
+	"github.com/tdakkota/docker-logql/internal/lokihandler"
 )
 
 func queryCmd(dcli command.Cli) *cobra.Command {
 	var (
-		start = apiFlagFor[lokiapi.OptLokiTime]("`end - since`")
-		end   = apiFlagFor[lokiapi.OptLokiTime]("now")
-		since = apiFlagFor[lokiapi.OptPrometheusDuration]("6h")
-		step  = apiFlagFor[lokiapi.OptPrometheusDuration]("")
-		limit int
+		timeRange     timeRangeOptions
+		step          = apiFlagFor[lokiapi.OptPrometheusDuration]("")
+		direction     = apiFlagFor[lokiapi.OptDirection](lokiapi.DirectionForward)
+		limit         int
+		logSource     string
+		concurrency   int
+		splitInterval time.Duration
+		strict        bool
+		multiline     multilineOptions
+		cache         cacheOptions
 
 		render renderOptions
 	)
@@ -40,146 +40,121 @@ docker logql query '{}'
 
 # Get logs for last 24h from container "registry" that contains "info".
 docker logql query --since=1d '{container="registry"} |= "info"'
+
+# Get per-container rate of lines with "error" for last hour.
+docker logql query --since=1h 'sum by (container) (rate({} |= "error" [1m]))'
+
+# Get per-container share of lines with "error" for last hour.
+docker logql query --since=1h 'sum by (container) (rate({} |= "error" [1m])) / on(container) sum by (container) (rate({} [1m]))'
+
+# Count lines of every container by hour for last week, evaluating days in parallel.
+docker logql query --since=7d --step=1h --split-interval=1d 'sum by (container) (count_over_time({} [1h]))'
+
+# Get 10 newest lines of container "api".
+docker logql query --direction=backward --limit=10 '{container="api"}'
+
+# Draw a chart of error rate of container "api" for last hour.
+docker logql query --since=1h -o chart 'rate({container="api"} |= "error" [1m])'
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 1 {
 				return errors.Errorf("expected 1 args, got %d", len(args))
 			}
 			var (
-				ctx   = cmd.Context()
+				ctx   = printWarnings(cmd.Context(), cmd.ErrOrStderr())
 				query = args[0]
 			)
 
-			start, end, err := parseTimeRange(
-				time.Now(),
-				*start.Val,
-				*end.Val,
-				*since.Val,
-			)
+			start, end, err := timeRange.Parse(time.Now())
 			if err != nil {
 				return errors.Wrap(err, "parse time range")
 			}
 
-			step, err := parseStep(*step.Val, start, end)
+			step, err := lokihandler.ParseStep(*step.Val, start, end)
 			if err != nil {
 				return errors.Wrap(err, "parse step")
 			}
 
-			q, err := dockerlog.NewQuerier(dcli.Client())
+			dir := direction.Val.Or(lokiapi.DirectionForward)
+			render.backward = dir == lokiapi.DirectionBackward
+			render.chart = chartOptions{
+				start: start,
+				end:   end,
+				step:  step,
+				width: 80,
+			}
+			if _, width := dcli.Out().GetTtySize(); width > 0 {
+				render.chart.width = int(width)
+			}
+
+			multilineOpts, err := multiline.Options()
+			if err != nil {
+				return err
+			}
+			logCache, err := cache.Open()
+			if err != nil {
+				return err
+			}
+			q, err := dockerlog.NewQuerier(dcli.Client(), dockerlog.Options{
+				Source:      dockerlog.LogSource(logSource),
+				Multiline:   multilineOpts,
+				Concurrency: concurrency,
+				Strict:      strict,
+				Cache:       logCache,
+			})
 			if err != nil {
 				return errors.Wrap(err, "create querier")
 			}
-			eng := logqlengine.NewEngine(q, logqlengine.Options{})
-
-			data, err := eng.Eval(ctx, query, logqlengine.EvalParams{
-				Start: pcommon.NewTimestampFromTime(start),
-				End:   pcommon.NewTimestampFromTime(end),
-				Step:  step,
-				Limit: limit,
+			eng := logqlengine.NewEngine(q, logqlengine.Options{
+				SplitInterval: splitInterval,
 			})
+
+			params := logqlengine.EvalParams{
+				Start:     pcommon.NewTimestampFromTime(start),
+				End:       pcommon.NewTimestampFromTime(end),
+				Step:      step,
+				Direction: string(dir),
+				Limit:     limit,
+			}
+			if render.output != outputJSON && isLogQuery(query) {
+				// Print entries as they arrive instead of buffering the whole result.
+				iter, err := eng.EvalStream(ctx, query, params)
+				if err != nil {
+					return errors.Wrap(err, "eval")
+				}
+				defer func() {
+					_ = iter.Close()
+				}()
+				return renderEntries(cmd.OutOrStdout(), render, iter)
+			}
+
+			data, err := eng.Eval(ctx, query, params)
 			if err != nil {
 				return errors.Wrap(err, "eval")
 			}
 			return renderResult(cmd.OutOrStdout(), render, data)
 		},
 	}
-	cmd.Flags().Var(&start, "start", "Start of query range")
-	cmd.Flags().Var(&end, "end", "End of query range")
-	cmd.Flags().Var(&since, "since", "A duration used to calculate `start` relative to `end`")
+	timeRange.Register(cmd.Flags())
+	cmd.Flags().StringVar(&logSource, "log-source", string(dockerlog.LogSourceAuto), "Where to read container logs from (auto, api, file)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 16, "Maximum number of container logs opened at once")
+	cmd.Flags().DurationVar(&splitInterval, "split-interval", 0, "Split range metric queries into time shards of given length evaluated in parallel, 0 disables splitting")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail, if log of some container cannot be read, instead of skipping it with a warning")
+	multiline.Register(cmd.Flags())
+	cache.Register(cmd.Flags())
 	cmd.Flags().Var(&step, "step", "Query resolution step")
+	cmd.Flags().Var(&direction, "direction", "Log query direction (forward, backward), backward returns the newest entries first")
 	cmd.Flags().IntVar(&limit, "limit", -1, "Limit result")
 	render.Register(cmd.Flags())
 	return cmd
 }
 
-type renderOptions struct {
-	timestamp bool
-	container bool
-	color     bool
-}
-
-func (opts *renderOptions) Register(set *pflag.FlagSet) {
-	set.BoolVarP(&opts.timestamp, "timestamp", "t", true, "Show timestamps")
-	set.BoolVarP(&opts.container, "container", "c", true, "Show container name")
-	disableColor := os.Getenv("NO_COLOR") != "" ||
-		os.Getenv("TERM") == "dumb" ||
-		(!isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd()))
-	set.BoolVar(&opts.color, "color", !disableColor, "Enable color")
-}
-
-type entry struct {
-	lokiapi.LogEntry
-	container string
-}
-
-func renderResult(stdout io.Writer, opts renderOptions, data lokiapi.QueryResponseData) error {
-	switch t := data.Type; t {
-	case lokiapi.StreamsResultQueryResponseData:
-		var (
-			entries         []entry
-			containerColors map[string]string
-		)
-
-		for _, stream := range data.StreamsResult.Result {
-			labels := stream.Stream.Value
-			for _, e := range stream.Values {
-				container := labels["container"]
-				if opts.color {
-					if containerColors == nil {
-						containerColors = map[string]string{}
-					}
-					if _, ok := containerColors[container]; !ok {
-						colorName := names[len(containerColors)%len(names)+1]
-						containerColors[container] = colors[colorName]
-					}
-				}
-				entries = append(entries, entry{
-					LogEntry:  e,
-					container: container,
-				})
-			}
-		}
-		slices.SortFunc(entries, func(a, b entry) int {
-			return cmp.Compare(a.T, b.T)
-		})
-
-		var buf []byte
-		for _, entry := range entries {
-			buf = buf[:0]
-
-			if opts.container {
-				if opts.color {
-					color := containerColors[entry.container]
-					buf = append(buf, color...)
-				}
-				buf = append(buf, entry.container...)
-				if opts.color {
-					buf = append(buf, resetColor...)
-				}
-				buf = append(buf, ' ')
-			}
-			if opts.timestamp {
-				ts := time.Unix(0, int64(entry.T))
-				if opts.color {
-					buf = append(buf, colors["blue"]...)
-				}
-				buf = ts.AppendFormat(buf, time.RFC3339Nano)
-				if opts.color {
-					buf = append(buf, resetColor...)
-				}
-				buf = append(buf, ' ')
-			}
-			msg := strings.TrimRight(entry.V, "\r\n")
-			buf = append(buf, msg...)
-			buf = append(buf, "\n"...)
-
-			if _, err := stdout.Write(buf); err != nil {
-				return err
-			}
-		}
-
-		return nil
-	default:
-		return errors.Errorf("unsupported result %q", t)
+// isLogQuery whether query is a valid log query.
+func isLogQuery(query string) bool {
+	expr, err := logql.Parse(query, logql.ParseOptions{})
+	if err != nil {
+		return false
 	}
+	_, ok := logql.UnparenExpr(expr).(*logql.LogExpr)
+	return ok
 }
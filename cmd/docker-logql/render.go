@@ -0,0 +1,396 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+// outputFormat defines result output format.
+type outputFormat string
+
+const (
+	// outputText is a human-readable output.
+	outputText outputFormat = "text"
+	// outputJSON is a Loki-compatible JSON query response.
+	outputJSON outputFormat = "json"
+	// outputJSONL is a JSON object per entry or sample.
+	outputJSONL outputFormat = "jsonl"
+	// outputLogfmt is a logfmt record per entry or sample.
+	outputLogfmt outputFormat = "logfmt"
+	// outputRaw is a line or value per entry or sample.
+	outputRaw outputFormat = "raw"
+	// outputChart is a line chart of range metric query result.
+	outputChart outputFormat = "chart"
+	// outputSparkline is a sparkline per series of range metric query result.
+	outputSparkline outputFormat = "sparkline"
+)
+
+// isChart whether format draws range metric query result.
+func (f outputFormat) isChart() bool {
+	return f == outputChart || f == outputSparkline
+}
+
+var _ pflag.Value = (*outputFormat)(nil)
+
+// String implements [pflag.Value].
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+// Set implements [pflag.Value].
+func (f *outputFormat) Set(val string) error {
+	switch v := outputFormat(val); v {
+	case outputText, outputJSON, outputJSONL, outputLogfmt, outputRaw, outputChart, outputSparkline:
+		*f = v
+		return nil
+	default:
+		return errors.Errorf("unknown output format %q", val)
+	}
+}
+
+// Type implements [pflag.Value].
+func (f *outputFormat) Type() string {
+	return "format"
+}
+
+type renderOptions struct {
+	timestamp bool
+	container bool
+	color     bool
+	output    outputFormat
+	chart     chartOptions
+	// backward is true, if entries are printed from the newest to the oldest.
+	backward bool
+}
+
+func (opts *renderOptions) Register(set *pflag.FlagSet) {
+	opts.output = outputText
+	set.VarP(&opts.output, "output", "o", "Output format (text, json, jsonl, logfmt, raw, chart, sparkline)")
+	set.BoolVarP(&opts.timestamp, "timestamp", "t", true, "Show timestamps")
+	set.BoolVarP(&opts.container, "container", "c", true, "Show container name")
+	disableColor := os.Getenv("NO_COLOR") != "" ||
+		os.Getenv("TERM") == "dumb" ||
+		(!isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd()))
+	set.BoolVar(&opts.color, "color", !disableColor, "Enable color")
+}
+
+func renderResult(stdout io.Writer, opts renderOptions, data lokiapi.QueryResponseData) error {
+	switch {
+	case opts.output == outputJSON:
+		return renderJSON(stdout, data)
+	case opts.output.isChart():
+		switch {
+		case data.Type != lokiapi.MatrixResultQueryResponseData:
+			// Only range query result could be drawn.
+			opts.output = outputText
+		case opts.output == outputSparkline:
+			return renderSparklines(stdout, opts, data.MatrixResult)
+		default:
+			return renderLineChart(stdout, opts, data.MatrixResult)
+		}
+	}
+
+	switch t := data.Type; t {
+	case lokiapi.StreamsResultQueryResponseData:
+		var entries []logqlengine.Entry
+		for _, stream := range data.StreamsResult.Result {
+			labels := stream.Stream.Value
+			for _, e := range stream.Values {
+				entries = append(entries, logqlengine.Entry{
+					Timestamp: pcommon.Timestamp(e.T),
+					Line:      e.V,
+					Labels:    labels,
+				})
+			}
+		}
+		slices.SortFunc(entries, func(a, b logqlengine.Entry) int {
+			if opts.backward {
+				return cmp.Compare(b.Timestamp, a.Timestamp)
+			}
+			return cmp.Compare(a.Timestamp, b.Timestamp)
+		})
+
+		p := newEntryPrinter(stdout, opts)
+		for _, entry := range entries {
+			if err := p.Print(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	case lokiapi.ScalarResultQueryResponseData,
+		lokiapi.VectorResultQueryResponseData,
+		lokiapi.MatrixResultQueryResponseData:
+		if opts.output != outputText {
+			return renderSamples(stdout, opts, data)
+		}
+		return renderMetric(stdout, opts, data)
+	default:
+		return errors.Errorf("unsupported result %q", t)
+	}
+}
+
+// printWarnings returns a new context that prints query warnings to stderr as they are reported.
+func printWarnings(ctx context.Context, stderr io.Writer) context.Context {
+	return logqlengine.WithWarnings(ctx, &logqlengine.Warnings{
+		Handler: func(msg string) {
+			fmt.Fprintf(stderr, "warning: %s\n", msg)
+		},
+	})
+}
+
+// renderEntries prints log query entries as they arrive.
+func renderEntries(stdout io.Writer, opts renderOptions, iter iterators.Iterator[logqlengine.Entry]) error {
+	if opts.output.isChart() {
+		// Only range query result could be drawn.
+		opts.output = outputText
+	}
+
+	var (
+		p     = newEntryPrinter(stdout, opts)
+		entry logqlengine.Entry
+	)
+	for iter.Next(&entry) {
+		if err := p.Print(entry); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func renderMetric(stdout io.Writer, opts renderOptions, data lokiapi.QueryResponseData) error {
+	switch t := data.Type; t {
+	case lokiapi.ScalarResultQueryResponseData:
+		return renderScalar(stdout, opts, data.ScalarResult)
+	case lokiapi.VectorResultQueryResponseData:
+		return renderVector(stdout, opts, data.VectorResult)
+	case lokiapi.MatrixResultQueryResponseData:
+		return renderMatrix(stdout, opts, data.MatrixResult)
+	default:
+		return errors.Errorf("unsupported result %q", t)
+	}
+}
+
+// entryPrinter writes log entries in selected output format.
+type entryPrinter struct {
+	out  io.Writer
+	opts renderOptions
+
+	containerColors colorPicker
+	buf             []byte
+	structured      structuredPrinter
+}
+
+func newEntryPrinter(out io.Writer, opts renderOptions) *entryPrinter {
+	return &entryPrinter{
+		out:  out,
+		opts: opts,
+		structured: structuredPrinter{
+			out:    out,
+			format: opts.output,
+		},
+	}
+}
+
+// Print writes given entry.
+func (p *entryPrinter) Print(entry logqlengine.Entry) error {
+	if p.opts.output != outputText {
+		ts := time.Unix(0, int64(entry.Timestamp))
+		return p.structured.Print(ts, entry.Labels, "line", strings.TrimRight(entry.Line, "\r\n"))
+	}
+
+	var (
+		opts = p.opts
+		buf  = p.buf[:0]
+	)
+
+	if opts.container {
+		container := entry.Labels["container"]
+		if opts.color {
+			buf = append(buf, p.containerColors.Pick(container)...)
+		}
+		buf = append(buf, container...)
+		if opts.color {
+			buf = append(buf, resetColor...)
+		}
+		buf = append(buf, ' ')
+	}
+	if opts.timestamp {
+		ts := time.Unix(0, int64(entry.Timestamp))
+		if opts.color {
+			buf = append(buf, colors["blue"]...)
+		}
+		buf = ts.AppendFormat(buf, time.RFC3339Nano)
+		if opts.color {
+			buf = append(buf, resetColor...)
+		}
+		buf = append(buf, ' ')
+	}
+	msg := strings.TrimRight(entry.Line, "\r\n")
+	buf = append(buf, msg...)
+	buf = append(buf, "\n"...)
+	p.buf = buf
+
+	_, err := p.out.Write(buf)
+	return err
+}
+
+func renderScalar(stdout io.Writer, opts renderOptions, r lokiapi.ScalarResult) error {
+	var buf []byte
+	if opts.timestamp {
+		buf = appendPrometheusTimestamp(buf, opts, r.Result.T)
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, r.Result.V...)
+	buf = append(buf, '\n')
+
+	_, err := stdout.Write(buf)
+	return err
+}
+
+func renderVector(stdout io.Writer, opts renderOptions, r lokiapi.VectorResult) error {
+	type row struct {
+		series string
+		value  lokiapi.FPoint
+	}
+	var (
+		rows  = make([]row, 0, len(r.Result))
+		width int
+	)
+	for _, s := range r.Result {
+		series := formatLabels(s.Metric.Value)
+		width = max(width, len(series))
+		rows = append(rows, row{
+			series: series,
+			value:  s.Value,
+		})
+	}
+	slices.SortFunc(rows, func(a, b row) int {
+		return strings.Compare(a.series, b.series)
+	})
+
+	var (
+		seriesColors colorPicker
+		buf          []byte
+	)
+	for _, row := range rows {
+		buf = buf[:0]
+		if opts.timestamp {
+			buf = appendPrometheusTimestamp(buf, opts, row.value.T)
+			buf = append(buf, ' ')
+		}
+		buf = appendColored(buf, opts, seriesColors.Pick(row.series), row.series)
+		// Align values.
+		for i := len(row.series); i < width; i++ {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, ' ')
+		buf = append(buf, row.value.V...)
+		buf = append(buf, '\n')
+
+		if _, err := stdout.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderMatrix(stdout io.Writer, opts renderOptions, r lokiapi.MatrixResult) error {
+	type series struct {
+		name   string
+		values []lokiapi.FPoint
+	}
+	result := make([]series, 0, len(r.Result))
+	for _, s := range r.Result {
+		result = append(result, series{
+			name:   formatLabels(s.Metric.Value),
+			values: s.Values,
+		})
+	}
+	slices.SortFunc(result, func(a, b series) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	var (
+		seriesColors colorPicker
+		buf          []byte
+	)
+	for _, s := range result {
+		buf = appendColored(buf[:0], opts, seriesColors.Pick(s.name), s.name)
+		buf = append(buf, '\n')
+
+		for _, p := range s.values {
+			buf = append(buf, "  "...)
+			if opts.timestamp {
+				buf = appendPrometheusTimestamp(buf, opts, p.T)
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, p.V...)
+			buf = append(buf, '\n')
+		}
+
+		if _, err := stdout.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLabels formats label set in Prometheus style.
+func formatLabels(set lokiapi.LabelSet) string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i != 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(set[k]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func appendColored(buf []byte, opts renderOptions, color, s string) []byte {
+	if !opts.color {
+		return append(buf, s...)
+	}
+	buf = append(buf, color...)
+	buf = append(buf, s...)
+	buf = append(buf, resetColor...)
+	return buf
+}
+
+func appendPrometheusTimestamp(buf []byte, opts renderOptions, t float64) []byte {
+	ts := prometheusTime(t)
+	if opts.color {
+		buf = append(buf, colors["blue"]...)
+	}
+	buf = ts.AppendFormat(buf, time.RFC3339Nano)
+	if opts.color {
+		buf = append(buf, resetColor...)
+	}
+	return buf
+}
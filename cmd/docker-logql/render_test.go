@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+func TestRenderMetric(t *testing.T) {
+	ts := float64(time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC).Unix())
+
+	tests := []struct {
+		name string
+		data lokiapi.QueryResponseData
+		want string
+	}{
+		{
+			"Scalar",
+			lokiapi.NewScalarResultQueryResponseData(lokiapi.ScalarResult{
+				Result: lokiapi.FPoint{T: ts, V: "1.5"},
+			}),
+			"1.5\n",
+		},
+		{
+			"EmptyVector",
+			lokiapi.NewVectorResultQueryResponseData(lokiapi.VectorResult{}),
+			"",
+		},
+		{
+			"Vector",
+			lokiapi.NewVectorResultQueryResponseData(lokiapi.VectorResult{
+				Result: lokiapi.Vector{
+					{Metric: lokiapi.NewOptLabelSet(lokiapi.LabelSet{"container": "db"}), Value: lokiapi.FPoint{T: ts, V: "+Inf"}},
+					{Metric: lokiapi.NewOptLabelSet(lokiapi.LabelSet{"container": "api", "stream": "stderr"}), Value: lokiapi.FPoint{T: ts, V: "2"}},
+					{Value: lokiapi.FPoint{T: ts, V: "NaN"}},
+				},
+			}),
+			`{container="api", stream="stderr"} 2` + "\n" +
+				`{container="db"}                   +Inf` + "\n" +
+				`{}                                 NaN` + "\n",
+		},
+		{
+			"EmptyMatrix",
+			lokiapi.NewMatrixResultQueryResponseData(lokiapi.MatrixResult{}),
+			"",
+		},
+		{
+			"Matrix",
+			lokiapi.NewMatrixResultQueryResponseData(lokiapi.MatrixResult{
+				Result: lokiapi.Matrix{
+					{
+						Metric: lokiapi.NewOptLabelSet(lokiapi.LabelSet{"container": "db"}),
+						Values: []lokiapi.FPoint{{T: ts, V: "1"}, {T: ts + 60, V: "2"}},
+					},
+					{
+						Metric: lokiapi.NewOptLabelSet(lokiapi.LabelSet{"container": "api"}),
+						Values: []lokiapi.FPoint{{T: ts, V: "3"}},
+					},
+				},
+			}),
+			`{container="api"}` + "\n" +
+				"  3\n" +
+				`{container="db"}` + "\n" +
+				"  1\n" +
+				"  2\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			require.NoError(t, renderResult(&sb, renderOptions{output: outputText}, tt.data))
+			require.Equal(t, tt.want, sb.String())
+		})
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	for _, tt := range []struct {
+		set  lokiapi.LabelSet
+		want string
+	}{
+		{nil, "{}"},
+		{lokiapi.LabelSet{"container": "api"}, `{container="api"}`},
+		{lokiapi.LabelSet{"stream": "stderr", "container": "a\"pi"}, `{container="a\"pi", stream="stderr"}`},
+	} {
+		require.Equal(t, tt.want, formatLabels(tt.set))
+	}
+}
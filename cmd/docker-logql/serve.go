@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/docker/cli/cli/command"
+	"github.com/go-faster/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/tdakkota/docker-logql/internal/dockerlog"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+	"github.com/tdakkota/docker-logql/internal/lokihandler"
+)
+
+func serveCmd(dcli command.Cli) *cobra.Command {
+	var (
+		addr          string
+		logSource     string
+		concurrency   int
+		splitInterval time.Duration
+		strict        bool
+		multiline     multilineOptions
+		cache         cacheOptions
+	)
+	cmd := &cobra.Command{
+		Use:  "serve",
+		Args: cobra.NoArgs,
+		Example: heredoc.Doc(`
+# Serve Loki API on default address, use "http://localhost:3100" as Loki data source URL in Grafana.
+docker logql serve
+
+# Serve Loki API on all interfaces.
+docker logql serve --addr=0.0.0.0:3100
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			multilineOpts, err := multiline.Options()
+			if err != nil {
+				return err
+			}
+			logCache, err := cache.Open()
+			if err != nil {
+				return err
+			}
+			q, err := dockerlog.NewQuerier(dcli.Client(), dockerlog.Options{
+				Source:      dockerlog.LogSource(logSource),
+				Multiline:   multilineOpts,
+				Concurrency: concurrency,
+				Strict:      strict,
+				Cache:       logCache,
+			})
+			if err != nil {
+				return errors.Wrap(err, "create querier")
+			}
+			var (
+				parseOpts = logql.ParseOptions{}
+				eng       = logqlengine.NewEngine(q, logqlengine.Options{
+					ParseOptions:  parseOpts,
+					SplitInterval: splitInterval,
+				})
+			)
+
+			api, err := lokiapi.NewServer(lokihandler.NewLokiAPI(q, eng, parseOpts))
+			if err != nil {
+				return errors.Wrap(err, "create server")
+			}
+
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return errors.Wrap(err, "listen")
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Serving Loki API on http://%s\n", ln.Addr())
+
+			srv := &http.Server{
+				Handler:           lokihandler.WithWarnings(api),
+				ReadHeaderTimeout: 15 * time.Second,
+			}
+			go func() {
+				<-ctx.Done()
+
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = srv.Shutdown(shutdownCtx)
+			}()
+
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return errors.Wrap(err, "serve")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:3100", "Address to listen")
+	cmd.Flags().StringVar(&logSource, "log-source", string(dockerlog.LogSourceAuto), "Where to read container logs from (auto, api, file)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 16, "Maximum number of container logs opened at once")
+	cmd.Flags().DurationVar(&splitInterval, "split-interval", 0, "Split range metric queries into time shards of given length evaluated in parallel, 0 disables splitting")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail, if log of some container cannot be read, instead of skipping it with a warning")
+	multiline.Register(cmd.Flags())
+	cache.Register(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/docker/cli/cli/command"
+	"github.com/go-faster/errors"
+	"github.com/prometheus/common/model"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/dockerlog"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+func tailCmd(dcli command.Cli) *cobra.Command {
+	var (
+		since     = apiFlagFor[lokiapi.OptPrometheusDuration]("")
+		strict    bool
+		multiline multilineOptions
+
+		render renderOptions
+	)
+	cmd := &cobra.Command{
+		Use:  "tail <logql>",
+		Args: cobra.ExactArgs(1),
+		Example: heredoc.Doc(`
+# Follow logs of all running containers.
+docker logql tail '{}'
+
+# Follow errors of container "api", including last 5 minutes.
+docker logql tail --since=5m '{container="api"} |= "error"'
+
+# Follow logs of container "api", joining lines that do not start with a date.
+docker logql tail --multiline-start='^\d{4}-\d{2}-\d{2}' '{container="api"}'
+		`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.Errorf("expected 1 args, got %d", len(args))
+			}
+			var (
+				ctx   = printWarnings(cmd.Context(), cmd.ErrOrStderr())
+				query = args[0]
+			)
+			if render.output == outputJSON || render.output.isChart() {
+				return errors.Errorf("output format %q is not supported by tail", render.output)
+			}
+
+			var start pcommon.Timestamp
+			if v, ok := since.Val.Get(); ok {
+				d, err := model.ParseDuration(string(v))
+				if err != nil {
+					return errors.Wrap(err, "parse since")
+				}
+				start = pcommon.NewTimestampFromTime(time.Now().Add(-time.Duration(d)))
+			}
+
+			multilineOpts, err := multiline.Options()
+			if err != nil {
+				return err
+			}
+			q, err := dockerlog.NewQuerier(dcli.Client(), dockerlog.Options{
+				Multiline: multilineOpts,
+				Strict:    strict,
+			})
+			if err != nil {
+				return errors.Wrap(err, "create querier")
+			}
+			eng := logqlengine.NewEngine(q, logqlengine.Options{})
+
+			iter, err := eng.Tail(ctx, query, logqlengine.TailParams{
+				Start: start,
+			})
+			if err != nil {
+				return errors.Wrap(err, "tail")
+			}
+			defer func() {
+				_ = iter.Close()
+			}()
+			return renderEntries(cmd.OutOrStdout(), render, iter)
+		},
+	}
+	cmd.Flags().Var(&since, "since", "Show records for given duration before now")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail, if log of some container cannot be read, instead of skipping it with a warning")
+	multiline.Register(cmd.Flags())
+	render.Register(cmd.Flags())
+	return cmd
+}
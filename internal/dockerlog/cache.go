@@ -0,0 +1,993 @@
+package dockerlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/multierr"
+
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// Cache is an on-disk cache of container logs read using Docker API.
+//
+// Cache entry stores records of container for a time range. Entry is extended
+// by records written after the cached range, so only new records are queried.
+// Container could have multiple entries with different range starts.
+//
+// Cache is safe for concurrent use. Cache directory could be shared by multiple
+// processes, since entries are replaced atomically. However, only commits of
+// the same Cache are serialized, so a process could replace an entry extended
+// by other process with a shorter one. Such entry is still valid, records it
+// lacks are read again by the next query.
+type Cache struct {
+	dir     string
+	maxSize int64
+	// commitMux prevents concurrent queries of this Cache from replacing larger
+	// entry with smaller one.
+	commitMux sync.Mutex
+}
+
+// CacheOptions defines Cache options.
+type CacheOptions struct {
+	// MaxSize is a maximum total size of cache entries in bytes.
+	//
+	// Least recently used entries are evicted, if cache exceeds the limit.
+	// Defaults to 256 MiB.
+	MaxSize int64
+}
+
+func (o *CacheOptions) setDefaults() {
+	if o.MaxSize == 0 {
+		o.MaxSize = 256 << 20
+	}
+}
+
+func (o CacheOptions) validate() error {
+	if o.MaxSize < 0 {
+		return errors.Errorf("invalid max size %d", o.MaxSize)
+	}
+	return nil
+}
+
+// OpenCache opens cache in given directory, creating it, if it does not exist.
+func OpenCache(dir string, opts CacheOptions) (*Cache, error) {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "create cache directory")
+	}
+	return &Cache{
+		dir:     dir,
+		maxSize: opts.MaxSize,
+	}, nil
+}
+
+// CacheEntry describes cached container log.
+type CacheEntry struct {
+	// ContainerID is an ID of container.
+	ContainerID string
+	// Streams is a list of cached output streams.
+	Streams []string
+	// Since and Until define cached time range.
+	Since, Until otelstorage.Timestamp
+	// Complete is true, if container was stopped, so entry contains every record after Since.
+	Complete bool
+	// Size is a size of entry in bytes.
+	Size int64
+	// LastUsed is a time when entry was written or read last time.
+	LastUsed time.Time
+}
+
+// Entries returns list of cache entries, from the most recently used to the least.
+func (c *Cache) Entries() (r []CacheEntry, _ error) {
+	files, err := c.files(cacheExt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		id, streams, ok := parseCacheFileName(f.name)
+		if !ok {
+			continue
+		}
+
+		h, err := readCacheHeader(filepath.Join(c.dir, f.name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// Entry is evicted.
+				continue
+			}
+			return nil, errors.Wrapf(err, "read entry %q", f.name)
+		}
+
+		r = append(r, CacheEntry{
+			ContainerID: id,
+			Streams:     streams,
+			Since:       h.since,
+			Until:       h.until,
+			Complete:    h.finished != 0,
+			Size:        f.size,
+			LastUsed:    f.modTime,
+		})
+	}
+	slices.SortStableFunc(r, func(a, b CacheEntry) int {
+		return b.LastUsed.Compare(a.LastUsed)
+	})
+	return r, nil
+}
+
+// Clear removes every cache entry.
+//
+// Entries being written are kept, unless they are stale.
+func (c *Cache) Clear() error {
+	files, err := c.files(cacheExt)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, f := range files {
+		if err := os.Remove(filepath.Join(c.dir, f.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = multierr.Append(errs, err)
+		}
+	}
+	return multierr.Append(errs, c.removeStale())
+}
+
+// evict removes least recently used entries until cache fits the size limit.
+func (c *Cache) evict() error {
+	if err := c.removeStale(); err != nil {
+		return err
+	}
+
+	files, err := c.files(cacheExt)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if total <= c.maxSize {
+		return nil
+	}
+
+	slices.SortFunc(files, func(a, b cacheFile) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// staleEntryAge is a time since the last write after which unfinished entry is considered abandoned,
+// e.g. if process is killed.
+const staleEntryAge = 24 * time.Hour
+
+// removeStale removes abandoned unfinished entries.
+//
+// Unfinished entries are not evicted, since they could be written by another query or process.
+func (c *Cache) removeStale() error {
+	files, err := c.files(cacheTempExt)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(-staleEntryAge)
+	for _, f := range files {
+		if f.modTime.After(deadline) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+type cacheFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// files returns cache files with given extension.
+func (c *Cache) files(ext string) (r []cacheFile, _ error) {
+	dir, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read cache directory")
+	}
+
+	for _, e := range dir {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		r = append(r, cacheFile{
+			name:    name,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	return r, nil
+}
+
+const (
+	cacheExt     = ".lqc"
+	cacheTempExt = ".tmp"
+
+	cacheMagic   = "LQLC"
+	cacheVersion = 1
+	// cacheHeaderLen is a length of entry header: magic, version and three timestamps.
+	cacheHeaderLen = 4 + 1 + 3*8
+
+	// maxCachedBodySize is a maximum size of cached record body.
+	//
+	// Larger size means that entry is corrupted.
+	maxCachedBodySize = 64 << 20
+)
+
+// cacheKey identifies cache entry.
+type cacheKey struct {
+	id      string
+	streams logStreams
+	// since is a start of cached range.
+	since otelstorage.Timestamp
+}
+
+// prefix returns common file name prefix of container entries.
+func (k cacheKey) prefix() string {
+	return k.id + "-" + strings.Join(k.streams.Names(), "+") + "-"
+}
+
+func (k cacheKey) fileName() string {
+	return k.prefix() + strconv.FormatUint(uint64(k.since), 10) + cacheExt
+}
+
+func parseCacheFileName(name string) (id string, streams []string, ok bool) {
+	name, ok = strings.CutSuffix(name, cacheExt)
+	if !ok {
+		return "", nil, false
+	}
+	parts := strings.Split(name, "-")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return "", nil, false
+	}
+	if _, err := strconv.ParseUint(parts[2], 10, 64); err != nil {
+		return "", nil, false
+	}
+	return parts[0], strings.Split(parts[1], "+"), true
+}
+
+// cacheHeader is a cache entry header.
+type cacheHeader struct {
+	// since and until define time range of cached records.
+	since, until otelstorage.Timestamp
+	// finished is a time when container was stopped, if entry contains every record after since.
+	finished otelstorage.Timestamp
+}
+
+func (h cacheHeader) encode() []byte {
+	buf := make([]byte, 0, cacheHeaderLen)
+	buf = append(buf, cacheMagic...)
+	buf = append(buf, cacheVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.since))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.until))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.finished))
+	return buf
+}
+
+func (h *cacheHeader) decode(buf []byte) error {
+	if len(buf) < cacheHeaderLen || string(buf[:len(cacheMagic)]) != cacheMagic {
+		return errors.New("invalid cache entry header")
+	}
+	buf = buf[len(cacheMagic):]
+	if v := buf[0]; v != cacheVersion {
+		return errors.Errorf("unsupported cache entry version %d", v)
+	}
+	buf = buf[1:]
+	h.since = otelstorage.Timestamp(binary.BigEndian.Uint64(buf))
+	h.until = otelstorage.Timestamp(binary.BigEndian.Uint64(buf[8:]))
+	h.finished = otelstorage.Timestamp(binary.BigEndian.Uint64(buf[16:]))
+	return nil
+}
+
+// replaces whether entry could replace old entry without losing cached records.
+func (h cacheHeader) replaces(old cacheHeader) bool {
+	if h.since > old.since {
+		return false
+	}
+	return h.until > old.until || (h.until == old.until && (h.finished != 0 || old.finished == 0))
+}
+
+// extends whether entry contains records before given range start, so it could be extended by newer records.
+func (h cacheHeader) extends(start otelstorage.Timestamp) bool {
+	return h.since <= start && start <= h.until
+}
+
+// covers whether entry contains every record of given container in given range.
+func (h cacheHeader) covers(ctr container, start, end otelstorage.Timestamp) bool {
+	switch {
+	case start < h.since:
+		return false
+	case h.finished != 0 && h.finished == ctr.finishedAt:
+		// Container is not restarted since then.
+		return true
+	default:
+		return end != 0 && end <= h.until
+	}
+}
+
+func readCacheHeader(path string) (h cacheHeader, _ error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return h, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var buf [cacheHeaderLen]byte
+	if _, err := io.ReadFull(f, buf[:]); err != nil {
+		return h, errors.Wrap(err, "read header")
+	}
+	return h, h.decode(buf[:])
+}
+
+// cachedLog is an opened cache entry.
+type cachedLog struct {
+	key    cacheKey
+	file   *os.File
+	header cacheHeader
+	// size is a size of compressed records.
+	size int64
+}
+
+// lookup opens container entry that covers given range, or the entry
+// that could be extended to cover it with the most records.
+//
+// Returns fs.ErrNotExist, if there is no such entry.
+func (c *Cache) lookup(ctr container, start, end otelstorage.Timestamp) (*cachedLog, error) {
+	key := cacheKey{id: ctr.ID, streams: ctr.streams}
+	names, err := filepath.Glob(filepath.Join(c.dir, key.prefix()+"*"+cacheExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		found bool
+		best  cacheHeader
+	)
+	for _, name := range names {
+		h, err := readCacheHeader(name)
+		if err != nil {
+			// Entry is evicted or corrupted.
+			continue
+		}
+		if h.covers(ctr, start, end) {
+			found, best = true, h
+			break
+		}
+		if h.extends(start) && (!found || h.until > best.until) {
+			found, best = true, h
+		}
+	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+
+	// Entry is keyed by start of its range.
+	key.since = best.since
+	return c.open(key)
+}
+
+// open opens cache entry of given key.
+func (c *Cache) open(key cacheKey) (_ *cachedLog, rerr error) {
+	path := filepath.Join(c.dir, key.fileName())
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr != nil {
+			_ = f.Close()
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		buf [cacheHeaderLen]byte
+		h   cacheHeader
+	)
+	if _, err := io.ReadFull(f, buf[:]); err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+	if err := h.decode(buf[:]); err != nil {
+		return nil, err
+	}
+
+	// Modification time is used to track recently used entries.
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return &cachedLog{
+		key:    key,
+		file:   f,
+		header: h,
+		size:   info.Size() - cacheHeaderLen,
+	}, nil
+}
+
+// records returns iterator over cached records in given range.
+func (l *cachedLog) records(start, end otelstorage.Timestamp, resource otelstorage.Attrs) *cacheIter {
+	return &cacheIter{
+		file:     l.file,
+		rd:       io.NewSectionReader(l.file, cacheHeaderLen, l.size),
+		resource: resource,
+		start:    start,
+		end:      end,
+	}
+}
+
+// Close closes entry file.
+func (l *cachedLog) Close() error {
+	return l.file.Close()
+}
+
+// cacheIter reads records of cache entry.
+type cacheIter struct {
+	file *os.File
+	rd   io.Reader
+	br   *bufio.Reader
+	buf  []byte
+	err  error
+
+	resource otelstorage.Attrs
+	// start and end define time range of records to return.
+	start, end otelstorage.Timestamp
+	// next is an iterator of records written after cached ones, if any.
+	next logiter
+}
+
+var _ logiter = (*cacheIter)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *cacheIter) Next(r *logstorage.Record) bool {
+	if i.err != nil {
+		return false
+	}
+	if i.br == nil {
+		zr, err := gzip.NewReader(i.rd)
+		switch {
+		case errors.Is(err, io.EOF):
+			// Entry has no records.
+			i.br = bufio.NewReader(strings.NewReader(""))
+		case err != nil:
+			i.err = errors.Wrap(err, "open cache entry")
+			return false
+		default:
+			i.br = bufio.NewReader(zr)
+		}
+	}
+
+	for {
+		*r = logstorage.Record{
+			Attrs:         otelstorage.Attrs(pcommon.NewMap()),
+			ResourceAttrs: i.resource,
+		}
+		ok, err := i.readRecord(r)
+		if err != nil {
+			i.err = errors.Wrap(err, "read cache entry")
+			return false
+		}
+		if !ok {
+			return i.next != nil && i.next.Next(r)
+		}
+		if inRange(r.Timestamp, i.start, i.end) {
+			return true
+		}
+	}
+}
+
+func (i *cacheIter) readRecord(r *logstorage.Record) (bool, error) {
+	ts, err := binary.ReadUvarint(i.br)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "read timestamp")
+	}
+	typ, err := i.br.ReadByte()
+	if err != nil {
+		return false, errors.Wrap(err, "read stream")
+	}
+	size, err := binary.ReadUvarint(i.br)
+	if err != nil {
+		return false, errors.Wrap(err, "read body size")
+	}
+	if size > maxCachedBodySize {
+		return false, errors.Errorf("body size %d is too big", size)
+	}
+
+	i.buf = slices.Grow(i.buf[:0], int(size))[:size]
+	if _, err := io.ReadFull(i.br, i.buf); err != nil {
+		return false, errors.Wrap(err, "read body")
+	}
+
+	r.Timestamp = otelstorage.Timestamp(ts)
+	r.ObservedTimestamp = r.Timestamp
+	r.Body = string(i.buf)
+	r.Attrs.AsMap().PutStr(streamLabel, stdType(typ).String())
+	return true, nil
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *cacheIter) Err() error {
+	if i.err != nil {
+		return i.err
+	}
+	if i.next != nil {
+		return i.next.Err()
+	}
+	return nil
+}
+
+// Close closes iterator.
+func (i *cacheIter) Close() error {
+	err := i.file.Close()
+	if i.next != nil {
+		err = multierr.Append(err, i.next.Close())
+	}
+	return err
+}
+
+// errCacheEntryTooBig is returned when entry exceeds cache size limit.
+var errCacheEntryTooBig = errors.New("cache entry is too big")
+
+// cacheWriter writes a new cache entry.
+//
+// Entry is written to temporary file and replaces existing entry on commit.
+type cacheWriter struct {
+	cache *Cache
+	key   cacheKey
+	file  *os.File
+	zw    *gzip.Writer
+	err   error
+
+	// last is the timestamp of the newest written record.
+	last otelstorage.Timestamp
+	// newest is the timestamp of the newest record passed to the writer.
+	newest otelstorage.Timestamp
+	// recent is a queue of records read during cacheOrderMargin before the newest one.
+	//
+	// Records are written once they are older, see cacheOrderMargin.
+	recent []recentRecord
+	// pending is encoded records starting from the first incomplete message.
+	//
+	// Rest of incomplete message could be written later, so pending records
+	// are written only if container is stopped.
+	pending []byte
+	// pendingSince and pendingLast are the oldest and the newest timestamps of pending records.
+	pendingSince, pendingLast otelstorage.Timestamp
+	// size is a size of written data.
+	size int64
+}
+
+// create creates a new cache entry writer.
+//
+// If base is not nil, new entry contains base records followed by written ones.
+func (c *Cache) create(key cacheKey, base *cachedLog) (_ *cacheWriter, rerr error) {
+	f, err := os.CreateTemp(c.dir, key.fileName()+".*"+cacheTempExt)
+	if err != nil {
+		return nil, errors.Wrap(err, "create entry")
+	}
+	defer func() {
+		if rerr != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	w := &cacheWriter{
+		cache: c,
+		key:   key,
+		file:  f,
+	}
+	// Header is written on commit.
+	if _, err := f.Write(make([]byte, cacheHeaderLen)); err != nil {
+		return nil, errors.Wrap(err, "write header")
+	}
+	if base != nil {
+		// Gzip members could be concatenated, so base records are copied as is.
+		n, err := io.Copy(f, io.NewSectionReader(base.file, cacheHeaderLen, base.size))
+		if err != nil {
+			return nil, errors.Wrap(err, "copy records")
+		}
+		w.size = n
+		w.last = base.header.until
+		w.newest = base.header.until
+	}
+	w.zw = gzip.NewWriter(&countingWriter{w: f, n: &w.size})
+	return w, nil
+}
+
+// cacheOrderMargin is a time before the newest record of running container which is not cached.
+//
+// Records of stdout and stderr are not strictly ordered, so a record of one stream
+// could be written to log after a bit newer record of the other one.
+const cacheOrderMargin = time.Second
+
+// recentRecord is an encoded record, which is not written yet.
+type recentRecord struct {
+	ts       otelstorage.Timestamp
+	complete bool
+	data     []byte
+}
+
+// Write writes record to the entry.
+//
+// Records read during cacheOrderMargin before the newest one are held back.
+func (w *cacheWriter) Write(r logstorage.Record) {
+	if w.err != nil {
+		return
+	}
+
+	w.recent = append(w.recent, recentRecord{
+		ts:       r.Timestamp,
+		complete: isLastChunk(r),
+		data:     appendCacheRecord(nil, r),
+	})
+	w.newest = max(w.newest, r.Timestamp)
+
+	bound := w.newest - min(w.newest, otelstorage.Timestamp(cacheOrderMargin))
+	n := 0
+	for n < len(w.recent) && w.recent[n].ts <= bound {
+		w.add(w.recent[n])
+		n++
+	}
+	w.recent = slices.Delete(w.recent, 0, n)
+}
+
+// drain writes held back records not after given timestamp and drops the rest.
+//
+// Dropped records are read again when entry is extended.
+func (w *cacheWriter) drain(until otelstorage.Timestamp) {
+	for _, r := range w.recent {
+		if r.ts <= until {
+			w.add(r)
+		}
+	}
+	w.recent = nil
+}
+
+func (w *cacheWriter) add(r recentRecord) {
+	if len(w.pending) == 0 && r.complete {
+		w.write(r.data, r.ts)
+		return
+	}
+
+	if len(w.pending) == 0 {
+		w.pendingSince, w.pendingLast = r.ts, r.ts
+	}
+	w.pending = append(w.pending, r.data...)
+	w.pendingSince = min(w.pendingSince, r.ts)
+	w.pendingLast = max(w.pendingLast, r.ts)
+	if len(w.pending) > maxHeldSize {
+		// Message is returned as is, if too many records are held back, see partialIter.
+		w.flushPending()
+	}
+}
+
+// flushPending writes pending records.
+func (w *cacheWriter) flushPending() {
+	if len(w.pending) == 0 {
+		return
+	}
+	w.write(w.pending, w.pendingLast)
+	w.pending = nil
+}
+
+func (w *cacheWriter) write(buf []byte, last otelstorage.Timestamp) {
+	if w.err != nil {
+		return
+	}
+	if _, err := w.zw.Write(buf); err != nil {
+		w.err = errors.Wrap(err, "write record")
+		return
+	}
+	if w.size > w.cache.maxSize {
+		w.err = errCacheEntryTooBig
+		return
+	}
+	w.last = max(w.last, last)
+}
+
+func appendCacheRecord(buf []byte, r logstorage.Record) []byte {
+	var typ stdType
+	if v, ok := r.Attrs.AsMap().Get(streamLabel); ok && v.Str() == stderr.String() {
+		typ = stderr
+	} else {
+		typ = stdout
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(r.Timestamp))
+	buf = append(buf, byte(typ))
+	buf = binary.AppendUvarint(buf, uint64(len(r.Body)))
+	buf = append(buf, r.Body...)
+	return buf
+}
+
+// Commit replaces existing entry with written one.
+//
+// Existing entry is kept, if it has records not written to the new one, e.g. if it is
+// extended by concurrent query. The check is not synchronized with other processes,
+// see Cache.
+//
+// Pending records are written only if entry is complete.
+func (w *cacheWriter) Commit(h cacheHeader) (rerr error) {
+	defer func() {
+		if rerr != nil {
+			w.Abort()
+		}
+	}()
+	if h.finished != 0 {
+		w.flushPending()
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.zw.Close(); err != nil {
+		return errors.Wrap(err, "flush records")
+	}
+	if _, err := w.file.WriteAt(h.encode(), 0); err != nil {
+		return errors.Wrap(err, "write header")
+	}
+	if err := w.file.Close(); err != nil {
+		return errors.Wrap(err, "close entry")
+	}
+
+	path := filepath.Join(w.cache.dir, w.key.fileName())
+	w.cache.commitMux.Lock()
+	defer w.cache.commitMux.Unlock()
+
+	if old, err := readCacheHeader(path); err == nil && !h.replaces(old) {
+		w.Abort()
+		return nil
+	}
+	if err := os.Rename(w.file.Name(), path); err != nil {
+		return errors.Wrap(err, "rename entry")
+	}
+	return w.cache.evict()
+}
+
+// Abort removes written entry.
+func (w *cacheWriter) Abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
+
+// cachingIter writes records read from Docker API to cache entry.
+//
+// Entry is committed only if log is read completely.
+type cachingIter struct {
+	ctx  context.Context
+	iter logiter
+	w    *cacheWriter
+	// header returns header of entry with written records.
+	header func(w *cacheWriter) (cacheHeader, bool)
+	done   bool
+}
+
+var _ logiter = (*cachingIter)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *cachingIter) Next(r *logstorage.Record) bool {
+	if !i.iter.Next(r) {
+		i.finish()
+		return false
+	}
+	i.w.Write(*r)
+	return true
+}
+
+func (i *cachingIter) finish() {
+	if i.done {
+		return
+	}
+	i.done = true
+
+	h, ok := i.header(i.w)
+	if !ok || i.iter.Err() != nil {
+		i.w.Abort()
+		return
+	}
+	if err := i.w.Commit(h); err != nil && !errors.Is(err, errCacheEntryTooBig) {
+		logqlengine.AddWarning(i.ctx, fmt.Sprintf("cannot cache container %q log: %s", i.w.key.id, err))
+	}
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *cachingIter) Err() error {
+	return i.iter.Err()
+}
+
+// Close closes iterator.
+func (i *cachingIter) Close() error {
+	if !i.done {
+		// Log is not read completely.
+		i.done = true
+		i.w.Abort()
+	}
+	return i.iter.Close()
+}
+
+// openCachedLog reads container log from cache, querying Docker API only for records which are not cached.
+//
+// If log is reopened, records missing in cache are not cached: entry is keyed
+// by start of the range, but reopened log is read since resume position.
+func (q *Querier) openCachedLog(ctx context.Context, ctr container, start, end otelstorage.Timestamp, tail int, reopen bool) (logiter, error) {
+	// Container has no records before creation.
+	since := max(start, ctr.created)
+
+	cached, err := q.cache.lookup(ctr, since, end)
+	if err == nil {
+		h := cached.header
+		switch {
+		case h.covers(ctr, since, end):
+			return cached.records(since, end, ctr.labels.AsResource()), nil
+		case tail == 0 && h.extends(since):
+			return q.extendCachedLog(ctx, ctr, cached, since, end)
+		}
+		_ = cached.Close()
+	}
+	// Entry is missing, corrupted or does not contain requested range.
+
+	if tail > 0 || reopen {
+		// Do not cache the newest records only or records since resume position.
+		return q.queryLog(ctx, ctr, start, end, tail)
+	}
+
+	key := cacheKey{id: ctr.ID, streams: ctr.streams, since: since}
+	w, err := q.cache.create(key, nil)
+	if err != nil {
+		logqlengine.AddWarning(ctx, fmt.Sprintf("cannot cache container %q log: %s", ctr.ID, err))
+		return q.queryLog(ctx, ctr, start, end, 0)
+	}
+	iter, err := q.queryLog(ctx, ctr, since, end, 0)
+	if err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return &cachingIter{
+		ctx:    ctx,
+		iter:   iter,
+		w:      w,
+		header: cacheHeaderFor(ctr, since, end),
+	}, nil
+}
+
+// extendCachedLog returns cached records followed by records written after cached range.
+func (q *Querier) extendCachedLog(ctx context.Context, ctr container, cached *cachedLog, since, end otelstorage.Timestamp) (logiter, error) {
+	var (
+		h     = cached.header
+		until = h.until + 1
+	)
+
+	w, err := q.cache.create(cached.key, cached)
+	if err != nil {
+		_ = cached.Close()
+		logqlengine.AddWarning(ctx, fmt.Sprintf("cannot cache container %q log: %s", ctr.ID, err))
+		return q.queryLog(ctx, ctr, since, end, 0)
+	}
+
+	suffix, err := q.queryLog(ctx, ctr, until, end, 0)
+	if err != nil {
+		w.Abort()
+		_ = cached.Close()
+		return nil, err
+	}
+
+	newHeader := cacheHeaderFor(ctr, h.since, end)
+	iter := cached.records(since, end, ctr.labels.AsResource())
+	iter.next = &cachingIter{
+		ctx:  ctx,
+		iter: suffix,
+		w:    w,
+		header: func(w *cacheWriter) (cacheHeader, bool) {
+			r, ok := newHeader(w)
+			// Do not rewrite entry, if nothing is changed.
+			return r, ok && (r.until > h.until || r.finished != h.finished)
+		},
+	}
+	return iter, nil
+}
+
+// cacheHeaderFor returns function to create header of entry with records read from since to end.
+//
+// Function writes held back records in range of the entry. It returns false,
+// if it is not known which records are read completely.
+func cacheHeaderFor(ctr container, since, end otelstorage.Timestamp) func(w *cacheWriter) (cacheHeader, bool) {
+	read := time.Now()
+	return func(w *cacheWriter) (h cacheHeader, _ bool) {
+		h.since = since
+		switch {
+		case ctr.finishedAt != 0 && (end == 0 || end >= ctr.finishedAt):
+			// Stopped container does not write logs, until it is restarted,
+			// so pending messages are complete.
+			w.drain(math.MaxUint64)
+			h.until = max(w.last, w.pendingLast, ctr.finishedAt)
+			h.finished = ctr.finishedAt
+			return h, h.until >= since
+		case ctr.finishedAt != 0 && end != 0:
+			h.until = end
+		default:
+			// Records could be written after the newest one, and records of
+			// the other stream could be written a bit before it.
+			h.until = w.newest - min(w.newest, otelstorage.Timestamp(cacheOrderMargin))
+			if end != 0 && end.AsTime().Before(read.Add(-cacheOrderMargin)) {
+				// Records of the range are written before the log is read.
+				h.until = max(h.until, end)
+			}
+		}
+		w.drain(h.until)
+		if len(w.pending) > 0 {
+			// Rest of incomplete message is not read.
+			h.until = min(h.until, w.pendingSince-1)
+		}
+		// Written records must be in range, otherwise they would be read again on extension.
+		return h, h.until >= since && w.last <= h.until
+	}
+}
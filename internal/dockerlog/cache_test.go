@@ -0,0 +1,469 @@
+package dockerlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	apicontainer "github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// queryRecorder records ContainerLogs and ContainerInspect calls.
+type queryRecorder struct {
+	*mockClient
+
+	mux     sync.Mutex
+	queries []apicontainer.LogsOptions
+	// inspected is a list of inspected container IDs.
+	inspected []string
+}
+
+func (c *queryRecorder) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	c.mux.Lock()
+	c.inspected = append(c.inspected, id)
+	c.mux.Unlock()
+	return c.mockClient.ContainerInspect(ctx, id)
+}
+
+// Inspected returns inspected container IDs and clears them.
+func (c *queryRecorder) Inspected() []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	r := c.inspected
+	c.inspected = nil
+	return r
+}
+
+func (c *queryRecorder) ContainerLogs(ctx context.Context, id string, opts apicontainer.LogsOptions) (io.ReadCloser, error) {
+	c.mux.Lock()
+	c.queries = append(c.queries, opts)
+	c.mux.Unlock()
+	return c.mockClient.ContainerLogs(ctx, id, opts)
+}
+
+// Reset returns recorded calls and clears them.
+func (c *queryRecorder) Reset() []apicontainer.LogsOptions {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	r := c.queries
+	c.queries = nil
+	return r
+}
+
+func readLines(t *testing.T, q *Querier, start, end time.Time) (lines []string) {
+	t.Helper()
+
+	toTimestamp := func(t time.Time) otelstorage.Timestamp {
+		if t.IsZero() {
+			return 0
+		}
+		return otelstorage.NewTimestampFromTime(t)
+	}
+
+	iter, err := q.SelectLogs(context.Background(), toTimestamp(start), toTimestamp(end), logqlengine.SelectLogsParams{})
+	require.NoError(t, err)
+	defer iter.Close()
+
+	require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+		stream, _ := r.Attrs.AsMap().Get("stream")
+		lines = append(lines, stream.Str()+": "+r.Body)
+		return nil
+	}))
+	return lines
+}
+
+func TestCacheStoppedContainer(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "exited", Created: ts.Unix() - 1},
+			},
+			logs: map[string][]logLine{
+				"1": {
+					{typ: stdout, ts: ts, line: "first\n"},
+					{typ: stderr, ts: ts.Add(time.Second), line: "second\n"},
+					{typ: stdout, ts: ts.Add(2 * time.Second), line: "third\n"},
+				},
+			},
+			finished: map[string]time.Time{
+				"1": ts.Add(3 * time.Second),
+			},
+		},
+	}
+
+	cache, err := OpenCache(t.TempDir(), CacheOptions{})
+	require.NoError(t, err)
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+
+	all := []string{"stdout: first\n", "stderr: second\n", "stdout: third\n"}
+	require.Equal(t, all, readLines(t, q, time.Time{}, time.Time{}))
+	require.Len(t, c.Reset(), 1)
+
+	entries, err := cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	require.Equal(t, "1", entry.ContainerID)
+	require.Equal(t, []string{"stdout", "stderr"}, entry.Streams)
+	require.True(t, entry.Complete)
+	require.Equal(t, otelstorage.NewTimestampFromTime(ts.Add(-time.Second)), entry.Since)
+
+	// Log is read from cache.
+	require.Equal(t, all, readLines(t, q, time.Time{}, time.Time{}))
+	require.Equal(t, []string{"stderr: second\n"}, readLines(t, q, ts.Add(time.Second), ts.Add(time.Second)))
+	require.Empty(t, c.Reset())
+
+	// Container is restarted and stopped again.
+	c.logs["1"] = append(c.logs["1"], logLine{typ: stdout, ts: ts.Add(time.Minute), line: "fourth\n"})
+	c.finished["1"] = ts.Add(time.Minute + time.Second)
+
+	require.Equal(t, append(all, "stdout: fourth\n"), readLines(t, q, time.Time{}, time.Time{}))
+	queries := c.Reset()
+	require.Len(t, queries, 1)
+	// Only records after the cached ones are queried.
+	since, _ := widenRange(otelstorage.NewTimestampFromTime(ts.Add(3*time.Second))+1, 0)
+	require.Equal(t, formatLogTime(since), queries[0].Since)
+
+	require.Equal(t, append(all, "stdout: fourth\n"), readLines(t, q, time.Time{}, time.Time{}))
+	require.Empty(t, c.Reset())
+
+	require.NoError(t, cache.Clear())
+	entries, err = cache.Entries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestCacheRunningContainer(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "running", Created: ts.Unix() - 1},
+			},
+			logs: map[string][]logLine{
+				"1": {
+					{typ: stdout, ts: ts, line: "first\n"},
+					{typ: stdout, ts: ts.Add(time.Second), line: "second\n"},
+				},
+			},
+		},
+	}
+
+	cache, err := OpenCache(t.TempDir(), CacheOptions{})
+	require.NoError(t, err)
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"stdout: first\n", "stdout: second\n"}, readLines(t, q, time.Time{}, time.Time{}))
+	require.Len(t, c.Reset(), 1)
+
+	entries, err := cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.False(t, entries[0].Complete)
+	// Records of the other stream could be written a bit before the newest one.
+	require.Equal(t, otelstorage.NewTimestampFromTime(ts), entries[0].Until)
+
+	// Range before the newest cached record is read from cache.
+	require.Equal(t, []string{"stdout: first\n"}, readLines(t, q, ts, ts))
+	require.Empty(t, c.Reset())
+
+	c.logs["1"] = append(c.logs["1"], logLine{typ: stdout, ts: ts.Add(2 * time.Second), line: "third\n"})
+	require.Equal(t, []string{"stdout: first\n", "stdout: second\n", "stdout: third\n"}, readLines(t, q, ts, time.Time{}))
+	queries := c.Reset()
+	require.Len(t, queries, 1)
+	since, _ := widenRange(otelstorage.NewTimestampFromTime(ts)+1, 0)
+	require.Equal(t, formatLogTime(since), queries[0].Since)
+
+	entries, err = cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, otelstorage.NewTimestampFromTime(ts.Add(-time.Second)), entries[0].Since)
+	require.Equal(t, otelstorage.NewTimestampFromTime(ts.Add(time.Second)), entries[0].Until)
+
+	// Range starts before the cached one.
+	require.Equal(t, []string{"stdout: first\n"}, readLines(t, q, ts.Add(-time.Hour), ts))
+	require.Empty(t, c.Reset())
+}
+
+func TestCacheStreamOrder(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "running", Created: ts.Unix() - 1},
+			},
+			logs: map[string][]logLine{
+				"1": {
+					{typ: stdout, ts: ts, line: "first\n"},
+					{typ: stdout, ts: ts.Add(time.Second), line: "second\n"},
+				},
+			},
+		},
+	}
+
+	cache, err := OpenCache(t.TempDir(), CacheOptions{})
+	require.NoError(t, err)
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"stdout: first\n", "stdout: second\n"}, readLines(t, q, time.Time{}, time.Time{}))
+	require.Len(t, c.Reset(), 1)
+
+	// Record of the other stream is written after the newer one.
+	c.logs["1"] = append(c.logs["1"], logLine{typ: stderr, ts: ts.Add(time.Second - time.Millisecond), line: "error\n"})
+	require.Equal(t,
+		[]string{"stdout: first\n", "stdout: second\n", "stderr: error\n"},
+		readLines(t, q, time.Time{}, time.Time{}),
+	)
+	require.Len(t, c.Reset(), 1)
+}
+
+func TestCacheIncompleteMessage(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "running", Created: ts.Unix() - 1},
+			},
+			logs: map[string][]logLine{
+				"1": {
+					{typ: stdout, ts: ts, line: "first\n"},
+					// Rest of the message is not written yet.
+					{typ: stdout, ts: ts.Add(time.Second), line: "long "},
+				},
+			},
+		},
+	}
+
+	cache, err := OpenCache(t.TempDir(), CacheOptions{})
+	require.NoError(t, err)
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"stdout: first\n", "stdout: long "}, readLines(t, q, time.Time{}, time.Time{}))
+	require.Len(t, c.Reset(), 1)
+
+	entries, err := cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, otelstorage.NewTimestampFromTime(ts), entries[0].Until)
+
+	// Docker uses timestamp of the first chunk for every chunk.
+	c.logs["1"] = append(c.logs["1"], logLine{typ: stdout, ts: ts.Add(time.Second), line: "line\n"})
+	require.Equal(t, []string{"stdout: first\n", "stdout: long line\n"}, readLines(t, q, time.Time{}, ts.Add(time.Second)))
+	require.Len(t, c.Reset(), 1)
+
+	require.Equal(t, []string{"stdout: first\n", "stdout: long line\n"}, readLines(t, q, time.Time{}, ts.Add(time.Second)))
+	require.Empty(t, c.Reset())
+}
+
+func TestCacheRanges(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "running", Created: ts.Unix() - 1},
+			},
+			logs: map[string][]logLine{
+				"1": {
+					{typ: stdout, ts: ts, line: "first\n"},
+					{typ: stdout, ts: ts.Add(time.Hour), line: "second\n"},
+					{typ: stdout, ts: ts.Add(2 * time.Hour), line: "third\n"},
+				},
+			},
+		},
+	}
+	ranges := []struct {
+		start, end time.Time
+		want       []string
+	}{
+		{ts.Add(2 * time.Hour), ts.Add(2 * time.Hour), []string{"stdout: third\n"}},
+		{ts, ts.Add(time.Hour), []string{"stdout: first\n", "stdout: second\n"}},
+	}
+
+	cache, err := OpenCache(t.TempDir(), CacheOptions{})
+	require.NoError(t, err)
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+
+	// Query ranges in parallel, like range splitter does.
+	var wg sync.WaitGroup
+	for _, r := range ranges {
+		r := r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.Equal(t, r.want, readLines(t, q, r.start, r.end))
+		}()
+	}
+	wg.Wait()
+	require.Len(t, c.Reset(), len(ranges))
+
+	// Non-overlapping entry does not replace another one.
+	for _, r := range ranges {
+		require.Equal(t, r.want, readLines(t, q, r.start, r.end))
+	}
+	require.Empty(t, c.Reset())
+
+	entries, err := cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Smaller entry does not replace larger one.
+	key := cacheKey{id: "1", streams: logStreams{stdout: true, stderr: true}, since: entries[0].Since}
+	w, err := cache.create(key, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Commit(cacheHeader{since: entries[0].Since, until: entries[0].Since}))
+
+	after, err := cache.Entries()
+	require.NoError(t, err)
+	require.ElementsMatch(t, entries, after)
+}
+
+func TestCacheEviction(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "exited", Created: ts.Unix()},
+				{ID: "2", Names: []string{"/db"}, State: "exited", Created: ts.Unix()},
+			},
+			logs: map[string][]logLine{
+				"1": {{typ: stdout, ts: ts, line: "api\n"}},
+				"2": {{typ: stdout, ts: ts.Add(time.Second), line: "db\n"}},
+			},
+			finished: map[string]time.Time{
+				"1": ts.Add(time.Minute),
+				"2": ts.Add(time.Minute),
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	cache, err := OpenCache(dir, CacheOptions{})
+	require.NoError(t, err)
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"stdout: api\n", "stdout: db\n"}, readLines(t, q, time.Time{}, time.Time{}))
+	entries, err := cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Entries being written are neither counted nor evicted, unless they are stale.
+	var (
+		writing = filepath.Join(dir, "3-stdout"+cacheExt+".1"+cacheTempExt)
+		stale   = filepath.Join(dir, "4-stdout"+cacheExt+".1"+cacheTempExt)
+	)
+	for _, name := range []string{writing, stale} {
+		require.NoError(t, os.WriteFile(name, make([]byte, entries[0].Size+entries[1].Size), 0o600))
+	}
+	staleTime := time.Now().Add(-staleEntryAge - time.Minute)
+	require.NoError(t, os.Chtimes(stale, staleTime, staleTime))
+
+	cache, err = OpenCache(dir, CacheOptions{MaxSize: entries[0].Size + entries[1].Size})
+	require.NoError(t, err)
+	require.NoError(t, cache.evict())
+	entries, err = cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.FileExists(t, writing)
+	require.NoFileExists(t, stale)
+
+	// Keep only one entry.
+	cache, err = OpenCache(dir, CacheOptions{MaxSize: entries[0].Size})
+	require.NoError(t, err)
+	require.NoError(t, cache.evict())
+	entries, err = cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.FileExists(t, writing)
+
+	// Entry exceeding the limit is not stored.
+	cache, err = OpenCache(t.TempDir(), CacheOptions{MaxSize: 1})
+	require.NoError(t, err)
+	q, err = NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"stdout: api\n", "stdout: db\n"}, readLines(t, q, time.Time{}, time.Time{}))
+	entries, err = cache.Entries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestCacheReopen(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	const records = 3 * readAheadSize
+
+	var (
+		logs = map[string][]logLine{}
+		want []string
+	)
+	for i := 0; i < records; i++ {
+		for _, id := range []string{"1", "2"} {
+			line := fmt.Sprintf("container %s record %d\n", id, i)
+			logs[id] = append(logs[id], logLine{typ: stdout, ts: ts.Add(time.Duration(i) * time.Second), line: line})
+			want = append(want, "stdout: "+line)
+		}
+	}
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "exited", Created: ts.Unix()},
+				{ID: "2", Names: []string{"/db"}, State: "exited", Created: ts.Unix()},
+			},
+			logs: logs,
+			finished: map[string]time.Time{
+				"1": ts.Add(time.Hour),
+				"2": ts.Add(time.Hour),
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	cache, err := OpenCache(dir, CacheOptions{})
+	require.NoError(t, err)
+	// Logs overlap, so they are closed and reopened to read within the limit.
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache, Concurrency: 1})
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, want, readLines(t, q, time.Time{}, time.Time{}))
+	require.Greater(t, len(c.Reset()), 2)
+
+	// Reopened logs are not cached since resume position.
+	entries, err := cache.Entries()
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.Equal(t, otelstorage.NewTimestampFromTime(ts), e.Since)
+	}
+	temp, err := filepath.Glob(filepath.Join(dir, "*"+cacheTempExt))
+	require.NoError(t, err)
+	require.Empty(t, temp)
+
+	// Cached entries are used by reopened logs.
+	q, err = NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache})
+	require.NoError(t, err)
+	require.ElementsMatch(t, want, readLines(t, q, time.Time{}, time.Time{}))
+	q, err = NewQuerier(c, Options{Source: LogSourceAPI, Cache: cache, Concurrency: 1})
+	require.NoError(t, err)
+	c.Reset()
+	require.ElementsMatch(t, want, readLines(t, q, time.Time{}, time.Time{}))
+	require.Empty(t, c.Reset())
+}
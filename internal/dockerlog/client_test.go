@@ -0,0 +1,208 @@
+package dockerlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	apicontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// mockClient is a fake Docker API client.
+//
+// Calling any method that is not overridden would panic.
+type mockClient struct {
+	client.APIClient
+
+	containers []types.Container
+	// logs is a map of container ID to log lines.
+	logs map[string][]logLine
+	// tty is a set of container IDs with TTY attached.
+	tty map[string]bool
+	// logFiles is a map of container ID to json-file log path.
+	logFiles map[string]string
+	// localDirs is a map of container ID to container directory with local log driver logs.
+	localDirs map[string]string
+	// finished is a map of container ID to time when container is finished.
+	finished map[string]time.Time
+	// events is a stream of Docker events.
+	events chan events.Message
+}
+
+type logLine struct {
+	typ  stdType
+	ts   time.Time
+	line string
+}
+
+// ContainerList returns containers matching list filters like Docker does.
+//
+// Filters which result depends on daemon state, like "ancestor", are not supported.
+func (c *mockClient) ContainerList(_ context.Context, opts apicontainer.ListOptions) (r []types.Container, _ error) {
+	args := opts.Filters
+	if err := args.Validate(map[string]bool{
+		"name":   true,
+		"id":     true,
+		"status": true,
+		"label":  true,
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, ctr := range c.containers {
+		if args.Contains("name") && !slices.ContainsFunc(ctr.Names, func(name string) bool {
+			return args.Match("name", name)
+		}) {
+			continue
+		}
+		if !args.FuzzyMatch("id", ctr.ID) ||
+			!args.ExactMatch("status", ctr.State) ||
+			!args.MatchKVList("label", ctr.Labels) {
+			continue
+		}
+		r = append(r, ctr)
+	}
+	return r, nil
+}
+
+func (c *mockClient) ContainerInspect(_ context.Context, id string) (types.ContainerJSON, error) {
+	var finishedAt string
+	if t, ok := c.finished[id]; ok {
+		finishedAt = t.Format(time.RFC3339Nano)
+	}
+	info := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: id,
+			State: &types.ContainerState{
+				FinishedAt: finishedAt,
+			},
+		},
+		Config: &apicontainer.Config{
+			Tty: c.tty[id],
+		},
+	}
+	if path, ok := c.logFiles[id]; ok {
+		info.LogPath = path
+		info.HostConfig = &apicontainer.HostConfig{
+			LogConfig: apicontainer.LogConfig{Type: "json-file"},
+		}
+	}
+	if dir, ok := c.localDirs[id]; ok {
+		info.HostnamePath = filepath.Join(dir, "hostname")
+		info.HostConfig = &apicontainer.HostConfig{
+			LogConfig: apicontainer.LogConfig{Type: "local"},
+		}
+	}
+	return info, nil
+}
+
+func (c *mockClient) ContainerLogs(ctx context.Context, id string, opts apicontainer.LogsOptions) (io.ReadCloser, error) {
+	lines, ok := c.logs[id]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %q", id)
+	}
+
+	if opts.Tail != "" && opts.Tail != "all" {
+		// Docker applies tail before other filters.
+		n, err := strconv.Atoi(opts.Tail)
+		if err != nil {
+			return nil, err
+		}
+		lines = lines[max(len(lines)-n, 0):]
+	}
+	since, err := parseLogTime(opts.Since)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseLogTime(opts.Until)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, l := range lines {
+		if (l.typ == stdout && !opts.ShowStdout) || (l.typ == stderr && !opts.ShowStderr) {
+			continue
+		}
+		if (!since.IsZero() && l.ts.Before(since)) || (!until.IsZero() && l.ts.After(until)) {
+			continue
+		}
+		data := l.ts.Format(time.RFC3339Nano) + " " + l.line
+		if c.tty[id] {
+			// TTY stream is not multiplexed.
+			buf.WriteString(data)
+			continue
+		}
+		writeFrame(&buf, l.typ, data)
+	}
+	if !opts.Follow {
+		return io.NopCloser(&buf), nil
+	}
+
+	// Keep stream open until request is canceled, like Docker does for running containers.
+	pr, pw := io.Pipe()
+	go func() {
+		if _, err := io.Copy(pw, &buf); err != nil {
+			return
+		}
+		<-ctx.Done()
+		_ = pw.CloseWithError(ctx.Err())
+	}()
+	return pr, nil
+}
+
+func (c *mockClient) Events(ctx context.Context, _ events.ListOptions) (<-chan events.Message, <-chan error) {
+	msgs := make(chan events.Message)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case msg := <-c.events:
+				select {
+				case <-ctx.Done():
+				case msgs <- msg:
+				}
+			}
+		}
+	}()
+	return msgs, errs
+}
+
+// parseLogTime parses since/until parameter formatted by formatLogTime.
+func parseLogTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	rawSec, rawNsec, _ := strings.Cut(s, ".")
+	sec, err := strconv.ParseInt(rawSec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec, err := strconv.ParseInt(rawNsec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// writeFrame writes multiplexed stream frame.
+func writeFrame(buf *bytes.Buffer, typ stdType, data string) {
+	var header [headerLen]byte
+	header[0] = byte(typ)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	buf.Write(header[:])
+	buf.WriteString(data)
+}
@@ -1,8 +1,10 @@
 package dockerlog
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -17,6 +19,10 @@ import (
 
 // ParseLog parses log stream from Docker daemon.
 func ParseLog(f io.ReadCloser, resource otelstorage.Attrs) iterators.Iterator[logstorage.Record] {
+	return newStreamIter(f, resource)
+}
+
+func newStreamIter(f io.ReadCloser, resource otelstorage.Attrs) *streamIter {
 	return &streamIter{
 		rd:       f,
 		err:      nil,
@@ -63,6 +69,22 @@ const (
 	systemerr
 )
 
+// String returns stream name.
+func (t stdType) String() string {
+	switch t {
+	case stdin:
+		return "stdin"
+	case stdout:
+		return "stdout"
+	case stderr:
+		return "stderr"
+	case systemerr:
+		return "systemerr"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
 func (i *streamIter) parseNext(r *logstorage.Record) (bool, error) {
 	if _, err := io.ReadFull(i.rd, i.header[:]); err != nil {
 		switch err {
@@ -92,7 +114,7 @@ func (i *streamIter) parseNext(r *logstorage.Record) (bool, error) {
 	return true, nil
 }
 
-func parseDockerLine(_ stdType, input string, r *logstorage.Record) error {
+func parseDockerLine(typ stdType, input string, r *logstorage.Record) error {
 	const dockerTimestampFormat = time.RFC3339Nano
 
 	rawTimestamp, line, ok := strings.Cut(input, " ")
@@ -107,6 +129,7 @@ func parseDockerLine(_ stdType, input string, r *logstorage.Record) error {
 	}
 	r.ObservedTimestamp = otelstorage.NewTimestampFromTime(ts)
 	r.Timestamp = r.ObservedTimestamp
+	r.Attrs.AsMap().PutStr(streamLabel, typ.String())
 	return nil
 }
 
@@ -119,3 +142,120 @@ func (i *streamIter) Err() error {
 func (i *streamIter) Close() error {
 	return i.rd.Close()
 }
+
+// ParseTTYLog parses log stream from Docker daemon of container with TTY attached.
+//
+// Such stream is not multiplexed, every line is written to stdout.
+func ParseTTYLog(f io.ReadCloser, resource otelstorage.Attrs) iterators.Iterator[logstorage.Record] {
+	return newTTYIter(f, resource)
+}
+
+func newTTYIter(f io.ReadCloser, resource otelstorage.Attrs) *ttyIter {
+	return &ttyIter{
+		rd:       f,
+		br:       bufio.NewReader(f),
+		err:      nil,
+		resource: resource,
+	}
+}
+
+type ttyIter struct {
+	rd  io.ReadCloser
+	br  *bufio.Reader
+	err error
+	// rest is a rest of the line following a partial record.
+	rest string
+
+	resource otelstorage.Attrs
+}
+
+var _ logiter = (*ttyIter)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *ttyIter) Next(r *logstorage.Record) (ok bool) {
+	// Reset record.
+	*r = logstorage.Record{
+		Attrs:         otelstorage.Attrs(pcommon.NewMap()),
+		ResourceAttrs: i.resource,
+	}
+
+	ok, i.err = i.parseNext(r)
+	return ok
+}
+
+func (i *ttyIter) parseNext(r *logstorage.Record) (bool, error) {
+	line := i.rest
+	i.rest = ""
+	if line == "" {
+		var err error
+		line, err = i.br.ReadString('\n')
+		switch {
+		case err == io.EOF:
+			if line == "" {
+				return false, nil
+			}
+			// Last line without newline.
+		case err != nil:
+			return false, errors.Wrap(err, "read line")
+		}
+	}
+	line, i.rest = splitTTYLine(line)
+
+	// TTY translates "\n" to "\r\n", normalize it.
+	if trimmed, ok := strings.CutSuffix(line, "\r\n"); ok {
+		line = trimmed + "\n"
+	}
+
+	if err := parseDockerLine(stdout, line, r); err != nil {
+		return false, errors.Wrap(err, "parse log line")
+	}
+	return true, nil
+}
+
+const (
+	// ttyChunkSize is a size of chunks Docker splits long lines into.
+	ttyChunkSize = 16 << 10
+	// maxTimestampLen is a maximum length of timestamp written by Docker.
+	maxTimestampLen = len("2006-01-02T15:04:05.000000000-07:00")
+)
+
+// splitTTYLine splits line into the first record and the rest of the line.
+//
+// Partial record has no trailing newline, so the next record is written
+// to the same line.
+func splitTTYLine(line string) (record, rest string) {
+	rawTimestamp, body, ok := strings.Cut(line, " ")
+	if !ok {
+		return line, ""
+	}
+	offset := len(rawTimestamp) + 1
+
+	// Docker assigns timestamp of the first chunk to every chunk of the message.
+	if idx := strings.Index(body, rawTimestamp+" "); idx > 0 {
+		return line[:offset+idx], line[offset+idx:]
+	}
+
+	// Older Docker versions assign the read time, but chunk size is fixed.
+	if len(body) <= ttyChunkSize {
+		return line, ""
+	}
+	next := body[ttyChunkSize:]
+	nextTimestamp, _, ok := strings.Cut(next[:min(len(next), maxTimestampLen+1)], " ")
+	if !ok {
+		return line, ""
+	}
+	if _, err := time.Parse(time.RFC3339Nano, nextTimestamp); err != nil {
+		return line, ""
+	}
+	return line[:offset+ttyChunkSize], line[offset+ttyChunkSize:]
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *ttyIter) Err() error {
+	return i.err
+}
+
+// Close closes iterator.
+func (i *ttyIter) Close() error {
+	return i.rd.Close()
+}
@@ -1,7 +1,9 @@
 package dockerlog
 
 import (
+	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -35,7 +37,92 @@ func TestParseLog(t *testing.T) {
 		require.Equal(t, expected[i].Timestamp, r.Timestamp)
 		require.Equal(t, expected[i].Timestamp, r.ObservedTimestamp)
 		require.Equal(t, expected[i].Body, r.Body)
+		// Registry writes logs to stderr.
+		stream, _ := r.Attrs.AsMap().Get("stream")
+		require.Equal(t, "stderr", stream.Str())
 		i++
 	}
 	require.NoError(t, iter.Err())
 }
+
+func TestParseTTYLog(t *testing.T) {
+	input := "2024-02-11T09:37:32.033031260Z $ ls\r\n" +
+		"2024-02-11T09:37:32.033058840Z bin  etc  usr\r\n" +
+		"2024-02-11T09:37:32.033079609Z \r\n" +
+		"2024-02-11T09:37:32.033097289Z $ "
+	iter := ParseTTYLog(io.NopCloser(strings.NewReader(input)), otelstorage.Attrs(pcommon.NewMap()))
+	defer iter.Close()
+
+	expected := []logstorage.Record{
+		{Timestamp: 1707644252033031260, Body: "$ ls\n"},
+		{Timestamp: 1707644252033058840, Body: "bin  etc  usr\n"},
+		{Timestamp: 1707644252033079609, Body: "\n"},
+		{Timestamp: 1707644252033097289, Body: "$ "},
+	}
+
+	var (
+		r   logstorage.Record
+		got []logstorage.Record
+	)
+	for iter.Next(&r) {
+		stream, _ := r.Attrs.AsMap().Get("stream")
+		require.Equal(t, "stdout", stream.Str())
+
+		got = append(got, logstorage.Record{
+			Timestamp: r.Timestamp,
+			Body:      r.Body,
+		})
+	}
+	require.NoError(t, iter.Err())
+	require.Equal(t, expected, got)
+}
+
+func TestParseTTYLogPartial(t *testing.T) {
+	var (
+		first  = strings.Repeat("a", ttyChunkSize)
+		second = strings.Repeat("b", ttyChunkSize)
+	)
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			"SameTimestamp",
+			"2024-02-11T09:37:32.033031260Z " + first +
+				"2024-02-11T09:37:32.033031260Z " + second +
+				"2024-02-11T09:37:32.033031260Z tail\r\n" +
+				"2024-02-11T09:37:32.033058840Z $ \r\n",
+			[]string{
+				"Feb 11 09:37:32.033031260 stdout: " + first + second + "tail\n",
+				"Feb 11 09:37:32.033058840 stdout: $ \n",
+			},
+		},
+		{
+			"ChunkTimestamp",
+			"2024-02-11T09:37:32.033031260Z " + first +
+				"2024-02-11T09:37:32.033031261Z " + second +
+				"2024-02-11T09:37:32.033031262Z tail\r\n" +
+				"2024-02-11T09:37:32.033058840Z $ \r\n",
+			[]string{
+				"Feb 11 09:37:32.033031260 stdout: " + first + second + "tail\n",
+				"Feb 11 09:37:32.033058840 stdout: $ \n",
+			},
+		},
+		{
+			"LongLine",
+			"2024-02-11T09:37:32.033031260Z " + first + "2024-02-11T09:37:32 " + second + "\r\n",
+			[]string{
+				"Feb 11 09:37:32.033031260 stdout: " + first + "2024-02-11T09:37:32 " + second + "\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iter := ParseTTYLog(io.NopCloser(strings.NewReader(tt.input)), otelstorage.Attrs(pcommon.NewMap()))
+			require.Equal(t, tt.want, readRecords(t, newPartialIter(iter, 0, 0)))
+		})
+	}
+}
@@ -3,15 +3,23 @@ package dockerlog
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	apicontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/go-faster/errors"
 	"go.opentelemetry.io/collector/pdata/pcommon"
-	"golang.org/x/sync/errgroup"
+	"go.uber.org/multierr"
 
 	"github.com/tdakkota/docker-logql/internal/iterators"
 	"github.com/tdakkota/docker-logql/internal/logql"
@@ -24,13 +32,100 @@ type logiter = iterators.Iterator[logstorage.Record]
 
 // Querier implements LogQL querier.
 type Querier struct {
-	client client.APIClient
+	client      client.APIClient
+	source      LogSource
+	multiline   *MultilineOptions
+	concurrency int
+	strict      bool
+	cache       *Cache
+}
+
+// LogSource defines where Querier reads container logs from.
+type LogSource string
+
+const (
+	// LogSourceAuto reads log files, if they are accessible, and uses Docker API otherwise.
+	LogSourceAuto LogSource = "auto"
+	// LogSourceAPI reads logs using Docker API.
+	LogSourceAPI LogSource = "api"
+	// LogSourceFile reads log files of json-file and local log drivers directly.
+	//
+	// Querier fails if log file is not accessible.
+	LogSourceFile LogSource = "file"
+)
+
+// Options defines Querier options.
+type Options struct {
+	// Source defines where to read container logs from.
+	//
+	// Defaults to LogSourceAuto.
+	Source LogSource
+	// Multiline defines multiline grouping options.
+	//
+	// If nil, grouping is disabled.
+	Multiline *MultilineOptions
+	// Concurrency is a maximum number of container logs opened at once.
+	//
+	// If more logs overlap, logs which records are needed last are closed
+	// and reopened later, keeping a few records read ahead.
+	//
+	// Defaults to 16.
+	Concurrency int
+	// Strict fails the query, if log of some container cannot be read.
+	//
+	// Otherwise, such container is skipped and warning is reported using [logqlengine.AddWarning].
+	Strict bool
+	// Cache stores container logs read using Docker API.
+	//
+	// If nil, logs are not cached.
+	Cache *Cache
+}
+
+func (o *Options) setDefaults() {
+	if o.Source == "" {
+		o.Source = LogSourceAuto
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = 16
+	}
+	if o.Multiline != nil {
+		m := *o.Multiline
+		m.setDefaults()
+		o.Multiline = &m
+	}
+}
+
+func (o Options) validate() error {
+	switch o.Source {
+	case LogSourceAuto, LogSourceAPI, LogSourceFile:
+	default:
+		return errors.Errorf("unknown log source %q", o.Source)
+	}
+	if o.Concurrency < 0 {
+		return errors.Errorf("invalid concurrency %d", o.Concurrency)
+	}
+	if o.Multiline != nil {
+		if err := o.Multiline.validate(); err != nil {
+			return errors.Wrap(err, "multiline")
+		}
+	}
+	return nil
 }
 
 // NewQuerier creates new Querier.
-func NewQuerier(c client.APIClient) (*Querier, error) {
+func NewQuerier(c client.APIClient, opts Options) (*Querier, error) {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
 	return &Querier{
-		client: c,
+		client:      c,
+		source:      opts.Source,
+		multiline:   opts.Multiline,
+		concurrency: opts.Concurrency,
+		strict:      opts.Strict,
+		cache:       opts.Cache,
 	}, nil
 }
 
@@ -44,81 +139,277 @@ func (q *Querier) Capabilities() (caps logqlengine.QuerierCapabilities) {
 }
 
 // SelectLogs selects log records from storage.
+//
+// Container logs are opened lazily, when merge reaches container start,
+// at most Options.Concurrency logs are opened at once.
+// Canceling the context or closing the iterator stops reading every log.
 func (q *Querier) SelectLogs(ctx context.Context, start, end otelstorage.Timestamp, params logqlengine.SelectLogsParams) (_ iterators.Iterator[logstorage.Record], rerr error) {
-	containers, err := q.fetchContainers(ctx, params)
+	containers, err := q.fetchContainers(ctx, start, end, params)
 	if err != nil {
 		return nil, errors.Wrap(err, "fetch containers")
 	}
-	switch len(containers) {
-	case 0:
+	if len(containers) == 0 {
 		return iterators.Empty[logstorage.Record](), nil
-	case 1:
-		return q.openLog(ctx, containers[0], start, end)
-	default:
-		iters := make([]logiter, len(containers))
-		defer func() {
-			// Close all iterators in case of error.
-			if rerr != nil {
-				for _, iter := range iters {
-					if iter == nil {
-						continue
-					}
-					_ = iter.Close()
-				}
-			}
-		}()
-
-		// FIXME(tdakkota): errgroup cancels group context
-		// when Wait is done.
-		//
-		// It cancels request to Docker daemon, so we use query context to avoid this.
-		// As a result, openLog context would not be canceled in case of error.
-		var grp errgroup.Group
-		for idx, ctr := range containers {
-			ctr := ctr
-			grp.Go(func() error {
-				iter, err := q.openLog(ctx, ctr, start, end)
+	}
+
+	logs := make([]lazyLog, len(containers))
+	for idx, ctr := range containers {
+		ctr := ctr
+		logs[idx] = lazyLog{
+			since: max(start, ctr.created),
+			open: func(ctx context.Context, resume otelstorage.Timestamp) (logiter, error) {
+				iter, err := q.openLog(ctx, ctr, start, end, params.Tail, resume)
 				if err != nil {
-					return errors.Wrapf(err, "open container %q log", ctr.ID)
+					if err := q.skipContainer(ctx, ctr, err); err != nil {
+						return nil, errors.Wrapf(err, "open container %q log", ctr.ID)
+					}
+					return iterators.Empty[logstorage.Record](), nil
 				}
-				iters[idx] = iter
-				return nil
-			})
+				return iter, nil
+			},
 		}
-		if err := grp.Wait(); err != nil {
-			return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	iter := newLazyMergeIter(ctx, cancel, logs, q.concurrency)
+	// Open the first logs to return an error early.
+	if !iter.init() {
+		err := iter.Err()
+		_ = iter.Close()
+		return nil, err
+	}
+	return iter, nil
+}
+
+// skipContainer reports a warning about container which log cannot be read.
+//
+// Returns given error, if querier is strict or the query is canceled.
+func (q *Querier) skipContainer(ctx context.Context, ctr container, err error) error {
+	if q.strict || ctx.Err() != nil {
+		return err
+	}
+	logqlengine.AddWarning(ctx, fmt.Sprintf("container %q (%s) is skipped: %s", ctr.Name(), ctr.ID, err))
+	return nil
+}
+
+// openLog opens container log.
+//
+// If resume is not zero, log is reopened to continue reading since resume, see lazyLog.
+func (q *Querier) openLog(ctx context.Context, ctr container, start, end otelstorage.Timestamp, tail int, resume otelstorage.Timestamp) (logiter, error) {
+	if q.multiline != nil {
+		// Entry could start before resume position, so grouped log is read
+		// since range start again and already read records are skipped.
+		resume = 0
+	}
+	if resume != 0 {
+		// Tail is a suffix of log, so every record after resume position is in it.
+		start, tail = resume, 0
+	}
+	tail = q.tailLines(ctr, end, tail)
+	// Docker reads log files backwards to get the newest lines, so prefer API.
+	if q.source == LogSourceFile || (q.source == LogSourceAuto && tail == 0) {
+		iter, err := openLogFile(ctr, start, end)
+		switch {
+		case err == nil:
+			return q.groupLines(newPartialIter(iter, start, end)), nil
+		case q.source == LogSourceAuto && isNoLogFile(err):
+			// Log file is not accessible, fallback to API.
+		default:
+			return nil, errors.Wrap(err, "open log file")
 		}
-		return newMergeIter(iters), nil
 	}
+
+	var (
+		iter logiter
+		err  error
+	)
+	if q.cache != nil {
+		iter, err = q.openCachedLog(ctx, ctr, start, end, tail, resume != 0)
+	} else {
+		iter, err = q.queryLog(ctx, ctr, start, end, tail)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q.groupLines(iter), nil
+}
+
+// queryLog reads container log using Docker API.
+func (q *Querier) queryLog(ctx context.Context, ctr container, start, end otelstorage.Timestamp, tail int) (logiter, error) {
+	if tail > 0 && end != 0 && !ctr.finished {
+		return q.queryTail(ctx, ctr, start, end, tail)
+	}
+	return q.requestLog(ctx, ctr, start, end, tail)
 }
 
-func (q *Querier) openLog(ctx context.Context, ctr container, start, end otelstorage.Timestamp) (logiter, error) {
-	var since, until string
-	if t := start.AsTime(); !t.IsZero() {
-		since = strconv.FormatInt(t.Unix(), 10)
+// queryTail reads the newest records of container log, which could write records after range end.
+//
+// Docker applies tail before until filter, so records written after range end
+// take tail slots. If fewer records in range are returned, the whole range is queried.
+func (q *Querier) queryTail(ctx context.Context, ctr container, start, end otelstorage.Timestamp, tail int) (logiter, error) {
+	iter, err := q.requestLog(ctx, ctr, start, end, tail)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []logstorage.Record
+	err = iterators.ForEach(iter, func(r logstorage.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err := multierr.Append(err, iter.Close()); err != nil {
+		return nil, errors.Wrap(err, "read tail")
 	}
-	if t := end.AsTime(); !t.IsZero() {
-		until = strconv.FormatInt(t.Unix(), 10)
+	if len(records) >= tail {
+		return iterators.Slice(records), nil
 	}
+	return q.requestLog(ctx, ctr, start, end, 0)
+}
 
+// requestLog requests container log using Docker API.
+//
+// Range is requested with partialMargin to reassemble partial messages crossing range boundaries.
+func (q *Querier) requestLog(ctx context.Context, ctr container, start, end otelstorage.Timestamp, tail int) (logiter, error) {
+	since, until := widenRange(start, end)
 	rc, err := q.client.ContainerLogs(ctx, ctr.ID, apicontainer.LogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Since:      since,
-		Until:      until,
+		ShowStdout: ctr.streams.stdout,
+		ShowStderr: ctr.streams.stderr,
+		Since:      formatLogTime(since),
+		Until:      formatLogTime(until),
 		Timestamps: true,
-		Tail:       "all",
+		Tail:       formatTail(tail),
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "query logs")
 	}
-	return ParseLog(rc, ctr.labels.AsResource()), nil
+	return ctr.parseLog(rc, start, end), nil
+}
+
+// tailEndMargin is a maximum age of range end to try reading the newest lines.
+const tailEndMargin = 10 * time.Second
+
+// tailLines returns number of the newest lines to request, or zero to read the whole range.
+func (q *Querier) tailLines(ctr container, end otelstorage.Timestamp, tail int) int {
+	switch {
+	case tail <= 0:
+		return 0
+	case q.multiline != nil:
+		// Grouping joins lines, so tail would return fewer entries.
+		return 0
+	case !ctr.streams.stdout || (!ctr.streams.stderr && !ctr.tty):
+		// Docker applies tail before stream filter.
+		return 0
+	case end != 0 && !ctr.finished && end.AsTime().Before(time.Now().Add(-tailEndMargin)):
+		// Docker applies tail before until filter, so records written
+		// after range end would take every tail slot.
+		return 0
+	default:
+		return tail
+	}
+}
+
+// formatTail formats number of lines for ContainerLogs tail parameter.
+func formatTail(tail int) string {
+	if tail <= 0 {
+		return "all"
+	}
+	return strconv.Itoa(tail)
+}
+
+// groupLines applies multiline grouping to container log, if enabled.
+func (q *Querier) groupLines(iter logiter) logiter {
+	if q.multiline == nil {
+		return iter
+	}
+	return newMultilineIter(iter, *q.multiline)
+}
+
+// errNoLogFile is returned when container log driver does not write log files.
+var errNoLogFile = errors.New("no log file")
+
+func isNoLogFile(err error) bool {
+	return errors.Is(err, errNoLogFile) ||
+		errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, fs.ErrPermission)
+}
+
+// openLogFile opens container log file directly, if plugin runs on the daemon host.
+func openLogFile(ctr container, start, end otelstorage.Timestamp) (logiter, error) {
+	opts := fileLogOptions{
+		start:    start,
+		end:      end,
+		streams:  ctr.streams,
+		tty:      ctr.tty,
+		resource: ctr.labels.AsResource(),
+	}
+	if ctr.logPath == "" {
+		return nil, errors.Wrapf(errNoLogFile, "log driver %q", ctr.logDriver)
+	}
+
+	switch ctr.logDriver {
+	case "json-file":
+		return openJSONFileLog(ctr.logPath, opts)
+	case "local":
+		return openLocalLog(ctr.logPath, opts)
+	default:
+		return nil, errors.Wrapf(errNoLogFile, "log driver %q", ctr.logDriver)
+	}
+}
+
+// formatLogTime formats timestamp for ContainerLogs since/until parameters.
+//
+// Docker accepts fractional Unix timestamps with nanosecond precision.
+// Returns empty string, if timestamp is zero.
+func formatLogTime(ts otelstorage.Timestamp) string {
+	if ts == 0 {
+		return ""
+	}
+	sec, nsec := uint64(ts)/uint64(time.Second), uint64(ts)%uint64(time.Second)
+	return fmt.Sprintf("%d.%09d", sec, nsec)
 }
 
-func (q *Querier) fetchContainers(ctx context.Context, params logqlengine.SelectLogsParams) (r []container, _ error) {
+// partialMargin is a time to read before range start and after range end
+// to get every chunk of partial messages crossing range boundaries.
+//
+// Docker assigns timestamp of the first chunk to every chunk of message,
+// older versions assign the read time, so chunks are written close to each other.
+const partialMargin = time.Second
+
+// widenRange extends non-zero range boundaries by partialMargin.
+func widenRange(start, end otelstorage.Timestamp) (otelstorage.Timestamp, otelstorage.Timestamp) {
+	margin := otelstorage.Timestamp(partialMargin)
+	if start != 0 {
+		start = max(start, margin+1) - margin
+	}
+	if end != 0 {
+		end += margin
+	}
+	return start, end
+}
+
+// inRange returns true, if timestamp is in [start, end] range.
+//
+// Zero start or end means unbounded range.
+func inRange(ts, start, end otelstorage.Timestamp) bool {
+	return (start == 0 || ts >= start) &&
+		(end == 0 || ts <= end)
+}
+
+func (q *Querier) fetchContainers(ctx context.Context, start, end otelstorage.Timestamp, params logqlengine.SelectLogsParams) ([]container, error) {
+	return q.listContainers(ctx, start, end, params.Labels)
+}
+
+// listContainers returns containers matching given matchers that could write logs in given time range.
+func (q *Querier) listContainers(ctx context.Context, start, end otelstorage.Timestamp, matchers []logql.LabelMatcher) (r []container, _ error) {
+	matchers, streams := selectStreams(matchers)
+	if !streams.stdout && !streams.stderr {
+		// Selector does not match any stream.
+		return nil, nil
+	}
+
 	containers, err := q.client.ContainerList(ctx, apicontainer.ListOptions{
-		All: true,
-		// TODO(tdakkota): convert select params to label matchers.
+		All:     true,
+		Filters: listFilters(matchers),
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "query container list")
@@ -126,19 +417,241 @@ func (q *Querier) fetchContainers(ctx context.Context, params logqlengine.Select
 
 	for _, ctr := range containers {
 		set := getLabels(ctr)
-		if set.Match(params.Labels) {
-			r = append(r, container{
-				ID:     ctr.ID,
-				labels: set,
-			})
+		if !set.Match(matchers) {
+			continue
+		}
+
+		if end != 0 && time.Unix(ctr.Created, 0).After(end.AsTime()) {
+			// Container created after range end.
+			continue
 		}
+
+		info, err := q.client.ContainerInspect(ctx, ctr.ID)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				// Container is removed.
+				continue
+			}
+			return nil, errors.Wrapf(err, "inspect container %q", ctr.ID)
+		}
+		if start != 0 && finishedBefore(ctr, info, start) {
+			// Container stopped before range start.
+			continue
+		}
+
+		c := container{
+			ID:         ctr.ID,
+			labels:     set,
+			streams:    streams,
+			created:    otelstorage.NewTimestampFromTime(time.Unix(ctr.Created, 0)),
+			finished:   end != 0 && finishedBefore(ctr, info, end),
+			finishedAt: finishedAt(ctr, info),
+		}
+		if info.ContainerJSONBase != nil {
+			c.logDriver, c.logPath = containerLogFile(info)
+		}
+		if info.Config != nil && info.Config.Tty {
+			// TTY merges stderr into stdout.
+			c.tty = true
+			c.streams.stderr = false
+			if !c.streams.stdout {
+				continue
+			}
+		}
+		r = append(r, c)
 	}
 	return r, nil
 }
 
+// containerLogFile returns container log driver and log file path, if driver writes logs to file.
+func containerLogFile(info types.ContainerJSON) (driver, path string) {
+	if info.HostConfig == nil {
+		return "", ""
+	}
+
+	driver = info.HostConfig.LogConfig.Type
+	switch driver {
+	case "json-file":
+		return driver, info.LogPath
+	case "local":
+		// Docker does not expose local log driver path, but it is stored in container directory.
+		if info.HostnamePath == "" {
+			return driver, ""
+		}
+		return driver, filepath.Join(filepath.Dir(info.HostnamePath), "local-logs", "container.log")
+	default:
+		return driver, ""
+	}
+}
+
+// finishedBefore whether container is stopped before given timestamp.
+func finishedBefore(ctr types.Container, info types.ContainerJSON, ts otelstorage.Timestamp) bool {
+	finished := finishedAt(ctr, info)
+	return finished != 0 && finished < ts
+}
+
+// finishedAt returns time when container is stopped, or zero, if container is alive.
+func finishedAt(ctr types.Container, info types.ContainerJSON) otelstorage.Timestamp {
+	switch ctr.State {
+	case "running", "paused", "restarting":
+		return 0
+	}
+	if info.ContainerJSONBase == nil || info.State == nil {
+		return 0
+	}
+
+	finished, err := time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+	if err != nil || finished.IsZero() {
+		// Container never finished or time is invalid, assume it is alive.
+		return 0
+	}
+	return otelstorage.NewTimestampFromTime(finished)
+}
+
+// containerStates is a set of container states accepted by "status" filter.
+var containerStates = map[string]struct{}{
+	"created":    {},
+	"restarting": {},
+	"running":    {},
+	"removing":   {},
+	"paused":     {},
+	"exited":     {},
+	"dead":       {},
+}
+
+// listFilters converts equality label matchers to container list filters.
+//
+// Filters may select more containers than matchers, so containers still should be matched.
+func listFilters(matchers []logql.LabelMatcher) filters.Args {
+	args := filters.NewArgs()
+	for _, m := range matchers {
+		if m.Op != logql.OpEq {
+			continue
+		}
+
+		switch label := string(m.Label); label {
+		case "container", "container_name":
+			// Name filter is a regular expression matching names with leading slash.
+			args.Add("name", "^/"+regexp.QuoteMeta(m.Value)+"$")
+		case "container_id":
+			// ID filter matches prefix.
+			args.Add("id", m.Value)
+		case "container_state":
+			if _, ok := containerStates[m.Value]; !ok {
+				// Daemon rejects unknown states.
+				continue
+			}
+			args.Add("status", m.Value)
+		default:
+			// Other container attributes have no filters, image is not pushed down
+			// as "ancestor" filter, since daemon resolves it using image store.
+			if strings.HasPrefix(label, "container_") {
+				continue
+			}
+			key, ok := dockerLabelKey(label)
+			if !ok {
+				continue
+			}
+			args.Add("label", key+"="+m.Value)
+		}
+	}
+	return args
+}
+
+// dockerLabelKey returns Docker label key for given LogQL label name, if it can be restored unambiguously.
+func dockerLabelKey(label string) (string, bool) {
+	const (
+		composePrefix      = "com.docker.compose."
+		composeLabelPrefix = "com_docker_compose_"
+	)
+	if suffix, ok := strings.CutPrefix(label, composeLabelPrefix); ok {
+		label = suffix
+		if strings.Contains(label, "_") {
+			return "", false
+		}
+		return composePrefix + label, true
+	}
+
+	// Label may be sanitized, if it contains an underscore.
+	if label == "" || strings.Contains(label, "_") {
+		return "", false
+	}
+	return label, true
+}
+
 type container struct {
-	ID     string
-	labels containerLabels
+	ID      string
+	labels  containerLabels
+	streams logStreams
+	// tty is true, if container has TTY attached, so its log stream is not multiplexed.
+	tty bool
+	// logDriver is a container log driver name.
+	logDriver string
+	// logPath is a path to container log file on the daemon host, if any.
+	logPath string
+	// created is a container creation time, container has no records before it.
+	created otelstorage.Timestamp
+	// finished is true, if container stopped before range end.
+	finished bool
+	// finishedAt is a time when container is stopped, zero if it is alive.
+	finishedAt otelstorage.Timestamp
+}
+
+// Name returns container name.
+func (c container) Name() string {
+	return c.labels.labels["container"]
+}
+
+// parseLog returns log parser for container log stream.
+//
+// Partial messages are reassembled, messages outside of given range are skipped.
+//
+// Docker API accepts since/until with nanosecond precision, but
+// messages are filtered again to return exactly requested range.
+func (c container) parseLog(rc io.ReadCloser, start, end otelstorage.Timestamp) logiter {
+	return newPartialIter(c.parseChunks(rc), start, end)
+}
+
+// parseChunks parses log stream without reassembling partial messages.
+func (c container) parseChunks(rc io.ReadCloser) logiter {
+	if c.tty {
+		return newTTYIter(rc, c.labels.AsResource())
+	}
+	return newStreamIter(rc, c.labels.AsResource())
+}
+
+// streamLabel is a name of record attribute containing output stream of the record.
+const streamLabel = "stream"
+
+// logStreams defines container output streams to read.
+type logStreams struct {
+	stdout bool
+	stderr bool
+}
+
+// Names returns names of selected streams.
+func (s logStreams) Names() (r []string) {
+	if s.stdout {
+		r = append(r, stdout.String())
+	}
+	if s.stderr {
+		r = append(r, stderr.String())
+	}
+	return r
+}
+
+// selectStreams evaluates stream label matchers and returns the rest of matchers.
+func selectStreams(matchers []logql.LabelMatcher) (rest []logql.LabelMatcher, streams logStreams) {
+	streams = logStreams{stdout: true, stderr: true}
+	for _, m := range matchers {
+		if m.Label != streamLabel {
+			rest = append(rest, m)
+			continue
+		}
+		streams.stdout = streams.stdout && match(m, stdout.String())
+		streams.stderr = streams.stderr && match(m, stderr.String())
+	}
+	return rest, streams
 }
 
 type containerLabels struct {
@@ -195,7 +708,7 @@ func match(m logql.LabelMatcher, s string) bool {
 	case logql.OpEq:
 		return s == m.Value
 	case logql.OpNotEq:
-		return s == m.Value
+		return s != m.Value
 	case logql.OpRe:
 		return m.Re.MatchString(s)
 	case logql.OpNotRe:
@@ -0,0 +1,476 @@
+package dockerlog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+func TestQuerierSelectLogsStream(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running"},
+		},
+		logs: map[string][]logLine{
+			"1": {
+				{typ: stdout, ts: ts, line: "request\n"},
+				{typ: stderr, ts: ts.Add(time.Second), line: "error\n"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		matchers []logql.LabelMatcher
+		want     []string
+	}{
+		{"All", nil, []string{"stdout: request\n", "stderr: error\n"}},
+		{
+			"Stdout",
+			[]logql.LabelMatcher{{Label: "stream", Op: logql.OpEq, Value: "stdout"}},
+			[]string{"stdout: request\n"},
+		},
+		{
+			"Stderr",
+			[]logql.LabelMatcher{{Label: "stream", Op: logql.OpEq, Value: "stderr"}},
+			[]string{"stderr: error\n"},
+		},
+		{
+			"None",
+			[]logql.LabelMatcher{{Label: "stream", Op: logql.OpEq, Value: "stdin"}},
+			nil,
+		},
+		{
+			"NotStderr",
+			[]logql.LabelMatcher{{Label: "stream", Op: logql.OpNotEq, Value: "stderr"}},
+			[]string{"stdout: request\n"},
+		},
+		{
+			"NotOtherContainer",
+			[]logql.LabelMatcher{{Label: "container", Op: logql.OpNotEq, Value: "db"}},
+			[]string{"stdout: request\n", "stderr: error\n"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q, err := NewQuerier(c, Options{})
+			require.NoError(t, err)
+
+			iter, err := q.SelectLogs(ctx, 0, 0, logqlengine.SelectLogsParams{
+				Labels: tt.matchers,
+			})
+			require.NoError(t, err)
+			defer iter.Close()
+
+			var got []string
+			require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+				stream, _ := r.Attrs.AsMap().Get("stream")
+				got = append(got, stream.Str()+": "+r.Body)
+				return nil
+			}))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQuerierSelectLogsTTY(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/shell"}, State: "running"},
+		},
+		logs: map[string][]logLine{
+			"1": {
+				{typ: stdout, ts: ts, line: "$ ls\r\n"},
+				{typ: stdout, ts: ts.Add(time.Second), line: "bin  etc  usr\r\n"},
+			},
+		},
+		tty: map[string]bool{"1": true},
+	}
+
+	tests := []struct {
+		name     string
+		matchers []logql.LabelMatcher
+		want     []string
+	}{
+		{"All", nil, []string{"stdout: $ ls\n", "stdout: bin  etc  usr\n"}},
+		{
+			"Stderr",
+			[]logql.LabelMatcher{{Label: "stream", Op: logql.OpEq, Value: "stderr"}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q, err := NewQuerier(c, Options{})
+			require.NoError(t, err)
+
+			iter, err := q.SelectLogs(ctx, 0, 0, logqlengine.SelectLogsParams{
+				Labels: tt.matchers,
+			})
+			require.NoError(t, err)
+			defer iter.Close()
+
+			var got []string
+			require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+				stream, _ := r.Attrs.AsMap().Get("stream")
+				got = append(got, stream.Str()+": "+r.Body)
+				return nil
+			}))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQuerierSelectLogsLifetime(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running", Created: ts.Unix()},
+			{ID: "2", Names: []string{"/ci-1"}, State: "exited", Created: ts.Unix()},
+			{ID: "3", Names: []string{"/ci-2"}, State: "exited", Created: ts.Add(2 * time.Hour).Unix()},
+		},
+		logs: map[string][]logLine{
+			"1": {{typ: stdout, ts: ts.Add(time.Hour), line: "api\n"}},
+			// Containers out of query range must not be opened.
+		},
+		finished: map[string]time.Time{
+			"2": ts.Add(time.Minute),
+			"3": ts.Add(3 * time.Hour),
+		},
+	}
+	q, err := NewQuerier(c, Options{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	iter, err := q.SelectLogs(ctx,
+		otelstorage.NewTimestampFromTime(ts.Add(30*time.Minute)),
+		otelstorage.NewTimestampFromTime(ts.Add(90*time.Minute)),
+		logqlengine.SelectLogsParams{},
+	)
+	require.NoError(t, err)
+	defer iter.Close()
+
+	var got []string
+	require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+		got = append(got, r.Body)
+		return nil
+	}))
+	require.Equal(t, []string{"api\n"}, got)
+}
+
+func TestQuerierSelectLogsRange(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	lines := []logLine{
+		{typ: stdout, ts: ts, line: "first\n"},
+		{typ: stdout, ts: ts.Add(500 * time.Millisecond), line: "second\n"},
+		{typ: stdout, ts: ts.Add(900*time.Millisecond + 1), line: "third\n"},
+	}
+	start := otelstorage.NewTimestampFromTime(ts.Add(time.Millisecond))
+	end := otelstorage.NewTimestampFromTime(ts.Add(900 * time.Millisecond))
+
+	for _, tty := range []bool{false, true} {
+		tty := tty
+		t.Run(fmt.Sprintf("TTY=%t", tty), func(t *testing.T) {
+			c := &mockClient{
+				containers: []types.Container{
+					{ID: "1", Names: []string{"/api"}, State: "running"},
+				},
+				logs: map[string][]logLine{"1": lines},
+				tty:  map[string]bool{"1": tty},
+			}
+			q, err := NewQuerier(c, Options{Source: LogSourceAPI})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			iter, err := q.SelectLogs(ctx, start, end, logqlengine.SelectLogsParams{})
+			require.NoError(t, err)
+			defer iter.Close()
+
+			var got []string
+			require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+				got = append(got, r.Body)
+				return nil
+			}))
+			require.Equal(t, []string{"second\n"}, got)
+		})
+	}
+}
+
+func TestQuerierSelectLogsTail(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	lines := []logLine{
+		{typ: stdout, ts: ts, line: "1\n"},
+		{typ: stderr, ts: ts.Add(time.Second), line: "2\n"},
+		{typ: stdout, ts: ts.Add(2 * time.Second), line: "3\n"},
+		{typ: stdout, ts: ts.Add(3 * time.Second), line: "4\n"},
+	}
+	past := otelstorage.NewTimestampFromTime(ts.Add(time.Minute))
+
+	tests := []struct {
+		name     string
+		state    string
+		end      otelstorage.Timestamp
+		matchers []logql.LabelMatcher
+		want     []string
+	}{
+		{"Now", "running", 0, nil, []string{"3\n", "4\n"}},
+		{"Past", "running", past, nil, []string{"1\n", "2\n", "3\n", "4\n"}},
+		{"Finished", "exited", past, nil, []string{"3\n", "4\n"}},
+		{
+			"Stream",
+			"running",
+			0,
+			[]logql.LabelMatcher{{Label: "stream", Op: logql.OpEq, Value: "stdout"}},
+			[]string{"1\n", "3\n", "4\n"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := &mockClient{
+				containers: []types.Container{
+					{ID: "1", Names: []string{"/api"}, State: tt.state},
+				},
+				logs:     map[string][]logLine{"1": lines},
+				finished: map[string]time.Time{"1": ts.Add(4 * time.Second)},
+			}
+			q, err := NewQuerier(c, Options{})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			iter, err := q.SelectLogs(ctx, 0, tt.end, logqlengine.SelectLogsParams{
+				Labels: tt.matchers,
+				Tail:   2,
+			})
+			require.NoError(t, err)
+			defer iter.Close()
+
+			var got []string
+			require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+				got = append(got, r.Body)
+				return nil
+			}))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQuerierSelectLogsTailAfterEnd(t *testing.T) {
+	// Range end is close to now, so tail is tried.
+	now := time.Now().UTC()
+	lines := []logLine{
+		{typ: stdout, ts: now.Add(-5 * time.Second), line: "1\n"},
+		{typ: stdout, ts: now.Add(-4 * time.Second), line: "2\n"},
+		{typ: stdout, ts: now.Add(-3 * time.Second), line: "3\n"},
+		{typ: stdout, ts: now.Add(-2 * time.Second), line: "4\n"},
+		{typ: stdout, ts: now.Add(-time.Second), line: "5\n"},
+	}
+
+	tests := []struct {
+		name  string
+		end   time.Time
+		want  []string
+		tails []string
+	}{
+		{"InRange", now, []string{"4\n", "5\n"}, []string{"2"}},
+		// Records after range end take tail slots, so the whole range is queried.
+		{"AfterEnd", now.Add(-2500 * time.Millisecond), []string{"1\n", "2\n", "3\n"}, []string{"2", "all"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := &queryRecorder{
+				mockClient: &mockClient{
+					containers: []types.Container{
+						{ID: "1", Names: []string{"/api"}, State: "running"},
+					},
+					logs: map[string][]logLine{"1": lines},
+				},
+			}
+			q, err := NewQuerier(c, Options{Source: LogSourceAPI})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			iter, err := q.SelectLogs(ctx, 0, otelstorage.NewTimestampFromTime(tt.end), logqlengine.SelectLogsParams{
+				Tail: 2,
+			})
+			require.NoError(t, err)
+			defer iter.Close()
+
+			var got []string
+			require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+				got = append(got, r.Body)
+				return nil
+			}))
+			require.Equal(t, tt.want, got)
+
+			var (
+				_, until = widenRange(0, otelstorage.NewTimestampFromTime(tt.end))
+				tails    []string
+			)
+			for _, opts := range c.Reset() {
+				require.Equal(t, formatLogTime(until), opts.Until)
+				tails = append(tails, opts.Tail)
+			}
+			require.Equal(t, tt.tails, tails)
+		})
+	}
+}
+
+func TestQuerierSelectLogsSkip(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running"},
+			// Container without logs, e.g. with "none" log driver.
+			{ID: "2", Names: []string{"/db"}, State: "running"},
+		},
+		logs: map[string][]logLine{
+			"1": {{typ: stdout, ts: ts, line: "request\n"}},
+		},
+	}
+
+	t.Run("Skip", func(t *testing.T) {
+		q, err := NewQuerier(c, Options{})
+		require.NoError(t, err)
+
+		var warnings logqlengine.Warnings
+		ctx := logqlengine.WithWarnings(context.Background(), &warnings)
+		iter, err := q.SelectLogs(ctx, 0, 0, logqlengine.SelectLogsParams{})
+		require.NoError(t, err)
+		defer iter.Close()
+
+		var got []string
+		require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+			got = append(got, r.Body)
+			return nil
+		}))
+		require.Equal(t, []string{"request\n"}, got)
+
+		list := warnings.List()
+		require.Len(t, list, 1)
+		require.Contains(t, list[0], `container "db" (2) is skipped`)
+	})
+	t.Run("Strict", func(t *testing.T) {
+		q, err := NewQuerier(c, Options{Strict: true})
+		require.NoError(t, err)
+
+		var warnings logqlengine.Warnings
+		ctx := logqlengine.WithWarnings(context.Background(), &warnings)
+		_, err = q.SelectLogs(ctx, 0, 0, logqlengine.SelectLogsParams{})
+		require.ErrorContains(t, err, `open container "2" log`)
+		require.Empty(t, warnings.List())
+	})
+}
+
+func TestFormatLogTime(t *testing.T) {
+	tests := []struct {
+		ts   otelstorage.Timestamp
+		want string
+	}{
+		{0, ""},
+		{otelstorage.NewTimestampFromTime(time.Unix(1700000000, 0)), "1700000000.000000000"},
+		{otelstorage.NewTimestampFromTime(time.Unix(1700000000, 123456789)), "1700000000.123456789"},
+		{otelstorage.NewTimestampFromTime(time.Unix(1700000000, 1)), "1700000000.000000001"},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			require.Equal(t, tt.want, formatLogTime(tt.ts))
+		})
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	tests := []struct {
+		matchers []logql.LabelMatcher
+		want     filters.Args
+	}{
+		{nil, filters.NewArgs()},
+		{
+			[]logql.LabelMatcher{
+				{Label: "container", Op: logql.OpEq, Value: "api.1"},
+				{Label: "container_id", Op: logql.OpEq, Value: "deadbeef"},
+				{Label: "container_state", Op: logql.OpEq, Value: "running"},
+			},
+			filters.NewArgs(
+				filters.Arg("name", `^/api\.1$`),
+				filters.Arg("id", "deadbeef"),
+				filters.Arg("status", "running"),
+			),
+		},
+		{
+			[]logql.LabelMatcher{
+				{Label: "app", Op: logql.OpEq, Value: "api"},
+				{Label: "com_docker_compose_project", Op: logql.OpEq, Value: "shop"},
+			},
+			filters.NewArgs(
+				filters.Arg("label", "app=api"),
+				filters.Arg("label", "com.docker.compose.project=shop"),
+			),
+		},
+		{
+			// Matchers that could not be converted.
+			[]logql.LabelMatcher{
+				{Label: "container", Op: logql.OpNotEq, Value: "api"},
+				{Label: "container_state", Op: logql.OpEq, Value: "unknown"},
+				{Label: "container_command", Op: logql.OpEq, Value: "sh"},
+				{Label: "container_image", Op: logql.OpEq, Value: "api:latest"},
+				{Label: "container_image_id", Op: logql.OpEq, Value: "sha256:deadbeef"},
+				{Label: "com_docker_compose_config_hash", Op: logql.OpEq, Value: "abc"},
+				{Label: "org_opencontainers_image_title", Op: logql.OpEq, Value: "api"},
+			},
+			filters.NewArgs(),
+		},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			require.Equal(t, tt.want, listFilters(tt.matchers))
+		})
+	}
+}
+
+func TestContainerLabelsMatch(t *testing.T) {
+	set := getLabels(types.Container{
+		ID:    "1",
+		Names: []string{"/api"},
+		State: "running",
+	})
+
+	for i, tt := range []struct {
+		matcher logql.LabelMatcher
+		want    bool
+	}{
+		{logql.LabelMatcher{Label: "container", Op: logql.OpEq, Value: "api"}, true},
+		{logql.LabelMatcher{Label: "container", Op: logql.OpEq, Value: "db"}, false},
+		{logql.LabelMatcher{Label: "container", Op: logql.OpNotEq, Value: "api"}, false},
+		{logql.LabelMatcher{Label: "container", Op: logql.OpNotEq, Value: "db"}, true},
+		{logql.LabelMatcher{Label: "container", Op: logql.OpRe, Re: regexp.MustCompile(`^a.+$`)}, true},
+		{logql.LabelMatcher{Label: "container", Op: logql.OpNotRe, Re: regexp.MustCompile(`^a.+$`)}, false},
+		{logql.LabelMatcher{Label: "foo", Op: logql.OpEq, Value: "bar"}, false},
+	} {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			require.Equal(t, tt.want, set.Match([]logql.LabelMatcher{tt.matcher}))
+		})
+	}
+}
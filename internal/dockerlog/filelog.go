@@ -0,0 +1,390 @@
+package dockerlog
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/go-faster/errors"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/multierr"
+
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// fileLogOptions defines log files reading options.
+type fileLogOptions struct {
+	// start and end define time range of records to read.
+	//
+	// Zero value means unbounded range.
+	start, end otelstorage.Timestamp
+	streams    logStreams
+	// tty is true, if container has TTY attached.
+	tty      bool
+	resource otelstorage.Attrs
+}
+
+// readFrom returns timestamp of the first record to read.
+//
+// Reading starts a bit before range start to get chunks of messages crossing it.
+func (opts fileLogOptions) readFrom() otelstorage.Timestamp {
+	start, _ := widenRange(opts.start, opts.end)
+	return start
+}
+
+// logFile is a log file segment.
+type logFile struct {
+	path       string
+	compressed bool
+	// file is an opened segment file.
+	//
+	// Segments are opened at once, so reading is not affected by rotation.
+	file *os.File
+	// rc is an opened segment reader, if it is not nil.
+	rc io.ReadCloser
+}
+
+// open returns reader of segment from the beginning.
+//
+// Closing the reader does not close segment file.
+func (f logFile) open() (io.ReadCloser, error) {
+	if f.rc != nil {
+		return f.rc, nil
+	}
+
+	rd := io.NewSectionReader(f.file, 0, math.MaxInt64)
+	if !f.compressed {
+		return io.NopCloser(rd), nil
+	}
+
+	zr, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, errors.Wrap(err, "open gzip")
+	}
+	return zr, nil
+}
+
+// close closes segment.
+func (f logFile) close() (rerr error) {
+	if f.rc != nil {
+		multierr.AppendInto(&rerr, f.rc.Close())
+	}
+	if f.file != nil {
+		multierr.AppendInto(&rerr, f.file.Close())
+	}
+	return rerr
+}
+
+func closeFiles(files []logFile) (rerr error) {
+	for _, f := range files {
+		multierr.AppendInto(&rerr, f.close())
+	}
+	return rerr
+}
+
+// errRotated is returned when log is rotated while rotated files are opened.
+var errRotated = errors.New("log is rotated")
+
+// rotatedFiles opens rotated log files of given log, from oldest to newest.
+//
+// Returns an error if log file is not accessible.
+func rotatedFiles(path string) (files []logFile, err error) {
+	// Log is rotated rarely, so retry a few times.
+	for attempt := 0; attempt < 3; attempt++ {
+		files, err = openRotatedFiles(path)
+		if !errors.Is(err, errRotated) {
+			break
+		}
+	}
+	return files, err
+}
+
+func openRotatedFiles(path string) (files []logFile, rerr error) {
+	defer func() {
+		if rerr != nil {
+			_ = closeFiles(files)
+			files = nil
+		}
+	}()
+
+	current, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, logFile{path: path, file: current})
+
+	for i := 1; ; i++ {
+		name := path + "." + strconv.Itoa(i)
+		compressed := false
+
+		f, err := os.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			name += ".gz"
+			compressed = true
+			f, err = os.Open(name)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+		files = append(files, logFile{path: name, compressed: compressed, file: f})
+	}
+
+	// Rotation renames files, so the same file could be opened twice,
+	// and creates a new log file.
+	infos := make([]fs.FileInfo, len(files))
+	for idx, f := range files {
+		info, err := f.file.Stat()
+		if err != nil {
+			return files, errors.Wrapf(err, "stat %q", f.path)
+		}
+		for _, prev := range infos[:idx] {
+			if os.SameFile(prev, info) {
+				return files, errRotated
+			}
+		}
+		infos[idx] = info
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return files, err
+	}
+	if !os.SameFile(infos[0], info) {
+		return files, errRotated
+	}
+
+	slices.Reverse(files)
+	return files, nil
+}
+
+// searchFiles returns index of the last file with first record written before given timestamp.
+func searchFiles(files []logFile, ts otelstorage.Timestamp, newReader newEntryReader) (int, error) {
+	lo, hi := 0, len(files)-1
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+
+		first, err := firstTimestamp(files[mid], newReader)
+		switch {
+		case err != nil:
+			return 0, errors.Wrapf(err, "read first record of %q", files[mid].path)
+		case first == 0 || first > ts:
+			// File is empty or it starts after given timestamp.
+			hi = mid - 1
+		default:
+			lo = mid
+		}
+	}
+	return lo, nil
+}
+
+// firstTimestamp returns timestamp of the first record in file.
+//
+// Returns zero, if file is empty.
+func firstTimestamp(f logFile, newReader newEntryReader) (otelstorage.Timestamp, error) {
+	rc, err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	r := logstorage.Record{
+		Attrs: otelstorage.Attrs(pcommon.NewMap()),
+	}
+	if _, err := newReader(rc).Read(&r); err != nil {
+		if errors.Is(err, io.EOF) {
+			// File is empty or record is written partially.
+			return 0, nil
+		}
+		return 0, err
+	}
+	return r.Timestamp, nil
+}
+
+// entryReader reads log entries from log file.
+type entryReader interface {
+	// Read reads next entry to given record and returns entry stream.
+	//
+	// Returns io.EOF, if there is no more complete entries.
+	Read(r *logstorage.Record) (stream string, _ error)
+}
+
+type newEntryReader = func(rd io.Reader) entryReader
+
+// fileIter iterates over log records of log file segments.
+//
+// Records are read past range boundaries to return every chunk
+// of partial messages crossing them, so range should be applied
+// to reassembled messages.
+type fileIter struct {
+	files     []logFile
+	opts      fileLogOptions
+	newReader newEntryReader
+
+	// file is a file of current segment, if any.
+	file *os.File
+	rc   io.ReadCloser
+	rd   entryReader
+	err  error
+
+	// held is a list of chunks of incomplete messages written before range start.
+	held     []logstorage.Record
+	heldSize int
+	// queue is a list of records to return.
+	queue []logstorage.Record
+	// incomplete is a set of streams which message is not complete yet.
+	incomplete map[string]struct{}
+	// pastEnd is a size of records skipped after range end.
+	pastEnd int
+}
+
+var _ logiter = (*fileIter)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *fileIter) Next(r *logstorage.Record) (ok bool) {
+	ok, i.err = i.next(r)
+	return ok
+}
+
+func (i *fileIter) next(r *logstorage.Record) (bool, error) {
+	for {
+		if len(i.queue) > 0 {
+			*r = i.queue[0]
+			i.queue[0] = logstorage.Record{}
+			i.queue = i.queue[1:]
+			return true, nil
+		}
+
+		if i.rd == nil {
+			if len(i.files) == 0 {
+				return false, nil
+			}
+			f := i.files[0]
+			i.files = i.files[1:]
+
+			rc, err := f.open()
+			if err != nil {
+				_ = f.close()
+				return false, errors.Wrapf(err, "open %q", f.path)
+			}
+			i.file = f.file
+			i.rc = rc
+			i.rd = i.newReader(rc)
+		}
+
+		// Reset record.
+		*r = logstorage.Record{
+			Attrs:         otelstorage.Attrs(pcommon.NewMap()),
+			ResourceAttrs: i.opts.resource,
+		}
+		stream, err := i.rd.Read(r)
+		switch {
+		case errors.Is(err, io.EOF):
+			if err := i.closeFile(); err != nil {
+				return false, errors.Wrap(err, "close file")
+			}
+			continue
+		case err != nil:
+			return false, errors.Wrap(err, "read entry")
+		}
+
+		switch stream {
+		case stdout.String():
+			if !i.opts.streams.stdout {
+				continue
+			}
+		case stderr.String():
+			if !i.opts.streams.stderr {
+				continue
+			}
+		}
+
+		if start := i.opts.start; start != 0 && r.Timestamp < start {
+			// Message could continue in range.
+			i.hold(stream, *r)
+			continue
+		}
+		if end := i.opts.end; end != 0 && r.Timestamp > end {
+			if _, ok := i.incomplete[stream]; !ok {
+				// Records are ordered, so there is no more records in range,
+				// except chunks of incomplete messages.
+				if len(i.incomplete) == 0 || i.pastEnd > maxHeldSize {
+					return false, nil
+				}
+				i.pastEnd += len(r.Body)
+				continue
+			}
+		}
+		i.track(stream, *r)
+
+		if len(i.held) > 0 {
+			// Return chunks of messages started before range start first.
+			i.queue = append(i.held, *r)
+			i.held, i.heldSize = nil, 0
+			continue
+		}
+		return true, nil
+	}
+}
+
+// hold keeps chunks of incomplete message written before range start.
+func (i *fileIter) hold(stream string, r logstorage.Record) {
+	i.track(stream, r)
+	if _, ok := i.incomplete[stream]; !ok {
+		// Message is complete, so it is out of range.
+		i.held = slices.DeleteFunc(i.held, func(r logstorage.Record) bool {
+			return recordStream(r) == stream
+		})
+		i.heldSize = 0
+		for _, r := range i.held {
+			i.heldSize += len(r.Body)
+		}
+		return
+	}
+
+	i.held = append(i.held, r)
+	i.heldSize += len(r.Body)
+	if i.heldSize > maxHeldSize {
+		// Message is too big to be reassembled anyway.
+		i.held, i.heldSize = nil, 0
+	}
+}
+
+// track tracks whether the last message of stream is complete.
+func (i *fileIter) track(stream string, r logstorage.Record) {
+	if i.incomplete == nil {
+		i.incomplete = map[string]struct{}{}
+	}
+	if isLastChunk(r) {
+		delete(i.incomplete, stream)
+	} else {
+		i.incomplete[stream] = struct{}{}
+	}
+}
+
+func (i *fileIter) closeFile() error {
+	f := logFile{file: i.file, rc: i.rc}
+	i.file, i.rc, i.rd = nil, nil, nil
+	return f.close()
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *fileIter) Err() error {
+	return i.err
+}
+
+// Close closes iterator.
+func (i *fileIter) Close() error {
+	rerr := closeFiles(i.files)
+	i.files = nil
+	multierr.AppendInto(&rerr, i.closeFile())
+	return rerr
+}
@@ -0,0 +1,249 @@
+package dockerlog
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/jx"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// ParseJSONFileLog parses log file written by json-file log driver.
+func ParseJSONFileLog(f io.ReadCloser, resource otelstorage.Attrs) iterators.Iterator[logstorage.Record] {
+	opts := fileLogOptions{
+		streams:  logStreams{stdout: true, stderr: true},
+		resource: resource,
+	}
+	return &fileIter{
+		files:     []logFile{{rc: f}},
+		opts:      opts,
+		newReader: newJSONFileReader(opts),
+	}
+}
+
+// openJSONFileLog opens log written by json-file log driver, including rotated files.
+//
+// Returns an error if log file is not accessible.
+func openJSONFileLog(path string, opts fileLogOptions) (_ logiter, rerr error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr != nil {
+			_ = closeFiles(files)
+		}
+	}()
+
+	if opts.start != 0 {
+		// Find the last file started before range start.
+		idx, err := searchFiles(files, opts.readFrom(), newJSONFileReader(opts))
+		if err != nil {
+			return nil, err
+		}
+		_ = closeFiles(files[:idx])
+		files = files[idx:]
+
+		if f := files[0]; !f.compressed {
+			offset, err := seekJSONFileLog(f.file, opts.readFrom())
+			if err != nil {
+				return nil, errors.Wrapf(err, "search %q", f.path)
+			}
+			files[0].rc = io.NopCloser(io.NewSectionReader(f.file, offset, math.MaxInt64-offset))
+		}
+	}
+
+	return &fileIter{
+		files:     files,
+		opts:      opts,
+		newReader: newJSONFileReader(opts),
+	}, nil
+}
+
+// seekBlockSize is a size of file part to scan linearly instead of searching.
+const seekBlockSize = 64 * 1024
+
+// seekJSONFileLog returns offset of the first line with timestamp not before given.
+//
+// Offset may point to preceding line, if file records are not strictly ordered.
+func seekJSONFileLog(f *os.File, ts otelstorage.Timestamp) (int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// lo is a start of line, every record before lo is written before given timestamp.
+	lo, hi := int64(0), stat.Size()
+	for hi-lo > seekBlockSize {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := readLineAfter(f, mid, hi)
+		if err != nil {
+			return 0, err
+		}
+		if line == nil {
+			// No complete line in [mid, hi).
+			hi = mid
+			continue
+		}
+
+		lineTS, err := jsonLineTimestamp(line)
+		if err != nil {
+			return 0, errors.Wrapf(err, "parse line at %d", start)
+		}
+		if lineTS >= ts {
+			hi = mid
+			continue
+		}
+		lo = start + int64(len(line))
+	}
+	return lo, nil
+}
+
+// readLineAfter reads the first complete line that starts in [offset, limit).
+//
+// Returns nil line, if there is no such line.
+func readLineAfter(f io.ReaderAt, offset, limit int64) (int64, []byte, error) {
+	pos := offset
+	if offset > 0 {
+		// Start from the previous byte to check whether offset is a line start.
+		pos--
+	}
+	rd := bufio.NewReader(io.NewSectionReader(f, pos, math.MaxInt64-pos))
+
+	if offset > 0 {
+		// Skip the rest of the line.
+		for {
+			chunk, err := rd.ReadSlice('\n')
+			pos += int64(len(chunk))
+			if err == nil {
+				break
+			}
+			if errors.Is(err, bufio.ErrBufferFull) {
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return 0, nil, nil
+			}
+			return 0, nil, err
+		}
+	}
+	if pos >= limit {
+		return 0, nil, nil
+	}
+
+	line, err := rd.ReadBytes('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			// Incomplete line.
+			return 0, nil, nil
+		}
+		return 0, nil, err
+	}
+	return pos, line, nil
+}
+
+// jsonLineTimestamp returns timestamp of json-file log line.
+func jsonLineTimestamp(line []byte) (ts otelstorage.Timestamp, _ error) {
+	if err := jx.DecodeBytes(line).ObjBytes(func(d *jx.Decoder, key []byte) error {
+		if string(key) != "time" {
+			return d.Skip()
+		}
+		t, err := parseJSONFileTime(d)
+		if err != nil {
+			return err
+		}
+		ts = t
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return ts, nil
+}
+
+func parseJSONFileTime(d *jx.Decoder) (otelstorage.Timestamp, error) {
+	raw, err := d.StrBytes()
+	if err != nil {
+		return 0, errors.Wrap(err, "read time")
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(raw))
+	if err != nil {
+		return 0, errors.Wrap(err, "parse time")
+	}
+	return otelstorage.NewTimestampFromTime(t), nil
+}
+
+// jsonFileReader reads json-file log driver entries.
+type jsonFileReader struct {
+	rd  *bufio.Reader
+	tty bool
+}
+
+func newJSONFileReader(opts fileLogOptions) newEntryReader {
+	return func(rd io.Reader) entryReader {
+		return &jsonFileReader{
+			rd:  bufio.NewReader(rd),
+			tty: opts.tty,
+		}
+	}
+}
+
+// Read implements entryReader.
+func (rd *jsonFileReader) Read(r *logstorage.Record) (string, error) {
+	line, err := rd.rd.ReadBytes('\n')
+	if err != nil {
+		// Skip the last line without newline, it could be written partially.
+		return "", err
+	}
+	return rd.parseLine(line, r)
+}
+
+func (rd *jsonFileReader) parseLine(line []byte, r *logstorage.Record) (stream string, _ error) {
+	if err := jx.DecodeBytes(line).ObjBytes(func(d *jx.Decoder, key []byte) error {
+		switch string(key) {
+		case "log":
+			v, err := d.Str()
+			if err != nil {
+				return errors.Wrap(err, "read log")
+			}
+			if rd.tty {
+				// TTY translates "\n" to "\r\n", normalize it.
+				if trimmed, ok := strings.CutSuffix(v, "\r\n"); ok {
+					v = trimmed + "\n"
+				}
+			}
+			r.Body = v
+			return nil
+		case "stream":
+			v, err := d.Str()
+			if err != nil {
+				return errors.Wrap(err, "read stream")
+			}
+			stream = v
+			return nil
+		case "time":
+			ts, err := parseJSONFileTime(d)
+			if err != nil {
+				return err
+			}
+			r.Timestamp = ts
+			r.ObservedTimestamp = ts
+			return nil
+		default:
+			return d.Skip()
+		}
+	}); err != nil {
+		return "", err
+	}
+
+	r.Attrs.AsMap().PutStr(streamLabel, stream)
+	return stream, nil
+}
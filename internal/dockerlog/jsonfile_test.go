@@ -0,0 +1,219 @@
+package dockerlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+const testJSONFileLog = "_testdata/jsonfile/api-json.log"
+
+// testJSONFileTime returns timestamp of i-th record in test json-file log.
+func testJSONFileTime(i int) otelstorage.Timestamp {
+	ts := time.Date(2024, 2, 11, 9, 37, i, 123456789+i, time.UTC)
+	return otelstorage.NewTimestampFromTime(ts)
+}
+
+func readRecords(t *testing.T, iter logiter) (r []string) {
+	t.Helper()
+	defer func() {
+		require.NoError(t, iter.Close())
+	}()
+
+	require.NoError(t, iterators.ForEach(iter, func(rec logstorage.Record) error {
+		stream, _ := rec.Attrs.AsMap().Get("stream")
+		r = append(r, fmt.Sprintf("%s %s: %s", rec.Timestamp.AsTime().Format(time.StampNano), stream.Str(), rec.Body))
+		return nil
+	}))
+	return r
+}
+
+func TestParseJSONFileLog(t *testing.T) {
+	f, err := os.Open(testJSONFileLog)
+	require.NoError(t, err)
+
+	iter := ParseJSONFileLog(f, otelstorage.Attrs(pcommon.NewMap()))
+	require.Equal(t, []string{
+		"Feb 11 09:37:08.123456797 stdout: message 8\n",
+		"Feb 11 09:37:09.123456798 stderr: message 9\n",
+		"Feb 11 09:37:10.123456799 stdout: message 10\n",
+		"Feb 11 09:37:11.123456800 stdout: message 11\n",
+	}, readRecords(t, iter))
+}
+
+func TestOpenJSONFileLog(t *testing.T) {
+	all := logStreams{stdout: true, stderr: true}
+	tests := []struct {
+		name string
+		opts fileLogOptions
+		want []int
+	}{
+		{"All", fileLogOptions{streams: all}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+		{"Start", fileLogOptions{start: testJSONFileTime(5), streams: all}, []int{5, 6, 7, 8, 9, 10, 11}},
+		{"StartCompressed", fileLogOptions{start: testJSONFileTime(2), streams: all}, []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+		{"StartBetween", fileLogOptions{start: testJSONFileTime(7) + 1, streams: all}, []int{8, 9, 10, 11}},
+		{"End", fileLogOptions{end: testJSONFileTime(4), streams: all}, []int{0, 1, 2, 3, 4}},
+		{"Range", fileLogOptions{start: testJSONFileTime(3), end: testJSONFileTime(9), streams: all}, []int{3, 4, 5, 6, 7, 8, 9}},
+		{"Stderr", fileLogOptions{streams: logStreams{stderr: true}}, []int{0, 3, 6, 9}},
+		{"AfterEnd", fileLogOptions{start: testJSONFileTime(12), streams: all}, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.resource = otelstorage.Attrs(pcommon.NewMap())
+			iter, err := openJSONFileLog(testJSONFileLog, tt.opts)
+			require.NoError(t, err)
+
+			var want []string
+			for _, i := range tt.want {
+				stream := "stdout"
+				if i%3 == 0 {
+					stream = "stderr"
+				}
+				want = append(want, fmt.Sprintf("%s %s: message %d\n", testJSONFileTime(i).AsTime().Format(time.StampNano), stream, i))
+			}
+			require.Equal(t, want, readRecords(t, iter))
+		})
+	}
+
+	t.Run("NotExist", func(t *testing.T) {
+		_, err := openJSONFileLog("_testdata/jsonfile/missing-json.log", fileLogOptions{})
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestOpenJSONFileLogRotation(t *testing.T) {
+	writeLog := func(t *testing.T, path string, from, to int) {
+		var sb strings.Builder
+		for i := from; i < to; i++ {
+			ts := testJSONFileTime(i).AsTime().Format(time.RFC3339Nano)
+			fmt.Fprintf(&sb, `{"log":"message %d\n","stream":"stdout","time":%q}`+"\n", i, ts)
+		}
+		require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0o600))
+	}
+	rotate := func(t *testing.T, path string) {
+		require.NoError(t, os.Rename(path+".1", path+".2"))
+		require.NoError(t, os.Rename(path, path+".1"))
+	}
+
+	t.Run("DuringRead", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test-json.log")
+		writeLog(t, path+".1", 0, 3)
+		writeLog(t, path, 3, 6)
+
+		iter, err := openJSONFileLog(path, fileLogOptions{
+			streams:  logStreams{stdout: true},
+			resource: otelstorage.Attrs(pcommon.NewMap()),
+		})
+		require.NoError(t, err)
+		defer iter.Close()
+
+		var (
+			r    logstorage.Record
+			got  []string
+			once bool
+		)
+		for iter.Next(&r) {
+			got = append(got, r.Body)
+			if !once {
+				once = true
+				// Log is rotated while the oldest file is read.
+				rotate(t, path)
+				writeLog(t, path, 6, 9)
+			}
+		}
+		require.NoError(t, iter.Err())
+
+		var want []string
+		for i := 0; i < 6; i++ {
+			want = append(want, fmt.Sprintf("message %d\n", i))
+		}
+		require.Equal(t, want, got)
+	})
+	t.Run("SameFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test-json.log")
+		writeLog(t, path+".1", 0, 3)
+		writeLog(t, path, 3, 6)
+		// Rotated file is listed twice, as if log is rotated while listing.
+		require.NoError(t, os.Link(path+".1", path+".2"))
+
+		_, err := openJSONFileLog(path, fileLogOptions{})
+		require.ErrorIs(t, err, errRotated)
+	})
+}
+
+func TestSeekJSONFileLog(t *testing.T) {
+	var (
+		start = time.Date(2024, 2, 11, 9, 37, 0, 0, time.UTC)
+		sb    strings.Builder
+		// offsets is a list of line offsets.
+		offsets []int64
+	)
+	const lines = 10_000
+	for i := 0; i < lines; i++ {
+		offsets = append(offsets, int64(sb.Len()))
+		ts := start.Add(time.Duration(i) * time.Millisecond).Format(time.RFC3339Nano)
+		fmt.Fprintf(&sb, `{"log":"line %d\n","stream":"stdout","time":%q}`+"\n", i, ts)
+	}
+	path := filepath.Join(t.TempDir(), "test-json.log")
+	require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0o600))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, i := range []int{0, 1, 500, 5000, 9999} {
+		ts := otelstorage.NewTimestampFromTime(start.Add(time.Duration(i) * time.Millisecond))
+		offset, err := seekJSONFileLog(f, ts)
+		require.NoError(t, err)
+		require.LessOrEqual(t, offset, offsets[i])
+		// Offset is a line start and it is close enough to searched line.
+		require.Contains(t, offsets, offset)
+		require.Less(t, offsets[i]-offset, int64(seekBlockSize))
+	}
+}
+
+func TestQuerierSelectLogsJSONFile(t *testing.T) {
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running"},
+			{ID: "2", Names: []string{"/db"}, State: "running"},
+		},
+		logs: map[string][]logLine{
+			// Log file is not accessible, fallback to API.
+			"2": {{typ: stdout, ts: (testJSONFileTime(9) + 1).AsTime(), line: "db\n"}},
+		},
+		logFiles: map[string]string{
+			"1": testJSONFileLog,
+			"2": "_testdata/jsonfile/db-json.log",
+		},
+	}
+	q, err := NewQuerier(c, Options{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	iter, err := q.SelectLogs(ctx, testJSONFileTime(9), testJSONFileTime(10), logqlengine.SelectLogsParams{
+		Labels: []logql.LabelMatcher{
+			{Label: "stream", Op: logql.OpEq, Value: "stdout"},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"Feb 11 09:37:09.123456799 stdout: db\n",
+		"Feb 11 09:37:10.123456799 stdout: message 10\n",
+	}, readRecords(t, iter))
+}
@@ -0,0 +1,109 @@
+package dockerlog
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/go-faster/errors"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+)
+
+var _ logstorage.Querier = (*Querier)(nil)
+
+// LabelNames returns all available label names.
+func (q *Querier) LabelNames(ctx context.Context, opts logstorage.LabelsOptions) ([]string, error) {
+	containers, err := q.listContainers(ctx, opts.Start, opts.End, opts.Query.Matchers)
+	if err != nil {
+		return nil, errors.Wrap(err, "list containers")
+	}
+
+	names := map[string]struct{}{}
+	for _, ctr := range containers {
+		for name := range ctr.labels.labels {
+			names[name] = struct{}{}
+		}
+		names[streamLabel] = struct{}{}
+	}
+	return sortedKeys(names), nil
+}
+
+// LabelValues returns all available label values for given label.
+func (q *Querier) LabelValues(ctx context.Context, labelName string, opts logstorage.LabelsOptions) (iterators.Iterator[logstorage.Label], error) {
+	containers, err := q.listContainers(ctx, opts.Start, opts.End, opts.Query.Matchers)
+	if err != nil {
+		return nil, errors.Wrap(err, "list containers")
+	}
+
+	values := map[string]struct{}{}
+	for _, ctr := range containers {
+		if labelName == streamLabel {
+			for _, stream := range ctr.streams.Names() {
+				values[stream] = struct{}{}
+			}
+			continue
+		}
+		if value, ok := ctr.labels.labels[labelName]; ok {
+			values[value] = struct{}{}
+		}
+	}
+
+	labels := make([]logstorage.Label, 0, len(values))
+	for _, value := range sortedKeys(values) {
+		labels = append(labels, logstorage.Label{
+			Name:  labelName,
+			Value: value,
+			Type:  int32(pcommon.ValueTypeStr),
+		})
+	}
+	return iterators.Slice(labels), nil
+}
+
+// Series returns all available log series.
+func (q *Querier) Series(ctx context.Context, opts logstorage.SeriesOptions) (logstorage.Series, error) {
+	selectors := opts.Selectors
+	if len(selectors) == 0 {
+		// Select all containers.
+		selectors = []logql.Selector{{}}
+	}
+
+	var (
+		seen   = map[string]struct{}{}
+		series logstorage.Series
+	)
+	for _, sel := range selectors {
+		containers, err := q.listContainers(ctx, opts.Start, opts.End, sel.Matchers)
+		if err != nil {
+			return nil, errors.Wrap(err, "list containers")
+		}
+
+		for _, ctr := range containers {
+			// Each output stream of container is a separate series.
+			for _, stream := range ctr.streams.Names() {
+				key := ctr.ID + "/" + stream
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+
+				set := maps.Clone(ctr.labels.labels)
+				set[streamLabel] = stream
+				series = append(series, set)
+			}
+		}
+	}
+	return series, nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
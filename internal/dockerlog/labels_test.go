@@ -0,0 +1,173 @@
+package dockerlog
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+func testLabelsClient() *mockClient {
+	ts := time.Unix(1700000000, 0)
+	return &mockClient{
+		containers: []types.Container{
+			{
+				ID:      "1",
+				Names:   []string{"/api"},
+				Image:   "api:latest",
+				State:   "running",
+				Created: ts.Unix(),
+				Labels:  map[string]string{"com.docker.compose.service": "api"},
+			},
+			{
+				ID:      "2",
+				Names:   []string{"/worker"},
+				Image:   "worker:latest",
+				State:   "exited",
+				Created: ts.Unix(),
+				Labels:  map[string]string{"com.docker.compose.service": "worker"},
+			},
+			{
+				ID:      "3",
+				Names:   []string{"/migrate"},
+				Image:   "api:latest",
+				State:   "created",
+				Created: ts.Add(time.Hour).Unix(),
+			},
+		},
+		finished: map[string]time.Time{
+			"2": ts.Add(10 * time.Minute),
+		},
+	}
+}
+
+func TestQuerierLabelNames(t *testing.T) {
+	ctx := context.Background()
+	q, err := NewQuerier(testLabelsClient(), Options{})
+	require.NoError(t, err)
+
+	names, err := q.LabelNames(ctx, logstorage.LabelsOptions{})
+	require.NoError(t, err)
+	require.Contains(t, names, "container_image")
+	require.Contains(t, names, "com_docker_compose_service")
+	require.Contains(t, names, "stream")
+	require.IsIncreasing(t, names)
+
+	names, err = q.LabelNames(ctx, logstorage.LabelsOptions{
+		Query: logql.Selector{Matchers: []logql.LabelMatcher{
+			{Label: "container", Op: logql.OpEq, Value: "migrate"},
+		}},
+	})
+	require.NoError(t, err)
+	require.NotContains(t, names, "com_docker_compose_service")
+}
+
+func TestQuerierLabelValues(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	tests := []struct {
+		name  string
+		label string
+		opts  logstorage.LabelsOptions
+		want  []string
+	}{
+		{"All", "container", logstorage.LabelsOptions{}, []string{"api", "migrate", "worker"}},
+		{"Dedup", "container_image", logstorage.LabelsOptions{}, []string{"api:latest", "worker:latest"}},
+		{"Missing", "foo", logstorage.LabelsOptions{}, []string{}},
+		{"Stream", "stream", logstorage.LabelsOptions{}, []string{"stderr", "stdout"}},
+		{
+			"StreamQuery",
+			"stream",
+			logstorage.LabelsOptions{
+				Query: logql.Selector{Matchers: []logql.LabelMatcher{
+					{Label: "stream", Op: logql.OpRe, Value: "std.+", Re: regexp.MustCompile(`^(?:std.+)$`)},
+					{Label: "stream", Op: logql.OpNotRe, Value: "stdout", Re: regexp.MustCompile(`^(?:stdout)$`)},
+				}},
+			},
+			[]string{"stderr"},
+		},
+		{
+			"Query",
+			"container",
+			logstorage.LabelsOptions{
+				Query: logql.Selector{Matchers: []logql.LabelMatcher{
+					{Label: "container_image", Op: logql.OpEq, Value: "api:latest"},
+				}},
+			},
+			[]string{"api", "migrate"},
+		},
+		{
+			"BeforeCreated",
+			"container",
+			logstorage.LabelsOptions{
+				Start: otelstorage.NewTimestampFromTime(ts.Add(-time.Hour)),
+				End:   otelstorage.NewTimestampFromTime(ts.Add(30 * time.Minute)),
+			},
+			[]string{"api", "worker"},
+		},
+		{
+			"AfterFinished",
+			"container",
+			logstorage.LabelsOptions{
+				Start: otelstorage.NewTimestampFromTime(ts.Add(20 * time.Minute)),
+			},
+			[]string{"api", "migrate"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q, err := NewQuerier(testLabelsClient(), Options{})
+			require.NoError(t, err)
+
+			iter, err := q.LabelValues(ctx, tt.label, tt.opts)
+			require.NoError(t, err)
+
+			got := []string{}
+			require.NoError(t, iterators.ForEach(iter, func(l logstorage.Label) error {
+				require.Equal(t, tt.label, l.Name)
+				got = append(got, l.Value)
+				return nil
+			}))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQuerierSeries(t *testing.T) {
+	ctx := context.Background()
+	q, err := NewQuerier(testLabelsClient(), Options{})
+	require.NoError(t, err)
+
+	series, err := q.Series(ctx, logstorage.SeriesOptions{
+		Selectors: []logql.Selector{
+			{Matchers: []logql.LabelMatcher{
+				{Label: "container", Op: logql.OpEq, Value: "api"},
+				{Label: "stream", Op: logql.OpEq, Value: "stderr"},
+			}},
+			{Matchers: []logql.LabelMatcher{
+				{Label: "container_image", Op: logql.OpEq, Value: "api:latest"},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	var got []string
+	for _, set := range series {
+		got = append(got, set["container"]+"/"+set["stream"])
+	}
+	require.Equal(t, []string{"api/stderr", "api/stdout", "migrate/stdout", "migrate/stderr"}, got)
+	require.Equal(t, "api", series[0]["com_docker_compose_service"])
+
+	series, err = q.Series(ctx, logstorage.SeriesOptions{})
+	require.NoError(t, err)
+	require.Len(t, series, 6)
+}
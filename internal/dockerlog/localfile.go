@@ -0,0 +1,157 @@
+package dockerlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types/plugins/logdriver"
+	"github.com/go-faster/errors"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// Partial message metadata attributes.
+const (
+	// partialIDAttr is an ID of partial message.
+	partialIDAttr = "partial_id"
+	// partialOrdinalAttr is an ordinal number of partial message chunk, starting from 1.
+	partialOrdinalAttr = "partial_ordinal"
+	// partialLastAttr is true, if chunk is the last chunk of partial message.
+	partialLastAttr = "partial_last"
+)
+
+// ParseLocalLog parses log file written by local log driver.
+func ParseLocalLog(f io.ReadCloser, resource otelstorage.Attrs) iterators.Iterator[logstorage.Record] {
+	opts := fileLogOptions{
+		streams:  logStreams{stdout: true, stderr: true},
+		resource: resource,
+	}
+	return &fileIter{
+		files:     []logFile{{rc: f}},
+		opts:      opts,
+		newReader: newLocalFileReader(opts),
+	}
+}
+
+// openLocalLog opens log written by local log driver, including rotated files.
+//
+// Returns an error if log file is not accessible.
+func openLocalLog(path string, opts fileLogOptions) (logiter, error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.start != 0 {
+		// Find the last file started before range start.
+		idx, err := searchFiles(files, opts.readFrom(), newLocalFileReader(opts))
+		if err != nil {
+			_ = closeFiles(files)
+			return nil, err
+		}
+		_ = closeFiles(files[:idx])
+		files = files[idx:]
+	}
+
+	return &fileIter{
+		files:     files,
+		opts:      opts,
+		newReader: newLocalFileReader(opts),
+	}, nil
+}
+
+const (
+	// localSizeLen is a length of entry size prefix and suffix.
+	localSizeLen = 4
+	// maxLocalEntrySize is a maximum size of local log driver entry.
+	maxLocalEntrySize = 16 << 20
+)
+
+// localFileReader reads local log driver entries.
+//
+// Every entry is a protobuf-encoded [logdriver.LogEntry] surrounded by
+// big-endian uint32 entry size.
+type localFileReader struct {
+	rd    *bufio.Reader
+	tty   bool
+	buf   []byte
+	entry logdriver.LogEntry
+}
+
+func newLocalFileReader(opts fileLogOptions) newEntryReader {
+	return func(rd io.Reader) entryReader {
+		return &localFileReader{
+			rd:  bufio.NewReader(rd),
+			tty: opts.tty,
+		}
+	}
+}
+
+// Read implements entryReader.
+func (rd *localFileReader) Read(r *logstorage.Record) (string, error) {
+	var header [localSizeLen]byte
+	if _, err := io.ReadFull(rd.rd, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// Entry is written partially.
+			return "", io.EOF
+		}
+		return "", err
+	}
+
+	size := int(binary.BigEndian.Uint32(header[:]))
+	if size > maxLocalEntrySize {
+		return "", errors.Errorf("entry is too big (%d bytes)", size)
+	}
+
+	// Read entry and its size suffix.
+	n := size + localSizeLen
+	if cap(rd.buf) < n {
+		rd.buf = make([]byte, n)
+	}
+	buf := rd.buf[:n]
+	if _, err := io.ReadFull(rd.rd, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// Entry is written partially.
+			return "", io.EOF
+		}
+		return "", err
+	}
+	if suffix := int(binary.BigEndian.Uint32(buf[size:])); suffix != size {
+		return "", errors.Errorf("entry size mismatch: prefix %d, suffix %d", size, suffix)
+	}
+
+	e := &rd.entry
+	e.Reset()
+	if err := e.Unmarshal(buf[:size]); err != nil {
+		return "", errors.Wrap(err, "unmarshal entry")
+	}
+
+	ts := otelstorage.Timestamp(e.TimeNano)
+	r.Timestamp = ts
+	r.ObservedTimestamp = ts
+
+	line := string(e.Line)
+	if rd.tty {
+		// TTY translates "\n" to "\r\n", normalize it.
+		line = strings.TrimSuffix(line, "\r")
+	}
+	meta := e.PartialLogMetadata
+	if !e.Partial || (meta != nil && meta.Last) {
+		// Driver strips newline of complete messages.
+		line += "\n"
+	}
+	r.Body = line
+
+	attrs := r.Attrs.AsMap()
+	attrs.PutStr(streamLabel, e.Source)
+	if e.Partial && meta != nil {
+		attrs.PutStr(partialIDAttr, meta.Id)
+		attrs.PutInt(partialOrdinalAttr, int64(meta.Ordinal))
+		attrs.PutBool(partialLastAttr, meta.Last)
+	}
+	return e.Source, nil
+}
@@ -0,0 +1,156 @@
+package dockerlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+const testLocalLog = "_testdata/local-logs/container.log"
+
+func TestParseLocalLog(t *testing.T) {
+	f, err := os.Open(testLocalLog)
+	require.NoError(t, err)
+
+	iter := ParseLocalLog(f, otelstorage.Attrs(pcommon.NewMap()))
+	defer func() {
+		require.NoError(t, iter.Close())
+	}()
+
+	type partial struct {
+		id      string
+		ordinal int64
+		last    bool
+	}
+	var (
+		got      []string
+		partials []partial
+	)
+	require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+		attrs := r.Attrs.AsMap()
+		stream, _ := attrs.Get("stream")
+		got = append(got, fmt.Sprintf("%s %s: %s", r.Timestamp.AsTime().Format(time.StampNano), stream.Str(), r.Body))
+
+		if id, ok := attrs.Get("partial_id"); ok {
+			ordinal, _ := attrs.Get("partial_ordinal")
+			last, _ := attrs.Get("partial_last")
+			partials = append(partials, partial{id.Str(), ordinal.Int(), last.Bool()})
+		}
+		return nil
+	}))
+	require.Equal(t, []string{
+		"Feb 11 09:37:04.123456793 stdout: message 4\n",
+		"Feb 11 09:37:05.123456794 stdout: message 5\n",
+		"Feb 11 09:37:06.123456795 stderr: message 6\n",
+		"Feb 11 09:37:07.123456796 stdout: message 7\n",
+		"Feb 11 09:37:08.123456797 stdout: long ",
+		"Feb 11 09:37:08.123456797 stdout: message ",
+		"Feb 11 09:37:08.123456797 stdout: 8\n",
+		// Incomplete entry is skipped.
+	}, got)
+	require.Equal(t, []partial{
+		{"a1b2c3", 1, false},
+		{"a1b2c3", 2, false},
+		{"a1b2c3", 3, true},
+	}, partials)
+}
+
+func TestOpenLocalLog(t *testing.T) {
+	all := logStreams{stdout: true, stderr: true}
+	tests := []struct {
+		name string
+		opts fileLogOptions
+		want []int
+	}{
+		{"All", fileLogOptions{streams: all}, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{"Start", fileLogOptions{start: testJSONFileTime(5), streams: all}, []int{5, 6, 7}},
+		{"StartCompressed", fileLogOptions{start: testJSONFileTime(2), streams: all}, []int{2, 3, 4, 5, 6, 7}},
+		{"Range", fileLogOptions{start: testJSONFileTime(1), end: testJSONFileTime(5), streams: all}, []int{1, 2, 3, 4, 5}},
+		{"Stderr", fileLogOptions{streams: logStreams{stderr: true}}, []int{0, 3, 6}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.resource = otelstorage.Attrs(pcommon.NewMap())
+			// Skip partial message.
+			if tt.opts.end == 0 {
+				tt.opts.end = testJSONFileTime(7)
+			}
+			iter, err := openLocalLog(testLocalLog, tt.opts)
+			require.NoError(t, err)
+
+			var want []string
+			for _, i := range tt.want {
+				stream := "stdout"
+				if i%3 == 0 {
+					stream = "stderr"
+				}
+				want = append(want, fmt.Sprintf("%s %s: message %d\n", testJSONFileTime(i).AsTime().Format(time.StampNano), stream, i))
+			}
+			require.Equal(t, want, readRecords(t, iter))
+		})
+	}
+}
+
+func TestQuerierLogSource(t *testing.T) {
+	newClient := func() *mockClient {
+		return &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "running"},
+			},
+			logs: map[string][]logLine{
+				"1": {{typ: stdout, ts: testJSONFileTime(4).AsTime(), line: "from api\n"}},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		source  LogSource
+		hostDir string
+		want    string
+		wantErr bool
+	}{
+		{"Auto", LogSourceAuto, "_testdata", "message 4\n", false},
+		{"AutoFallback", LogSourceAuto, "_testdata/missing", "from api\n", false},
+		{"API", LogSourceAPI, "_testdata", "from api\n", false},
+		{"File", LogSourceFile, "_testdata", "message 4\n", false},
+		{"FileMissing", LogSourceFile, "_testdata/missing", "", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient()
+			c.localDirs = map[string]string{"1": tt.hostDir}
+
+			q, err := NewQuerier(c, Options{Source: tt.source, Strict: true})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			iter, err := q.SelectLogs(ctx, testJSONFileTime(4), testJSONFileTime(4), logqlengine.SelectLogsParams{})
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer iter.Close()
+
+			var r logstorage.Record
+			require.True(t, iter.Next(&r))
+			require.Equal(t, tt.want, r.Body)
+		})
+	}
+
+	_, err := NewQuerier(newClient(), Options{Source: "ftp"})
+	require.Error(t, err)
+}
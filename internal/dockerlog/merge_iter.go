@@ -1,11 +1,18 @@
 package dockerlog
 
 import (
+	"cmp"
 	"container/heap"
+	"context"
+	"slices"
+	"sync"
 
+	"github.com/go-faster/errors"
 	"go.uber.org/multierr"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
 )
 
 type iterHeapElem struct {
@@ -43,16 +50,156 @@ func (h *iterHeap) Pop() any {
 	return x
 }
 
+// lazyLog is a container log opened on demand.
+type lazyLog struct {
+	// since is a timestamp of the first possible record.
+	since otelstorage.Timestamp
+	// open opens log.
+	//
+	// If resume is not zero, log is reopened to continue reading, so iterator
+	// should return every record since resume, even if some of them are read already.
+	// Records before resume are skipped as well.
+	open func(ctx context.Context, resume otelstorage.Timestamp) (logiter, error)
+}
+
+// readAheadSize is a number of records buffered before closing log, if too many logs are opened.
+const readAheadSize = 128
+
+// mergeSource is a merged log.
+type mergeSource struct {
+	// log is a lazily opened log, nil if iterator cannot be reopened.
+	log  *lazyLog
+	iter logiter
+	// buf is a queue of records read before iterator is closed.
+	buf []logstorage.Record
+	// last is a timestamp of the last read record and
+	// lastCount is a number of read records with such timestamp.
+	last      otelstorage.Timestamp
+	lastCount int
+	// skip is a number of already read records to skip after reopening.
+	skip    int
+	drained bool
+}
+
+// next returns the next record of log.
+//
+// Iterator should be opened, if there are no buffered records.
+func (s *mergeSource) next(r *logstorage.Record) (bool, error) {
+	if len(s.buf) > 0 {
+		*r = s.buf[0]
+		s.buf[0] = logstorage.Record{}
+		s.buf = s.buf[1:]
+		return true, nil
+	}
+	return s.read(r)
+}
+
+// read reads the next record from iterator.
+func (s *mergeSource) read(r *logstorage.Record) (bool, error) {
+	if s.drained {
+		return false, nil
+	}
+
+	for {
+		if !s.iter.Next(r) {
+			if err := s.iter.Err(); err != nil {
+				return false, err
+			}
+			s.drained = true
+			return false, s.close()
+		}
+		if s.skip > 0 && r.Timestamp <= s.last {
+			// Record is read before reopening.
+			if r.Timestamp == s.last {
+				s.skip--
+			}
+			continue
+		}
+		s.skip = 0
+
+		if r.Timestamp == s.last {
+			s.lastCount++
+		} else {
+			s.last, s.lastCount = r.Timestamp, 1
+		}
+		return true, nil
+	}
+}
+
+// suspend reads ahead some records and closes iterator.
+func (s *mergeSource) suspend() error {
+	for len(s.buf) < readAheadSize {
+		var r logstorage.Record
+		ok, err := s.read(&r)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		s.buf = append(s.buf, r)
+	}
+	return s.close()
+}
+
+// needsOpen whether iterator should be opened to get the next record.
+func (s *mergeSource) needsOpen() bool {
+	return s.iter == nil && len(s.buf) == 0 && !s.drained
+}
+
+func (s *mergeSource) close() error {
+	iter := s.iter
+	s.iter = nil
+	if iter == nil {
+		return nil
+	}
+	return iter.Close()
+}
+
 // mergeIter merges several iterators by timestamp.
+//
+// Pending logs are opened only when merge reaches their first possible record.
+// If limit of opened logs is reached, logs which records are needed last are
+// closed and reopened later.
 type mergeIter struct {
-	iters     []logiter
-	heap      iterHeap
-	initiazed bool
+	sources []*mergeSource
+	heap    iterHeap
+
+	// pending is a list of logs to open, sorted by since.
+	pending []lazyLog
+	// limit is a maximum number of opened lazy logs, zero means no limit.
+	limit  int
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	initialized bool
+	err         error
+}
+
+func newMergeIter(iters []logiter) *mergeIter {
+	sources := make([]*mergeSource, len(iters))
+	for idx, iter := range iters {
+		sources[idx] = &mergeSource{iter: iter}
+	}
+	return &mergeIter{
+		sources: sources,
+	}
 }
 
-func newMergeIter(iters []logiter) logiter {
+// newLazyMergeIter creates merge iterator of lazily opened logs.
+//
+// Number of opened logs is limited by given concurrency. Iterator cancels
+// given context on error or close, to stop reading the other logs.
+func newLazyMergeIter(ctx context.Context, cancel context.CancelFunc, logs []lazyLog, concurrency int) *mergeIter {
+	logs = slices.Clone(logs)
+	slices.SortStableFunc(logs, func(a, b lazyLog) int {
+		return cmp.Compare(a.since, b.since)
+	})
 	return &mergeIter{
-		iters: iters,
+		pending: logs,
+		limit:   concurrency,
+		ctx:     ctx,
+		cancel:  cancel,
 	}
 }
 
@@ -60,7 +207,27 @@ var _ logiter = (*mergeIter)(nil)
 
 // Next returns true, if there is element and fills t.
 func (i *mergeIter) Next(r *logstorage.Record) (ok bool) {
-	i.init()
+	if i.err != nil || !i.init() {
+		return false
+	}
+	if ctx := i.ctx; ctx != nil {
+		if err := ctx.Err(); err != nil {
+			i.err = err
+			return false
+		}
+	}
+
+	// Open logs that may contain records before the current minimum.
+	for len(i.pending) > 0 && (i.heap.Len() < 1 || i.pending[0].since <= i.heap[0].record.Timestamp) {
+		bound := i.pending[0].since
+		if i.heap.Len() > 0 {
+			bound = i.heap[0].record.Timestamp
+		}
+		if err := i.openPending(bound); err != nil {
+			i.fail(err)
+			return false
+		}
+	}
 	if i.heap.Len() < 1 {
 		return false
 	}
@@ -69,31 +236,44 @@ func (i *mergeIter) Next(r *logstorage.Record) (ok bool) {
 	e := heap.Pop(&i.heap).(iterHeapElem)
 	*r = e.record
 
-	switch iter := i.iters[e.iterIdx]; {
-	case iter.Next(&e.record):
-		// Peek next element from min iterator.
-		heap.Push(&i.heap, e)
-		return true
-	case iter.Err() != nil:
+	// Peek next element from min iterator.
+	s := i.sources[e.iterIdx]
+	if s.needsOpen() {
+		if err := i.reopen(s); err != nil {
+			i.fail(err)
+			return false
+		}
+	}
+	ok, err := s.next(&e.record)
+	switch {
+	case err != nil:
 		// Return an error, if read failed.
+		i.fail(err)
 		return false
-	default:
-		// heap.Pop removed drained iterator from heap.
-		return true
+	case ok:
+		heap.Push(&i.heap, e)
 	}
+	// Otherwise, heap.Pop removed drained iterator from heap.
+	return true
 }
 
-func (i *mergeIter) init() {
-	if i.initiazed {
-		return
+// init peeks an element from each opened iterator and opens the first pending logs.
+func (i *mergeIter) init() bool {
+	if i.initialized {
+		return true
 	}
-	i.initiazed = true
+	i.initialized = true
 
 	// Peek an element from each iterator to
 	// find min element.
-	var record logstorage.Record
-	for idx, iter := range i.iters {
-		if !iter.Next(&record) {
+	for idx, s := range i.sources {
+		var record logstorage.Record
+		ok, err := s.next(&record)
+		if err != nil {
+			i.fail(err)
+			return false
+		}
+		if !ok {
 			continue
 		}
 		heap.Push(&i.heap, iterHeapElem{
@@ -101,20 +281,198 @@ func (i *mergeIter) init() {
 			record:  record,
 		})
 	}
+
+	if len(i.pending) > 0 {
+		if err := i.openPending(i.pending[0].since); err != nil {
+			i.fail(err)
+			return false
+		}
+	}
+	return true
+}
+
+// openPending concurrently opens pending logs started not after given bound.
+func (i *mergeIter) openPending(bound otelstorage.Timestamp) error {
+	n := 0
+	for n < len(i.pending) && i.pending[n].since <= bound {
+		n++
+	}
+	logs := i.pending[:n]
+	i.pending = i.pending[n:]
+
+	for len(logs) > 0 {
+		batch := logs
+		if i.limit > 0 {
+			if err := i.release(min(len(logs), i.limit)); err != nil {
+				return err
+			}
+			// Release leaves at least one free slot.
+			batch = logs[:min(len(logs), i.limit-i.opened())]
+		}
+		logs = logs[len(batch):]
+
+		sources := make([]*mergeSource, len(batch))
+		for idx := range batch {
+			sources[idx] = &mergeSource{log: &batch[idx]}
+		}
+		heads := make([]logstorage.Record, len(batch))
+		oks := make([]bool, len(batch))
+		err := i.parallel(len(batch), func(idx int) error {
+			s := sources[idx]
+			iter, err := s.log.open(i.ctx, 0)
+			if err != nil {
+				return err
+			}
+			s.iter = iter
+			// Peek the first record to find min element.
+			oks[idx], err = s.next(&heads[idx])
+			return err
+		})
+
+		// Keep opened iterators to close them anyway.
+		for idx, s := range sources {
+			if s.iter == nil && !oks[idx] {
+				// Log is not opened or it is empty.
+				continue
+			}
+			i.sources = append(i.sources, s)
+			if oks[idx] {
+				heap.Push(&i.heap, iterHeapElem{
+					iterIdx: len(i.sources) - 1,
+					record:  heads[idx],
+				})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reopen reopens log to continue reading.
+func (i *mergeIter) reopen(s *mergeSource) error {
+	if err := i.release(1); err != nil {
+		return err
+	}
+	iter, err := s.log.open(i.ctx, s.last)
+	if err != nil {
+		return err
+	}
+	s.iter = iter
+	s.skip = s.lastCount
+	return nil
+}
+
+// opened returns number of opened lazy logs.
+func (i *mergeIter) opened() (n int) {
+	for _, s := range i.sources {
+		if s.log != nil && s.iter != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// release suspends opened logs to open given number of logs within the limit.
+//
+// Logs which records are needed last are suspended. Returns an error,
+// if no log could be opened within the limit.
+func (i *mergeIter) release(n int) error {
+	if i.limit <= 0 {
+		return nil
+	}
+	excess := i.opened() + n - i.limit
+	if excess <= 0 {
+		return nil
+	}
+
+	var candidates []iterHeapElem
+	for _, e := range i.heap {
+		if s := i.sources[e.iterIdx]; s.log != nil && s.iter != nil {
+			candidates = append(candidates, e)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b iterHeapElem) int {
+		return cmp.Compare(b.record.Timestamp, a.record.Timestamp)
+	})
+	candidates = candidates[:min(excess, len(candidates))]
+
+	if err := i.parallel(len(candidates), func(idx int) error {
+		return i.sources[candidates[idx].iterIdx].suspend()
+	}); err != nil {
+		return err
+	}
+	if opened := i.opened(); opened >= i.limit {
+		return errors.Errorf("cannot suspend any of %d opened logs", opened)
+	}
+	return nil
+}
+
+// parallel calls given function for n elements concurrently.
+//
+// The first error cancels the query.
+func (i *mergeIter) parallel(n int, f func(idx int) error) error {
+	var (
+		grp errgroup.Group
+
+		failOnce sync.Once
+		failErr  error
+	)
+	for idx := 0; idx < n; idx++ {
+		idx := idx
+		grp.Go(func() error {
+			if i.ctx.Err() != nil {
+				return nil
+			}
+			if err := f(idx); err != nil {
+				failOnce.Do(func() {
+					failErr = err
+					// Cancel other requests.
+					i.cancel()
+				})
+			}
+			return nil
+		})
+	}
+	_ = grp.Wait()
+	if failErr != nil {
+		return failErr
+	}
+	// Query may be canceled.
+	return i.ctx.Err()
+}
+
+// fail stops iteration with given error and cancels reading other logs.
+func (i *mergeIter) fail(err error) {
+	if err != nil {
+		i.err = err
+	}
+	if i.cancel != nil {
+		i.cancel()
+	}
 }
 
 // Err returns an error caused during iteration, if any.
 func (i *mergeIter) Err() (rerr error) {
-	for _, iter := range i.iters {
-		multierr.AppendInto(&rerr, iter.Err())
+	if err := i.err; err != nil {
+		return err
+	}
+	for _, s := range i.sources {
+		if s.iter != nil {
+			multierr.AppendInto(&rerr, s.iter.Err())
+		}
 	}
 	return rerr
 }
 
 // Close closes iterator.
 func (i *mergeIter) Close() (rerr error) {
-	for _, iter := range i.iters {
-		multierr.AppendInto(&rerr, iter.Close())
+	if i.cancel != nil {
+		i.cancel()
+	}
+	for _, s := range i.sources {
+		multierr.AppendInto(&rerr, s.close())
 	}
 	return rerr
 }
@@ -1,10 +1,14 @@
 package dockerlog
 
 import (
+	"context"
 	"fmt"
 	"slices"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/go-faster/errors"
 	"github.com/stretchr/testify/require"
 
 	"github.com/tdakkota/docker-logql/internal/iterators"
@@ -50,3 +54,225 @@ func TestMergeIter(t *testing.T) {
 	require.NoError(t, iter.Err())
 	require.Equal(t, expected, got)
 }
+
+func TestLazyMergeIter(t *testing.T) {
+	newRecords := func(tss ...otelstorage.Timestamp) logiter {
+		elems := make([]logstorage.Record, len(tss))
+		for i, ts := range tss {
+			elems[i] = logstorage.Record{Timestamp: ts}
+		}
+		return iterators.Slice(elems)
+	}
+
+	t.Run("Lazy", func(t *testing.T) {
+		var opened []string
+		lazy := func(name string, since otelstorage.Timestamp, tss ...otelstorage.Timestamp) lazyLog {
+			return lazyLog{
+				since: since,
+				open: func(context.Context, otelstorage.Timestamp) (logiter, error) {
+					opened = append(opened, name)
+					return newRecords(tss...), nil
+				},
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := newLazyMergeIter(ctx, cancel, []lazyLog{
+			lazy("c", 10, 10, 11),
+			lazy("a", 1, 1, 5, 12),
+			lazy("b", 1, 2, 3),
+		}, 1)
+		defer func() {
+			require.NoError(t, iter.Close())
+			require.Error(t, ctx.Err())
+		}()
+
+		var (
+			record logstorage.Record
+			got    []otelstorage.Timestamp
+		)
+		for iter.Next(&record) {
+			got = append(got, record.Timestamp)
+			if record.Timestamp < 5 {
+				require.Equal(t, []string{"a", "b"}, opened)
+			}
+		}
+		require.NoError(t, iter.Err())
+		require.Equal(t, []otelstorage.Timestamp{1, 2, 3, 5, 10, 11, 12}, got)
+		require.Equal(t, []string{"a", "b", "c"}, opened)
+	})
+	t.Run("Error", func(t *testing.T) {
+		testErr := errors.New("test error")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := newLazyMergeIter(ctx, cancel, []lazyLog{
+			{
+				since: 1,
+				open: func(ctx context.Context, _ otelstorage.Timestamp) (logiter, error) {
+					// Wait for cancellation caused by sibling.
+					<-ctx.Done()
+					return nil, ctx.Err()
+				},
+			},
+			{
+				since: 1,
+				open: func(context.Context, otelstorage.Timestamp) (logiter, error) {
+					return nil, testErr
+				},
+			},
+		}, 2)
+		defer iter.Close()
+
+		var record logstorage.Record
+		require.False(t, iter.Next(&record))
+		require.ErrorIs(t, iter.Err(), testErr)
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		const limit = 2
+		var (
+			current atomic.Int32
+			peak    atomic.Int32
+			logs    []lazyLog
+		)
+		for i := 0; i < 10; i++ {
+			ts := otelstorage.Timestamp(i + 1)
+			logs = append(logs, lazyLog{
+				since: 0,
+				open: func(context.Context, otelstorage.Timestamp) (logiter, error) {
+					n := current.Add(1)
+					defer current.Add(-1)
+					for {
+						p := peak.Load()
+						if n <= p || peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					time.Sleep(time.Millisecond)
+					return newRecords(ts), nil
+				},
+			})
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := newLazyMergeIter(ctx, cancel, logs, limit)
+		defer iter.Close()
+
+		var (
+			record logstorage.Record
+			count  int
+		)
+		for iter.Next(&record) {
+			count++
+		}
+		require.NoError(t, iter.Err())
+		require.Equal(t, 10, count)
+		require.LessOrEqual(t, peak.Load(), int32(limit))
+	})
+	t.Run("OpenLimit", func(t *testing.T) {
+		const (
+			limit   = 4
+			logsN   = 50
+			records = 3 * readAheadSize
+		)
+		var (
+			current atomic.Int32
+			peak    atomic.Int32
+			reopens atomic.Int32
+			logs    []lazyLog
+			want    []string
+		)
+		for i := 0; i < logsN; i++ {
+			var elems []logstorage.Record
+			for j := 0; j < records; j++ {
+				// Every log has records with the same timestamp.
+				ts := otelstorage.Timestamp(j/2*logsN + i + 1)
+				elems = append(elems, logstorage.Record{
+					Timestamp: ts,
+					Body:      fmt.Sprintf("log %d record %d", i, j),
+				})
+				want = append(want, fmt.Sprintf("%d: log %d record %d", ts, i, j))
+			}
+			logs = append(logs, lazyLog{
+				since: 0,
+				open: func(_ context.Context, resume otelstorage.Timestamp) (logiter, error) {
+					n := current.Add(1)
+					for {
+						p := peak.Load()
+						if n <= p || peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					if resume != 0 {
+						reopens.Add(1)
+					}
+
+					elems := elems
+					for len(elems) > 0 && elems[0].Timestamp < resume {
+						elems = elems[1:]
+					}
+					return &closeHook{
+						Iterator: iterators.Slice(elems),
+						onClose:  func() { current.Add(-1) },
+					}, nil
+				},
+			})
+		}
+		slices.Sort(want)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := newLazyMergeIter(ctx, cancel, logs, limit)
+
+		var (
+			record logstorage.Record
+			prev   otelstorage.Timestamp
+			got    []string
+		)
+		for iter.Next(&record) {
+			require.GreaterOrEqual(t, record.Timestamp, prev)
+			prev = record.Timestamp
+			got = append(got, fmt.Sprintf("%d: %s", record.Timestamp, record.Body))
+		}
+		require.NoError(t, iter.Err())
+		require.NoError(t, iter.Close())
+
+		// Records are not lost or duplicated on reopening.
+		slices.Sort(got)
+		require.Equal(t, want, got)
+		require.LessOrEqual(t, peak.Load(), int32(limit))
+		require.Positive(t, reopens.Load())
+		require.Zero(t, current.Load())
+	})
+	t.Run("NoFreeSlot", func(t *testing.T) {
+		var opened bool
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := newLazyMergeIter(ctx, cancel, []lazyLog{
+			{
+				since: 1,
+				open: func(context.Context, otelstorage.Timestamp) (logiter, error) {
+					opened = true
+					return newRecords(1), nil
+				},
+			},
+		}, 1)
+		defer iter.Close()
+		// Opened log without record in heap cannot be suspended.
+		iter.initialized = true
+		iter.sources = []*mergeSource{{log: &lazyLog{}, iter: newRecords(2)}}
+
+		var record logstorage.Record
+		require.False(t, iter.Next(&record))
+		require.ErrorContains(t, iter.Err(), "cannot suspend any of 1 opened logs")
+		require.False(t, opened)
+	})
+}
+
+// closeHook calls given function on close.
+type closeHook struct {
+	iterators.Iterator[logstorage.Record]
+	onClose func()
+}
+
+func (i *closeHook) Close() error {
+	i.onClose()
+	return i.Iterator.Close()
+}
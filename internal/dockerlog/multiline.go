@@ -0,0 +1,218 @@
+package dockerlog
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// MultilineOptions defines multiline grouping options.
+//
+// Grouping joins continuation lines (e.g. stack traces) with the first line of an entry.
+type MultilineOptions struct {
+	// Start matches the first line of an entry.
+	//
+	// If nil, every line that is not indented starts a new entry.
+	Start *regexp.Regexp
+	// MaxLines is a maximum number of lines in entry.
+	//
+	// Defaults to 500.
+	MaxLines int
+	// Timeout is a maximum time gap between lines of an entry.
+	//
+	// When following logs, pending entry is returned if there are no new lines during timeout.
+	//
+	// Defaults to 3s.
+	Timeout time.Duration
+}
+
+func (o *MultilineOptions) setDefaults() {
+	if o.MaxLines == 0 {
+		o.MaxLines = 500
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 3 * time.Second
+	}
+}
+
+func (o MultilineOptions) validate() error {
+	if o.MaxLines < 0 {
+		return errors.Errorf("invalid max lines %d", o.MaxLines)
+	}
+	if o.Timeout < 0 {
+		return errors.Errorf("invalid timeout %s", o.Timeout)
+	}
+	return nil
+}
+
+// multilineGrouper joins continuation lines with the first line of an entry.
+//
+// Continuation lines must belong to the same stream as the first line.
+// Entries are returned in order of their first lines, so entries following
+// an incomplete entry of other stream are held back until it is complete.
+type multilineGrouper struct {
+	opts MultilineOptions
+
+	// pending is a map of stream name to incomplete entry.
+	pending map[string]*multilineEntry
+	// queue is a queue of entries in order of their first lines.
+	queue []*multilineEntry
+}
+
+type multilineEntry struct {
+	record   logstorage.Record
+	stream   string
+	body     strings.Builder
+	lines    int
+	last     otelstorage.Timestamp
+	complete bool
+}
+
+func (e *multilineEntry) result() logstorage.Record {
+	r := e.record
+	r.Body = e.body.String()
+	return r
+}
+
+// Push adds record to the group and appends complete entries to ready.
+func (g *multilineGrouper) Push(r logstorage.Record, ready []logstorage.Record) []logstorage.Record {
+	stream := recordStream(r)
+
+	// Entries of other streams cannot be continued after timeout.
+	for _, e := range g.pending {
+		if e.stream != stream && g.expired(e, r.Timestamp) {
+			g.finish(e)
+		}
+	}
+
+	e, ok := g.pending[stream]
+	switch {
+	case ok && g.continues(e, r):
+		e.body.WriteString(r.Body)
+		e.lines++
+		e.last = r.Timestamp
+	default:
+		if ok {
+			g.finish(e)
+		}
+		e = &multilineEntry{
+			record: r,
+			stream: stream,
+			lines:  1,
+			last:   r.Timestamp,
+		}
+		e.body.WriteString(r.Body)
+		if g.pending == nil {
+			g.pending = map[string]*multilineEntry{}
+		}
+		g.pending[stream] = e
+		g.queue = append(g.queue, e)
+	}
+	if e.lines >= g.opts.MaxLines {
+		g.finish(e)
+	}
+	return g.pop(ready)
+}
+
+// Flush completes pending entries and appends all queued entries to ready.
+func (g *multilineGrouper) Flush(ready []logstorage.Record) []logstorage.Record {
+	for _, e := range g.pending {
+		g.finish(e)
+	}
+	return g.pop(ready)
+}
+
+// Pending returns true, if there are entries held back.
+func (g *multilineGrouper) Pending() bool {
+	return len(g.queue) > 0
+}
+
+// finish marks entry as complete.
+func (g *multilineGrouper) finish(e *multilineEntry) {
+	e.complete = true
+	if g.pending[e.stream] == e {
+		delete(g.pending, e.stream)
+	}
+}
+
+// pop appends complete entries from the head of the queue to ready.
+func (g *multilineGrouper) pop(ready []logstorage.Record) []logstorage.Record {
+	for len(g.queue) > 0 && g.queue[0].complete {
+		ready = append(ready, g.queue[0].result())
+		g.queue[0] = nil
+		g.queue = g.queue[1:]
+	}
+	return ready
+}
+
+func (g *multilineGrouper) expired(e *multilineEntry, ts otelstorage.Timestamp) bool {
+	return ts > e.last && time.Duration(ts-e.last) > g.opts.Timeout
+}
+
+func (g *multilineGrouper) continues(e *multilineEntry, r logstorage.Record) bool {
+	if g.expired(e, r.Timestamp) {
+		return false
+	}
+
+	line := strings.TrimSuffix(r.Body, "\n")
+	if re := g.opts.Start; re != nil {
+		return !re.MatchString(line)
+	}
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+// multilineIter groups multiline entries of container log.
+type multilineIter struct {
+	iter    logiter
+	grouper multilineGrouper
+
+	// ready is a queue of complete entries.
+	ready []logstorage.Record
+	done  bool
+}
+
+func newMultilineIter(iter logiter, opts MultilineOptions) *multilineIter {
+	return &multilineIter{
+		iter:    iter,
+		grouper: multilineGrouper{opts: opts},
+	}
+}
+
+var _ logiter = (*multilineIter)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *multilineIter) Next(r *logstorage.Record) bool {
+	for {
+		if len(i.ready) > 0 {
+			*r = i.ready[0]
+			i.ready = i.ready[1:]
+			return true
+		}
+		if i.done {
+			return false
+		}
+
+		var record logstorage.Record
+		if !i.iter.Next(&record) {
+			i.done = true
+			i.ready = i.grouper.Flush(i.ready)
+			continue
+		}
+		i.ready = i.grouper.Push(record, i.ready)
+	}
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *multilineIter) Err() error {
+	return i.iter.Err()
+}
+
+// Close closes iterator.
+func (i *multilineIter) Close() error {
+	return i.iter.Close()
+}
@@ -0,0 +1,236 @@
+package dockerlog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+func TestMultilineIter(t *testing.T) {
+	record := func(i int, stream, body string) logstorage.Record {
+		attrs := pcommon.NewMap()
+		attrs.PutStr(streamLabel, stream)
+		return logstorage.Record{
+			Timestamp: testJSONFileTime(i),
+			Body:      body,
+			Attrs:     otelstorage.Attrs(attrs),
+		}
+	}
+	trace := []logstorage.Record{
+		record(1, "stderr", "Exception in thread \"main\" java.lang.IllegalStateException\n"),
+		record(1, "stderr", "\tat Main.run(Main.java:10)\n"),
+		record(1, "stderr", "\tat Main.main(Main.java:5)\n"),
+		record(1, "stderr", "Caused by: java.io.IOException\n"),
+		record(1, "stderr", "\tat Main.read(Main.java:20)\n"),
+		record(2, "stdout", "done\n"),
+	}
+
+	tests := []struct {
+		name  string
+		opts  MultilineOptions
+		input []logstorage.Record
+		want  []string
+	}{
+		{"Empty", MultilineOptions{}, nil, nil},
+		{
+			"Indent",
+			MultilineOptions{},
+			trace,
+			[]string{
+				"Feb 11 09:37:01.123456790 stderr: Exception in thread \"main\" java.lang.IllegalStateException\n" +
+					"\tat Main.run(Main.java:10)\n" +
+					"\tat Main.main(Main.java:5)\n",
+				"Feb 11 09:37:01.123456790 stderr: Caused by: java.io.IOException\n" +
+					"\tat Main.read(Main.java:20)\n",
+				"Feb 11 09:37:02.123456791 stdout: done\n",
+			},
+		},
+		{
+			"Start",
+			MultilineOptions{Start: regexp.MustCompile(`^(Exception|done)`)},
+			trace,
+			[]string{
+				"Feb 11 09:37:01.123456790 stderr: Exception in thread \"main\" java.lang.IllegalStateException\n" +
+					"\tat Main.run(Main.java:10)\n" +
+					"\tat Main.main(Main.java:5)\n" +
+					"Caused by: java.io.IOException\n" +
+					"\tat Main.read(Main.java:20)\n",
+				"Feb 11 09:37:02.123456791 stdout: done\n",
+			},
+		},
+		{
+			"MaxLines",
+			MultilineOptions{MaxLines: 2},
+			trace[:3],
+			[]string{
+				"Feb 11 09:37:01.123456790 stderr: Exception in thread \"main\" java.lang.IllegalStateException\n" +
+					"\tat Main.run(Main.java:10)\n",
+				"Feb 11 09:37:01.123456790 stderr: \tat Main.main(Main.java:5)\n",
+			},
+		},
+		{
+			"Timeout",
+			MultilineOptions{Timeout: 2 * time.Second},
+			[]logstorage.Record{
+				record(1, "stdout", "first\n"),
+				record(2, "stdout", "  continuation\n"),
+				record(5, "stdout", "  late\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: first\n  continuation\n",
+				"Feb 11 09:37:05.123456794 stdout:   late\n",
+			},
+		},
+		{
+			"Stream",
+			MultilineOptions{},
+			[]logstorage.Record{
+				record(1, "stdout", "first\n"),
+				record(1, "stderr", "  other stream\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: first\n",
+				"Feb 11 09:37:01.123456790 stderr:   other stream\n",
+			},
+		},
+		{
+			"Interleaved",
+			MultilineOptions{},
+			[]logstorage.Record{
+				record(1, "stderr", "panic: runtime error\n"),
+				record(1, "stderr", "\tmain.go:10\n"),
+				record(1, "stdout", "request handled\n"),
+				record(1, "stderr", "\tmain.go:5\n"),
+				record(2, "stdout", "  indented\n"),
+				record(2, "stderr", "exit\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stderr: panic: runtime error\n\tmain.go:10\n\tmain.go:5\n",
+				"Feb 11 09:37:01.123456790 stdout: request handled\n  indented\n",
+				"Feb 11 09:37:02.123456791 stderr: exit\n",
+			},
+		},
+		{
+			"InterleavedTimeout",
+			MultilineOptions{Timeout: 2 * time.Second},
+			[]logstorage.Record{
+				record(1, "stderr", "panic: runtime error\n"),
+				record(1, "stdout", "first\n"),
+				record(2, "stdout", "second\n"),
+				record(5, "stdout", "third\n"),
+				record(5, "stderr", "  late\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stderr: panic: runtime error\n",
+				"Feb 11 09:37:01.123456790 stdout: first\n",
+				"Feb 11 09:37:02.123456791 stdout: second\n",
+				"Feb 11 09:37:05.123456794 stdout: third\n",
+				"Feb 11 09:37:05.123456794 stderr:   late\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.setDefaults()
+			iter := newMultilineIter(iterators.Slice(tt.input), tt.opts)
+			require.Equal(t, tt.want, readRecords(t, iter))
+		})
+	}
+}
+
+func TestQuerierMultiline(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running"},
+		},
+		logs: map[string][]logLine{
+			"1": {
+				{typ: stderr, ts: ts, line: "Traceback (most recent call last):\n"},
+				{typ: stderr, ts: ts, line: "  File \"main.py\", line 1, in <module>\n"},
+			},
+		},
+	}
+	q, err := NewQuerier(c, Options{
+		Multiline: &MultilineOptions{Timeout: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	want := "Traceback (most recent call last):\n  File \"main.py\", line 1, in <module>\n"
+
+	t.Run("SelectLogs", func(t *testing.T) {
+		ctx := context.Background()
+		iter, err := q.SelectLogs(ctx, 0, 0, logqlengine.SelectLogsParams{})
+		require.NoError(t, err)
+		defer iter.Close()
+
+		var r logstorage.Record
+		require.True(t, iter.Next(&r))
+		require.Equal(t, want, r.Body)
+		require.False(t, iter.Next(&r))
+	})
+	t.Run("TailLogs", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		iter, err := q.TailLogs(ctx, otelstorage.NewTimestampFromTime(ts), logqlengine.SelectLogsParams{})
+		require.NoError(t, err)
+		defer iter.Close()
+
+		// Follow stream is still open, entry is sent after timeout.
+		var r logstorage.Record
+		require.True(t, iter.Next(&r))
+		require.Equal(t, want, r.Body)
+	})
+
+	_, err = NewQuerier(c, Options{Multiline: &MultilineOptions{MaxLines: -1}})
+	require.Error(t, err)
+}
+
+func TestQuerierMultilineReopen(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	const records = 3 * readAheadSize
+
+	logs := map[string][]logLine{}
+	for i := 0; i < records; i++ {
+		at := ts.Add(time.Duration(i) * time.Second)
+		for _, id := range []string{"1", "2"} {
+			logs[id] = append(logs[id], logLine{typ: stdout, ts: at, line: fmt.Sprintf("container %s record %d\n", id, i)})
+		}
+		// Stack trace spans position where the log is reopened.
+		switch {
+		case i == readAheadSize/2:
+			logs["1"] = append(logs["1"], logLine{typ: stderr, ts: at, line: "Traceback (most recent call last):\n"})
+		case i > readAheadSize/2 && i < 2*readAheadSize:
+			logs["1"] = append(logs["1"], logLine{typ: stderr, ts: at, line: fmt.Sprintf("  File \"main.py\", line %d\n", i)})
+		}
+	}
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running", Created: ts.Unix()},
+			{ID: "2", Names: []string{"/db"}, State: "running", Created: ts.Unix()},
+		},
+		logs: logs,
+	}
+
+	q, err := NewQuerier(c, Options{Source: LogSourceAPI, Multiline: &MultilineOptions{}})
+	require.NoError(t, err)
+	want := readLines(t, q, time.Time{}, time.Time{})
+	require.Len(t, want, 2*records+1)
+
+	// Logs overlap, so they are closed and reopened to read within the limit.
+	q, err = NewQuerier(c, Options{Source: LogSourceAPI, Multiline: &MultilineOptions{}, Concurrency: 1})
+	require.NoError(t, err)
+	require.ElementsMatch(t, want, readLines(t, q, time.Time{}, time.Time{}))
+}
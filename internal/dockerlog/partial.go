@@ -0,0 +1,223 @@
+package dockerlog
+
+import (
+	"strings"
+
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+const (
+	// maxMessageSize is a maximum size of reassembled message.
+	//
+	// Message is returned as is, if it exceeds the limit.
+	maxMessageSize = 1 << 20
+	// maxHeldSize is a maximum total size of messages held back until
+	// the oldest incomplete message is reassembled.
+	//
+	// The oldest message is returned as is, if held messages exceed the limit.
+	maxHeldSize = 4 * maxMessageSize
+)
+
+// partialIter reassembles messages split by Docker into partial messages.
+//
+// Docker splits long lines into chunks. Every chunk, except the last one,
+// has no trailing newline. Local log driver marks chunks explicitly.
+//
+// Messages are returned in order of their first chunks, so records following
+// an incomplete message are held back until it is reassembled.
+type partialIter struct {
+	iter logiter
+	// start and end define time range of messages to return.
+	//
+	// Range is applied to timestamp of the first chunk of reassembled message.
+	// Given iterator should return chunks of messages crossing range boundaries,
+	// see fileIter and partialMargin.
+	start, end otelstorage.Timestamp
+
+	// pending is a map of stream name to incomplete message.
+	pending map[string]*partialMessage
+	// queue is a queue of messages in order of their first chunks.
+	queue []*partialMessage
+	// held is a total size of queued messages.
+	held int
+	// seen is a set of streams that have records.
+	seen map[string]struct{}
+	// orphaned is a set of streams which message started before the first read record.
+	orphaned map[string]struct{}
+	done     bool
+}
+
+type partialMessage struct {
+	stream string
+	record logstorage.Record
+	// body is a reassembled body, if message has multiple chunks.
+	body     strings.Builder
+	size     int
+	complete bool
+}
+
+func newPartialIter(iter logiter, start, end otelstorage.Timestamp) *partialIter {
+	return &partialIter{
+		iter:     iter,
+		start:    start,
+		end:      end,
+		pending:  map[string]*partialMessage{},
+		seen:     map[string]struct{}{},
+		orphaned: map[string]struct{}{},
+	}
+}
+
+var _ logiter = (*partialIter)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *partialIter) Next(r *logstorage.Record) bool {
+	for {
+		if i.pop(r) {
+			return true
+		}
+		if i.done {
+			return false
+		}
+
+		var record logstorage.Record
+		if !i.iter.Next(&record) {
+			i.done = true
+			i.flush()
+			continue
+		}
+		i.push(record)
+	}
+}
+
+// pop returns the next complete message in range, if any.
+func (i *partialIter) pop(r *logstorage.Record) bool {
+	for len(i.queue) > 0 && i.queue[0].complete {
+		msg := i.queue[0]
+		i.queue[0] = nil
+		i.queue = i.queue[1:]
+		i.held -= msg.size
+
+		if !inRange(msg.record.Timestamp, i.start, i.end) {
+			continue
+		}
+		*r = msg.result()
+		return true
+	}
+	return false
+}
+
+// queued whether there are messages held back.
+func (i *partialIter) queued() bool {
+	return len(i.queue) > 0
+}
+
+func (i *partialIter) push(record logstorage.Record) {
+	attrs := record.Attrs.AsMap()
+
+	stream := recordStream(record)
+	complete := isLastChunk(record)
+	var continuation bool
+	if v, ok := attrs.Get(partialOrdinalAttr); ok {
+		continuation = v.Int() > 1
+	}
+	for _, k := range []string{partialIDAttr, partialOrdinalAttr, partialLastAttr} {
+		attrs.Remove(k)
+	}
+
+	_, seen := i.seen[stream]
+	i.seen[stream] = struct{}{}
+	if _, ok := i.orphaned[stream]; ok || (!seen && continuation) {
+		// Message started before the first read record, so it cannot be reassembled.
+		if complete {
+			delete(i.orphaned, stream)
+		} else {
+			i.orphaned[stream] = struct{}{}
+		}
+		return
+	}
+
+	msg, ok := i.pending[stream]
+	if ok {
+		msg.add(record.Body)
+	} else {
+		// Use timestamp and attributes of the first chunk.
+		msg = &partialMessage{
+			stream: stream,
+			record: record,
+			size:   len(record.Body),
+		}
+		i.queue = append(i.queue, msg)
+		i.pending[stream] = msg
+	}
+	i.held += len(record.Body)
+
+	if complete || msg.size >= maxMessageSize {
+		i.finish(msg)
+	}
+	if i.held > maxHeldSize {
+		// Do not hold back too many records.
+		i.finish(i.queue[0])
+	}
+}
+
+// recordStream returns output stream of record.
+func recordStream(r logstorage.Record) string {
+	if v, ok := r.Attrs.AsMap().Get(streamLabel); ok {
+		return v.Str()
+	}
+	return ""
+}
+
+// isLastChunk whether record is the last chunk of message.
+func isLastChunk(r logstorage.Record) bool {
+	attrs := r.Attrs.AsMap()
+	if _, partial := attrs.Get(partialIDAttr); partial {
+		// Local log driver marks the last chunk explicitly.
+		if v, ok := attrs.Get(partialLastAttr); ok {
+			return v.Bool()
+		}
+	}
+	return strings.HasSuffix(r.Body, "\n")
+}
+
+// finish marks message as complete.
+func (i *partialIter) finish(msg *partialMessage) {
+	msg.complete = true
+	if i.pending[msg.stream] == msg {
+		delete(i.pending, msg.stream)
+	}
+}
+
+// flush returns incomplete messages as is.
+func (i *partialIter) flush() {
+	for _, msg := range i.pending {
+		i.finish(msg)
+	}
+}
+
+func (m *partialMessage) add(chunk string) {
+	if m.body.Len() == 0 {
+		m.body.WriteString(m.record.Body)
+	}
+	m.body.WriteString(chunk)
+	m.size += len(chunk)
+}
+
+func (m *partialMessage) result() logstorage.Record {
+	r := m.record
+	if m.body.Len() > 0 {
+		r.Body = m.body.String()
+	}
+	return r
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *partialIter) Err() error {
+	return i.iter.Err()
+}
+
+// Close closes iterator.
+func (i *partialIter) Close() error {
+	return i.iter.Close()
+}
@@ -0,0 +1,326 @@
+package dockerlog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+func TestPartialIter(t *testing.T) {
+	record := func(i int, stream, body string) logstorage.Record {
+		attrs := pcommon.NewMap()
+		attrs.PutStr(streamLabel, stream)
+		return logstorage.Record{
+			Timestamp: testJSONFileTime(i),
+			Body:      body,
+			Attrs:     otelstorage.Attrs(attrs),
+		}
+	}
+	long := strings.Repeat("a", maxMessageSize)
+
+	tests := []struct {
+		name  string
+		input []logstorage.Record
+		want  []string
+	}{
+		{"Empty", nil, nil},
+		{
+			"Complete",
+			[]logstorage.Record{
+				record(1, "stdout", "first\n"),
+				record(2, "stdout", "second\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: first\n",
+				"Feb 11 09:37:02.123456791 stdout: second\n",
+			},
+		},
+		{
+			"Partial",
+			[]logstorage.Record{
+				record(1, "stdout", "long "),
+				record(1, "stdout", "message\n"),
+				record(2, "stdout", "short\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: long message\n",
+				"Feb 11 09:37:02.123456791 stdout: short\n",
+			},
+		},
+		{
+			"Interleaved",
+			[]logstorage.Record{
+				record(1, "stdout", "long "),
+				record(2, "stderr", "error\n"),
+				record(3, "stdout", "message\n"),
+			},
+			[]string{
+				// Messages are ordered by their first chunks.
+				"Feb 11 09:37:01.123456790 stdout: long message\n",
+				"Feb 11 09:37:02.123456791 stderr: error\n",
+			},
+		},
+		{
+			"HeldBack",
+			[]logstorage.Record{
+				record(1, "stdout", "long "),
+				record(2, "stderr", "error\n"),
+				record(3, "stderr", "another "),
+				record(4, "stdout", "message\n"),
+				record(5, "stderr", "error\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: long message\n",
+				"Feb 11 09:37:02.123456791 stderr: error\n",
+				"Feb 11 09:37:03.123456792 stderr: another error\n",
+			},
+		},
+		{
+			"Incomplete",
+			[]logstorage.Record{
+				record(1, "stderr", "prompt: "),
+				record(2, "stdout", "long "),
+				record(2, "stdout", "message"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stderr: prompt: ",
+				"Feb 11 09:37:02.123456791 stdout: long message",
+			},
+		},
+		{
+			"TooBig",
+			[]logstorage.Record{
+				record(1, "stdout", long),
+				record(1, "stdout", "tail\n"),
+			},
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: " + long,
+				"Feb 11 09:37:01.123456790 stdout: tail\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			iter := newPartialIter(iterators.Slice(tt.input), 0, 0)
+			require.Equal(t, tt.want, readRecords(t, iter))
+		})
+	}
+}
+
+func TestPartialIterRange(t *testing.T) {
+	// Zero ordinal means that record has no partial metadata.
+	record := func(i int, body string, ordinal int64, last bool) logstorage.Record {
+		attrs := pcommon.NewMap()
+		attrs.PutStr(streamLabel, "stdout")
+		if ordinal > 0 {
+			attrs.PutStr(partialIDAttr, "id")
+			attrs.PutInt(partialOrdinalAttr, ordinal)
+			attrs.PutBool(partialLastAttr, last)
+		}
+		return logstorage.Record{
+			Timestamp: testJSONFileTime(i),
+			Body:      body,
+			Attrs:     otelstorage.Attrs(attrs),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		input      []logstorage.Record
+		start, end int
+		want       []string
+	}{
+		{
+			"StartedBefore",
+			[]logstorage.Record{
+				record(1, "long ", 0, false),
+				record(2, "message\n", 0, false),
+				record(3, "short\n", 0, false),
+			},
+			2, 0,
+			[]string{
+				"Feb 11 09:37:03.123456792 stdout: short\n",
+			},
+		},
+		{
+			"EndedAfter",
+			[]logstorage.Record{
+				record(1, "short\n", 0, false),
+				record(2, "long ", 0, false),
+				record(3, "message\n", 0, false),
+			},
+			0, 2,
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: short\n",
+				"Feb 11 09:37:02.123456791 stdout: long message\n",
+			},
+		},
+		{
+			"Continuation",
+			[]logstorage.Record{
+				record(2, "message ", 2, false),
+				record(2, "continued\n", 3, true),
+				record(3, "short\n", 0, false),
+			},
+			2, 0,
+			[]string{
+				"Feb 11 09:37:03.123456792 stdout: short\n",
+			},
+		},
+		{
+			"LastChunk",
+			[]logstorage.Record{
+				// Local log driver uses metadata instead of newline.
+				record(1, "first line\n", 1, false),
+				record(1, "second line\n", 2, false),
+				record(1, "end", 3, true),
+				record(2, "short\n", 0, false),
+			},
+			0, 0,
+			[]string{
+				"Feb 11 09:37:01.123456790 stdout: first line\nsecond line\nend",
+				"Feb 11 09:37:02.123456791 stdout: short\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var start, end otelstorage.Timestamp
+			if tt.start > 0 {
+				start = testJSONFileTime(tt.start)
+			}
+			if tt.end > 0 {
+				end = testJSONFileTime(tt.end)
+			}
+			iter := newPartialIter(iterators.Slice(tt.input), start, end)
+			require.Equal(t, tt.want, readRecords(t, iter))
+		})
+	}
+}
+
+func TestPartialIterLocalLog(t *testing.T) {
+	iter, err := openLocalLog(testLocalLog, fileLogOptions{
+		start:    testJSONFileTime(7),
+		streams:  logStreams{stdout: true, stderr: true},
+		resource: otelstorage.Attrs(pcommon.NewMap()),
+	})
+	require.NoError(t, err)
+	iter = newPartialIter(iter, 0, 0)
+	defer func() {
+		require.NoError(t, iter.Close())
+	}()
+
+	var got []logstorage.Record
+	require.NoError(t, iterators.ForEach(iter, func(r logstorage.Record) error {
+		got = append(got, r)
+		return nil
+	}))
+	require.Len(t, got, 2)
+
+	r := got[1]
+	require.Equal(t, testJSONFileTime(8), r.Timestamp)
+	require.Equal(t, "long message 8\n", r.Body)
+	// Partial metadata is removed.
+	require.Equal(t, map[string]any{"stream": "stdout"}, r.Attrs.AsMap().AsRaw())
+}
+
+func TestQuerierSelectLogsPartial(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running"},
+		},
+		logs: map[string][]logLine{
+			"1": {
+				{typ: stdout, ts: ts, line: `{"msg":`},
+				{typ: stdout, ts: ts, line: `"hello"}` + "\n"},
+				{typ: stderr, ts: ts.Add(time.Second), line: "error\n"},
+			},
+		},
+	}
+	q, err := NewQuerier(c, Options{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	iter, err := q.SelectLogs(ctx, 0, 0, logqlengine.SelectLogsParams{})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"Nov 14 22:13:20.000000000 stdout: {\"msg\":\"hello\"}\n",
+		"Nov 14 22:13:21.000000000 stderr: error\n",
+	}, readRecords(t, iter))
+}
+
+func TestQuerierSelectLogsPartialRange(t *testing.T) {
+	ts := time.Unix(1700000000, 0).UTC()
+	at := func(i int) time.Time {
+		// Older Docker versions assign the read time to every chunk.
+		return ts.Add(time.Duration(i) * 100 * time.Millisecond)
+	}
+	lines := []logLine{
+		{typ: stdout, ts: at(0), line: "before\n"},
+		{typ: stdout, ts: at(1), line: "started "},
+		{typ: stdout, ts: at(2), line: "before start\n"},
+		{typ: stdout, ts: at(3), line: "in range\n"},
+		{typ: stdout, ts: at(4), line: "ended "},
+		{typ: stderr, ts: at(5), line: "after end\n"},
+		{typ: stdout, ts: at(6), line: "after end\n"},
+		{typ: stdout, ts: at(7), line: "after\n"},
+	}
+	var (
+		start = otelstorage.NewTimestampFromTime(at(2))
+		end   = otelstorage.NewTimestampFromTime(at(4).Add(time.Millisecond))
+	)
+
+	// Write the same log as json-file log driver does.
+	var sb strings.Builder
+	for _, l := range lines {
+		data, err := json.Marshal(struct {
+			Log    string    `json:"log"`
+			Stream string    `json:"stream"`
+			Time   time.Time `json:"time"`
+		}{l.line, l.typ.String(), l.ts})
+		require.NoError(t, err)
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	logPath := filepath.Join(t.TempDir(), "api-json.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(sb.String()), 0o600))
+
+	for _, source := range []LogSource{LogSourceFile, LogSourceAPI} {
+		source := source
+		t.Run(string(source), func(t *testing.T) {
+			c := &mockClient{
+				containers: []types.Container{
+					{ID: "1", Names: []string{"/api"}, State: "running"},
+				},
+				logs:     map[string][]logLine{"1": lines},
+				logFiles: map[string]string{"1": logPath},
+			}
+			q, err := NewQuerier(c, Options{Source: source})
+			require.NoError(t, err)
+
+			iter, err := q.SelectLogs(context.Background(), start, end, logqlengine.SelectLogsParams{})
+			require.NoError(t, err)
+			require.Equal(t, []string{
+				"Nov 14 22:13:20.300000000 stdout: in range\n",
+				"Nov 14 22:13:20.400000000 stdout: ended after end\n",
+			}, readRecords(t, iter))
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package dockerlog
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	apicontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/go-faster/errors"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+var _ logqlengine.TailQuerier = (*Querier)(nil)
+
+// TailLogs follows log records of running containers matching given params.
+//
+// Iterator attaches to matching containers started after the call too.
+// Records of different containers are returned in order of arrival.
+func (q *Querier) TailLogs(ctx context.Context, start otelstorage.Timestamp, params logqlengine.SelectLogsParams) (iterators.Iterator[logstorage.Record], error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Subscribe before listing containers to not miss containers started in between.
+	msgs, errs := q.client.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("event", string(events.ActionStart)),
+		),
+	})
+
+	containers, err := q.fetchContainers(ctx, start, 0, params)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "fetch containers")
+	}
+
+	iter := &tailIter{
+		q:         q,
+		ctx:       ctx,
+		cancel:    cancel,
+		records:   make(chan logstorage.Record, 64),
+		following: map[string]struct{}{},
+	}
+	for _, ctr := range containers {
+		iter.follow(ctr, start)
+	}
+
+	iter.wg.Add(1)
+	go func() {
+		defer iter.wg.Done()
+		iter.watch(params, msgs, errs)
+	}()
+	return iter, nil
+}
+
+type tailIter struct {
+	q       *Querier
+	ctx     context.Context
+	cancel  context.CancelFunc
+	records chan logstorage.Record
+	wg      sync.WaitGroup
+
+	mux       sync.Mutex
+	following map[string]struct{}
+	err       error
+}
+
+var _ logiter = (*tailIter)(nil)
+
+// watch attaches to started containers matching given params.
+func (i *tailIter) watch(params logqlengine.SelectLogsParams, msgs <-chan events.Message, errs <-chan error) {
+	for {
+		select {
+		case <-i.ctx.Done():
+			return
+		case err := <-errs:
+			i.fail(errors.Wrap(err, "watch events"))
+			return
+		case msg := <-msgs:
+			// Re-run selector to get labels of started container.
+			//
+			// Select only started container to not inspect every matching one.
+			selector := params
+			selector.Labels = append(slices.Clip(params.Labels), logql.LabelMatcher{
+				Label: "container_id",
+				Op:    logql.OpEq,
+				Value: msg.Actor.ID,
+			})
+			containers, err := i.q.fetchContainers(i.ctx, 0, 0, selector)
+			if err != nil {
+				i.fail(errors.Wrap(err, "fetch containers"))
+				return
+			}
+
+			// Read records written since container start.
+			//
+			// Container may write records before start event is emitted,
+			// so round timestamp down to keep a margin.
+			since := otelstorage.NewTimestampFromTime(time.Unix(0, msg.TimeNano).Truncate(time.Second))
+			for _, ctr := range containers {
+				i.follow(ctr, since)
+			}
+		}
+	}
+}
+
+// follow starts reading logs of given container, if it is not followed yet.
+func (i *tailIter) follow(ctr container, since otelstorage.Timestamp) {
+	if ctr.labels.labels["container_state"] != "running" {
+		// Stopped container would not produce new records.
+		return
+	}
+
+	i.mux.Lock()
+	if _, ok := i.following[ctr.ID]; ok {
+		i.mux.Unlock()
+		return
+	}
+	i.following[ctr.ID] = struct{}{}
+	i.mux.Unlock()
+
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		defer func() {
+			// Follow stream ends when container stops, so
+			// allow to attach again when container restarts.
+			i.mux.Lock()
+			delete(i.following, ctr.ID)
+			i.mux.Unlock()
+		}()
+
+		if err := i.readLog(ctr, since); err != nil {
+			if err := i.q.skipContainer(i.ctx, ctr, err); err != nil {
+				i.fail(errors.Wrapf(err, "follow container %q log", ctr.ID))
+			}
+		}
+	}()
+}
+
+func (i *tailIter) readLog(ctr container, since otelstorage.Timestamp) error {
+	opts := apicontainer.LogsOptions{
+		ShowStdout: ctr.streams.stdout,
+		ShowStderr: ctr.streams.stderr,
+		Since:      formatLogTime(since),
+		Timestamps: true,
+		Follow:     true,
+	}
+	if since == 0 {
+		// Follow only new records, Docker returns the whole log otherwise.
+		opts.Tail = "0"
+	}
+	rc, err := i.q.client.ContainerLogs(i.ctx, ctr.ID, opts)
+	if err != nil {
+		return errors.Wrap(err, "query logs")
+	}
+
+	iter := ctr.parseChunks(rc)
+	defer func() {
+		_ = iter.Close()
+	}()
+	return i.readFollowed(iter, since)
+}
+
+// partialTimeout is a maximum time to wait for the rest of partial message of followed log.
+const partialTimeout = time.Second
+
+// readFollowed reassembles partial messages and groups multiline entries of followed log.
+//
+// Incomplete messages are sent as is, if records are held back longer than partialTimeout.
+// Pending multiline entries are sent, if there are no new records during multiline timeout.
+func (i *tailIter) readFollowed(iter logiter, since otelstorage.Timestamp) error {
+	var (
+		records = make(chan logstorage.Record)
+		errc    = make(chan error, 1)
+	)
+	go func() {
+		defer close(records)
+
+		var r logstorage.Record
+		for iter.Next(&r) {
+			select {
+			case <-i.ctx.Done():
+				return
+			case records <- r:
+			}
+		}
+		errc <- iter.Err()
+	}()
+
+	var (
+		// Records are pushed to partialIter directly, since
+		// underlying iterator is read concurrently.
+		partial = newPartialIter(iter, since, 0)
+		grouper *multilineGrouper
+		ready   []logstorage.Record
+
+		partialTimer <-chan time.Time
+		groupTimer   <-chan time.Time
+	)
+	if opts := i.q.multiline; opts != nil {
+		grouper = &multilineGrouper{opts: *opts}
+	}
+	for {
+		var closed, flushGroups bool
+		select {
+		case <-i.ctx.Done():
+			return nil
+		case r, ok := <-records:
+			if !ok {
+				closed, flushGroups = true, true
+				partial.flush()
+				break
+			}
+			partial.push(r)
+		case <-partialTimer:
+			// Do not hold back records of followed log for too long.
+			partial.flush()
+			partialTimer = nil
+		case <-groupTimer:
+			flushGroups = true
+		}
+
+		ready = ready[:0]
+		var r logstorage.Record
+		for partial.pop(&r) {
+			if grouper != nil {
+				ready = grouper.Push(r, ready)
+			} else {
+				ready = append(ready, r)
+			}
+		}
+		if grouper != nil && flushGroups {
+			ready = grouper.Flush(ready)
+		}
+		for _, r := range ready {
+			if !i.send(r) {
+				return nil
+			}
+		}
+
+		if closed {
+			select {
+			case err := <-errc:
+				return err
+			default:
+				// Reader is stopped by cancellation.
+				return nil
+			}
+		}
+		switch {
+		case !partial.queued():
+			partialTimer = nil
+		case partialTimer == nil:
+			// Timer is not reset by new records, since incomplete message
+			// holds back records of the other stream too.
+			partialTimer = time.After(partialTimeout)
+		}
+		groupTimer = nil
+		if grouper != nil && grouper.Pending() {
+			groupTimer = time.After(grouper.opts.Timeout)
+		}
+	}
+}
+
+// send sends record to the iterator consumer.
+//
+// Returns false, if iterator is closed.
+func (i *tailIter) send(r logstorage.Record) bool {
+	select {
+	case <-i.ctx.Done():
+		return false
+	case i.records <- r:
+		return true
+	}
+}
+
+// fail saves given error and stops iteration.
+func (i *tailIter) fail(err error) {
+	if i.ctx.Err() != nil {
+		// Iterator is closed, error is likely caused by cancellation.
+		return
+	}
+
+	i.mux.Lock()
+	if i.err == nil {
+		i.err = err
+	}
+	i.mux.Unlock()
+	i.cancel()
+}
+
+// Next returns true, if there is element and fills t.
+func (i *tailIter) Next(r *logstorage.Record) bool {
+	select {
+	case <-i.ctx.Done():
+		return false
+	case *r = <-i.records:
+		return true
+	}
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *tailIter) Err() error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.err
+}
+
+// Close closes iterator.
+func (i *tailIter) Close() error {
+	i.cancel()
+	i.wg.Wait()
+	return nil
+}
@@ -0,0 +1,165 @@
+package dockerlog
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	apicontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+func TestTailLogs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "running", Labels: map[string]string{"app": "test"}},
+				{ID: "2", Names: []string{"/worker"}, State: "exited", Labels: map[string]string{"app": "test"}},
+				{ID: "3", Names: []string{"/db"}, State: "running"},
+			},
+			logs: map[string][]logLine{
+				"1": {{typ: stdout, ts: ts, line: "api started\n"}},
+				"2": {{typ: stdout, ts: ts, line: "worker stopped\n"}},
+				"3": {{typ: stdout, ts: ts, line: "db started\n"}},
+				"4": {{typ: stderr, ts: ts.Add(time.Second), line: "cron started\n"}},
+			},
+			events: make(chan events.Message),
+		},
+	}
+	q, err := NewQuerier(c, Options{})
+	require.NoError(t, err)
+
+	iter, err := q.TailLogs(ctx, otelstorage.NewTimestampFromTime(ts), logqlengine.SelectLogsParams{
+		Labels: []logql.LabelMatcher{
+			{Label: "app", Op: logql.OpEq, Value: "test"},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, iter.Close())
+	}()
+
+	var (
+		r   logstorage.Record
+		got []string
+	)
+	require.True(t, iter.Next(&r))
+	got = append(got, r.Body)
+	c.Inspected()
+
+	// Start a new container.
+	c.containers = append(c.containers, types.Container{
+		ID: "4", Names: []string{"/cron"}, State: "running", Labels: map[string]string{"app": "test"},
+	})
+	c.events <- events.Message{
+		Type:     events.ContainerEventType,
+		Action:   events.ActionStart,
+		Actor:    events.Actor{ID: "4"},
+		TimeNano: ts.UnixNano(),
+	}
+
+	require.True(t, iter.Next(&r))
+	got = append(got, r.Body)
+	require.NoError(t, iter.Err())
+
+	sort.Strings(got)
+	require.Equal(t, []string{"api started\n", "cron started\n"}, got)
+
+	name, _ := r.ResourceAttrs.AsMap().Get("container")
+	require.Equal(t, "cron", name.Str())
+	// Only started container is inspected.
+	require.Equal(t, []string{"4"}, c.Inspected())
+}
+
+func TestTailLogsNewRecords(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &queryRecorder{
+		mockClient: &mockClient{
+			containers: []types.Container{
+				{ID: "1", Names: []string{"/api"}, State: "running"},
+			},
+			logs: map[string][]logLine{
+				"1": {{typ: stdout, ts: ts, line: "api started\n"}},
+			},
+			events: make(chan events.Message),
+		},
+	}
+	q, err := NewQuerier(c, Options{})
+	require.NoError(t, err)
+
+	iter, err := q.TailLogs(ctx, 0, logqlengine.SelectLogsParams{})
+	require.NoError(t, err)
+
+	// Wait until log is requested.
+	var queries []apicontainer.LogsOptions
+	for len(queries) == 0 {
+		require.NoError(t, ctx.Err())
+		queries = c.Reset()
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, iter.Close())
+
+	require.Equal(t, []apicontainer.LogsOptions{
+		{
+			ShowStdout: true,
+			ShowStderr: true,
+			Timestamps: true,
+			Follow:     true,
+			// History is not requested.
+			Tail: "0",
+		},
+	}, queries)
+}
+
+func TestTailLogsIncompleteMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ts := time.Unix(1700000000, 0).UTC()
+	c := &mockClient{
+		containers: []types.Container{
+			{ID: "1", Names: []string{"/api"}, State: "running"},
+		},
+		logs: map[string][]logLine{
+			"1": {
+				// Rest of the message is never written.
+				{typ: stdout, ts: ts, line: "long "},
+				{typ: stderr, ts: ts.Add(time.Second), line: "error\n"},
+			},
+		},
+		events: make(chan events.Message),
+	}
+	q, err := NewQuerier(c, Options{})
+	require.NoError(t, err)
+
+	iter, err := q.TailLogs(ctx, otelstorage.NewTimestampFromTime(ts), logqlengine.SelectLogsParams{})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, iter.Close())
+	}()
+
+	var (
+		r   logstorage.Record
+		got []string
+	)
+	for len(got) < 2 && iter.Next(&r) {
+		got = append(got, r.Body)
+	}
+	require.NoError(t, iter.Err())
+	require.Equal(t, []string{"long ", "error\n"}, got)
+}
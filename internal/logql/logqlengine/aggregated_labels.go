@@ -3,6 +3,8 @@ package logqlengine
 import (
 	"maps"
 	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/cespare/xxhash/v2"
 	"go.opentelemetry.io/collector/pdata/pcommon"
@@ -31,6 +33,8 @@ func newAggregatedLabels(set LabelSet, by, without map[string]struct{}) *aggrega
 			value: v.AsString(),
 		})
 	})
+	// Keep entries sorted to compute the same key for the same set.
+	slices.SortFunc(labels, compareEntries)
 
 	return &aggregatedLabels{
 		entries: labels,
@@ -45,10 +49,19 @@ func (a *aggregatedLabels) By(labels ...logql.Label) logqlmetric.AggregatedLabel
 		return a
 	}
 
+	by := buildSet(nil, labels...)
+	if a.by != nil {
+		// Keep only labels present in both sets.
+		maps.DeleteFunc(by, func(k string, _ struct{}) bool {
+			_, ok := a.by[k]
+			return !ok
+		})
+	}
+
 	sub := &aggregatedLabels{
 		entries: a.entries,
 		without: a.without,
-		by:      buildSet(maps.Clone(a.by), labels...),
+		by:      by,
 	}
 	return sub
 }
@@ -79,7 +92,9 @@ func (a *aggregatedLabels) Key() logqlmetric.GroupingKey {
 
 // Replace replaces labels using given regexp.
 func (a *aggregatedLabels) Replace(dstLabel, replacement, srcLabel string, re *regexp.Regexp) logqlmetric.AggregatedLabels {
-	src := a.findEntry(srcLabel)
+	// Do not modify the set in place, it may be shared with other samples.
+	r := a.materialize(len(a.entries) + 1)
+	src := r.findEntry(srcLabel)
 
 	idxs := re.FindStringSubmatchIndex(src)
 	if idxs == nil {
@@ -89,12 +104,26 @@ func (a *aggregatedLabels) Replace(dstLabel, replacement, srcLabel string, re *r
 	dst := re.ExpandString(nil, replacement, src, idxs)
 	if len(dst) == 0 {
 		// Destination value is empty, delete it.
-		a.deleteEntry(dstLabel)
+		r.deleteEntry(dstLabel)
 	} else {
-		a.setEntry(dstLabel, string(dst))
+		r.setEntry(dstLabel, string(dst))
 	}
 
-	return a
+	return r
+}
+
+// materialize returns a copy of set without by/without filters.
+func (a *aggregatedLabels) materialize(capacity int) *aggregatedLabels {
+	r := &aggregatedLabels{
+		entries: make([]labelEntry, 0, capacity),
+	}
+	a.forEach(func(k, v string) {
+		r.entries = append(r.entries, labelEntry{
+			name:  k,
+			value: v,
+		})
+	})
+	return r
 }
 
 func (a *aggregatedLabels) findEntry(key string) string {
@@ -132,12 +161,33 @@ func (a *aggregatedLabels) setEntry(key, value string) {
 		value: value,
 	}
 	if entry == nil {
-		a.entries = append(a.entries, replacement)
+		idx, _ := slices.BinarySearchFunc(a.entries, replacement, compareEntries)
+		a.entries = slices.Insert(a.entries, idx, replacement)
 	} else {
 		*entry = replacement
 	}
 }
 
+// Include returns new set of labels with given list of labels copied from other set.
+//
+// Label is deleted, if other set does not have it.
+func (a *aggregatedLabels) Include(other logqlmetric.AggregatedLabels, labels ...logql.Label) logqlmetric.AggregatedLabels {
+	if len(labels) == 0 {
+		return a
+	}
+	values := other.By(labels...).AsLokiAPI()
+
+	r := a.materialize(len(a.entries) + len(labels))
+	for _, l := range labels {
+		if v, ok := values[string(l)]; ok {
+			r.setEntry(string(l), v)
+		} else {
+			r.deleteEntry(string(l))
+		}
+	}
+	return r
+}
+
 // AsLokiAPI returns API structure for label set.
 func (a *aggregatedLabels) AsLokiAPI() (r lokiapi.LabelSet) {
 	r = lokiapi.LabelSet{}
@@ -152,7 +202,7 @@ func (a *aggregatedLabels) forEach(cb func(k, v string)) {
 		if _, ok := a.without[e.name]; ok {
 			continue
 		}
-		if len(a.by) > 0 {
+		if a.by != nil {
 			if _, ok := a.by[e.name]; !ok {
 				continue
 			}
@@ -161,6 +211,10 @@ func (a *aggregatedLabels) forEach(cb func(k, v string)) {
 	}
 }
 
+func compareEntries(a, b labelEntry) int {
+	return strings.Compare(a.name, b.name)
+}
+
 func buildSet[K ~string](r map[string]struct{}, input ...K) map[string]struct{} {
 	if len(input) == 0 {
 		return r
@@ -2,6 +2,7 @@ package logqlengine
 
 import (
 	"fmt"
+	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -127,3 +128,57 @@ func TestAggregatedLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestAggregatedLabelsInclude(t *testing.T) {
+	newLabels := func(m map[string]string) *aggregatedLabels {
+		set := newLabelSet()
+		for k, v := range m {
+			set.Set(logql.Label(k), pcommon.NewValueStr(v))
+		}
+		return newAggregatedLabels(set, nil, nil)
+	}
+
+	left := newLabels(map[string]string{
+		"container": "a",
+		"level":     "error",
+		"host":      "old",
+	})
+	right := newLabels(map[string]string{
+		"container": "a",
+		"host":      "h1",
+	})
+
+	got := left.By("container", "level").Include(right, "host", "missing")
+	require.Equal(t, map[string]string{
+		"container": "a",
+		"level":     "error",
+		"host":      "h1",
+	}, map[string]string(got.AsLokiAPI()))
+
+	got = left.Include(right, "level")
+	require.Equal(t, map[string]string{
+		"container": "a",
+		"host":      "old",
+	}, map[string]string(got.AsLokiAPI()))
+
+	// Subsequent By keeps only labels present in both lists.
+	got = left.By("container", "level").By("container", "host")
+	require.Equal(t, map[string]string{
+		"container": "a",
+	}, map[string]string(got.AsLokiAPI()))
+
+	// Replace does not modify the original set.
+	got = left.Replace("container", "x$1", "container", regexp.MustCompile("(.*)"))
+	require.Equal(t, "xa", got.AsLokiAPI()["container"])
+	require.Equal(t, "a", left.AsLokiAPI()["container"])
+
+	// Key does not depend on the way the set is built.
+	require.Equal(t,
+		newLabels(map[string]string{
+			"container": "a",
+			"level":     "error",
+			"host":      "h1",
+		}).Key(),
+		left.Without("host").Include(right, "host").Key(),
+	)
+}
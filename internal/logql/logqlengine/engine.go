@@ -4,6 +4,7 @@ package logqlengine
 import (
 	"context"
 	"fmt"
+	"runtime"
 	"strconv"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 
 	"github.com/go-faster/errors"
 
+	"github.com/tdakkota/docker-logql/internal/iterators"
 	"github.com/tdakkota/docker-logql/internal/logql"
 	"github.com/tdakkota/docker-logql/internal/logql/logqlengine/logqlmetric"
 	"github.com/tdakkota/docker-logql/internal/lokiapi"
@@ -26,6 +28,8 @@ type Engine struct {
 
 	lookbackDuration time.Duration
 	parseOpts        logql.ParseOptions
+	splitInterval    time.Duration
+	splitParallelism int
 
 	tracer trace.Tracer
 }
@@ -40,6 +44,17 @@ type Options struct {
 	// ParseOptions is a LogQL parser options.
 	ParseOptions logql.ParseOptions
 
+	// SplitInterval sets length of time shards range metric query is split into.
+	//
+	// Shards are evaluated in parallel. Only aggregations which results could be merged,
+	// like count_over_time or max_over_time, are split.
+	// If zero, queries are not split.
+	SplitInterval time.Duration
+	// SplitParallelism is a maximum number of time shards evaluated concurrently.
+	//
+	// Defaults to GOMAXPROCS.
+	SplitParallelism int
+
 	// TracerProvider provides OpenTelemetry tracer for this engine.
 	TracerProvider trace.TracerProvider
 }
@@ -48,6 +63,9 @@ func (o *Options) setDefaults() {
 	if o.LookbackDuration >= 0 {
 		o.LookbackDuration = -30 * time.Second
 	}
+	if o.SplitParallelism <= 0 {
+		o.SplitParallelism = runtime.GOMAXPROCS(0)
+	}
 	if o.TracerProvider == nil {
 		o.TracerProvider = otel.GetTracerProvider()
 	}
@@ -62,6 +80,8 @@ func NewEngine(querier Querier, opts Options) *Engine {
 		querierCaps:      querier.Capabilities(),
 		lookbackDuration: opts.LookbackDuration,
 		parseOpts:        opts.ParseOptions,
+		splitInterval:    opts.SplitInterval,
+		splitParallelism: opts.SplitParallelism,
 		tracer:           opts.TracerProvider.Tracer("logql.Engine"),
 	}
 }
@@ -72,7 +92,10 @@ type EvalParams struct {
 	End       otelstorage.Timestamp
 	Step      time.Duration
 	Direction string // forward, backward
-	Limit     int
+	// Limit is a maximum number of entries to return.
+	//
+	// Forward direction returns the oldest entries, backward returns the newest ones.
+	Limit int
 }
 
 // IsInstant whether query is instant.
@@ -108,6 +131,10 @@ func (e *Engine) Eval(ctx context.Context, query string, params EvalParams) (dat
 		span.End()
 	}()
 
+	if err := validateDirection(params.Direction); err != nil {
+		return data, err
+	}
+
 	expr, err := logql.Parse(query, e.parseOpts)
 	if err != nil {
 		return data, errors.Wrap(err, "parse")
@@ -116,6 +143,58 @@ func (e *Engine) Eval(ctx context.Context, query string, params EvalParams) (dat
 	return e.evalExpr(ctx, expr, params)
 }
 
+// EvalStream parses and evaluates log query, returning entries one by one.
+//
+// Entries are returned in timestamp order, from the newest to the oldest
+// if direction is backward. Forward evaluation keeps a single entry in memory,
+// backward evaluation keeps up to limit entries.
+func (e *Engine) EvalStream(ctx context.Context, query string, params EvalParams) (_ iterators.Iterator[Entry], rerr error) {
+	ctx, span := e.tracer.Start(ctx, "EvalStream",
+		trace.WithAttributes(
+			attribute.String("logql.query", query),
+			attribute.Int64("logql.start", int64(params.Start)),
+			attribute.Int64("logql.end", int64(params.End)),
+			attribute.String("logql.direction", params.Direction),
+			attribute.Int("logql.limit", params.Limit),
+		),
+	)
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	if err := validateDirection(params.Direction); err != nil {
+		return nil, err
+	}
+
+	expr, err := logql.Parse(query, e.parseOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse")
+	}
+
+	logExpr, ok := logql.UnparenExpr(expr).(*logql.LogExpr)
+	if !ok {
+		return nil, errors.Errorf("streaming evaluation requires a log query, got %T", expr)
+	}
+
+	iter, err := e.streamLogExpr(ctx, logExpr, params)
+	if err != nil {
+		return nil, errors.Wrap(err, "evaluate log query")
+	}
+	return &resultIterator{iter: iter}, nil
+}
+
+func validateDirection(dir string) error {
+	switch lokiapi.Direction(dir) {
+	case "", lokiapi.DirectionForward, lokiapi.DirectionBackward:
+		return nil
+	default:
+		return errors.Errorf("invalid direction %q", dir)
+	}
+}
+
 func (e *Engine) evalExpr(ctx context.Context, expr logql.Expr, params EvalParams) (data lokiapi.QueryResponseData, _ error) {
 	ctx, span := e.tracer.Start(ctx, "evalExpr",
 		trace.WithAttributes(
@@ -137,11 +216,35 @@ func (e *Engine) evalExpr(ctx context.Context, expr logql.Expr, params EvalParam
 	case *logql.LiteralExpr:
 		return e.evalLiteral(expr, params), nil
 	case logql.MetricExpr:
-		iter, err := logqlmetric.Build(expr, e.sampleSelector(ctx, params), logqlmetric.EvalParams{
-			Start: params.Start.AsTime(),
-			End:   params.End.AsTime(),
-			Step:  params.Step,
-		})
+		if binOp, ok := expr.(*logql.BinOpExpr); ok {
+			// Constant expression, e.g. "2 * 3", evaluates to scalar.
+			lit, err := logql.ReduceBinOp(binOp)
+			if err != nil {
+				return data, errors.Wrap(err, "reduce binary operation")
+			}
+			if lit != nil {
+				return e.evalLiteral(lit, params), nil
+			}
+		}
+
+		var (
+			sel     = e.sampleSelector(params)
+			mparams = logqlmetric.EvalParams{
+				Start: params.Start.AsTime(),
+				End:   params.End.AsTime(),
+				Step:  params.Step,
+			}
+		)
+		if e.splitInterval > 0 && !params.IsInstant() {
+			s := &rangeSplitter{
+				sel:         sel,
+				interval:    e.splitInterval,
+				parallelism: e.splitParallelism,
+			}
+			mparams.Split = s.Split
+		}
+
+		iter, err := logqlmetric.Build(ctx, expr, sel, mparams)
 		if err != nil {
 			return data, errors.Wrap(err, "build metric query")
 		}
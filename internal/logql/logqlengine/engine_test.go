@@ -2,16 +2,22 @@
 package logqlengine
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"golang.org/x/exp/maps"
 
 	"github.com/tdakkota/docker-logql/internal/iterators"
 	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine/logqlmetric"
 	"github.com/tdakkota/docker-logql/internal/logstorage"
 	"github.com/tdakkota/docker-logql/internal/lokiapi"
 	"github.com/tdakkota/docker-logql/internal/otelstorage"
@@ -30,13 +36,24 @@ type resultLine struct {
 type mockQuerier struct {
 	lines []inputLine
 	step  time.Duration
+
+	mux sync.Mutex
+	// params is a last SelectLogs params.
+	params SelectLogsParams
+	// calls is a number of SelectLogs calls.
+	calls int
 }
 
 func (m *mockQuerier) Capabilities() (caps QuerierCapabilities) {
 	return caps
 }
 
-func (m *mockQuerier) SelectLogs(_ context.Context, start, _ otelstorage.Timestamp, _ SelectLogsParams) (iterators.Iterator[logstorage.Record], error) {
+func (m *mockQuerier) SelectLogs(_ context.Context, start, _ otelstorage.Timestamp, params SelectLogsParams) (iterators.Iterator[logstorage.Record], error) {
+	m.mux.Lock()
+	m.params = params
+	m.calls++
+	m.mux.Unlock()
+
 	step := m.step
 	if step == 0 {
 		step = time.Millisecond
@@ -226,6 +243,28 @@ func TestEngineEvalLiteral(t *testing.T) {
 		},
 		test3steps(`vector(3.14)`, "3.14"),
 
+		// Constant folding.
+		{
+			`(2 * 3) + ((1))`,
+			timeRange{
+				start: 1700000001_000000000,
+				end:   1700000001_000000000,
+			},
+			lokiapi.QueryResponseData{
+				Type: lokiapi.ScalarResultQueryResponseData,
+				ScalarResult: lokiapi.ScalarResult{
+					Result: lokiapi.FPoint{
+						T: 1700000001,
+						V: "7",
+					},
+				},
+			},
+			false,
+		},
+		test3steps(`2 ^ 3 - 1`, "7"),
+		test3steps(`vector(2) * (1 + 2)`, "6"),
+		test3steps(`label_replace(vector(2), "dst", "$1", "src", "(.*)")`, "2"),
+
 		// Precedence tests.
 		test3steps(`vector(2)+vector(3)*vector(4)`, "14"),
 		test3steps(`vector(2)*vector(3)+vector(4)`, "10"),
@@ -261,3 +300,379 @@ func TestEngineEvalLiteral(t *testing.T) {
 		})
 	}
 }
+
+func TestEngineEvalDirection(t *testing.T) {
+	lines := justLines("1", "2", "3", "4", "5")
+
+	tests := []struct {
+		query     string
+		direction string
+		limit     int
+		want      []string
+		wantTail  int
+	}{
+		{`{}`, "", 2, []string{"1", "2"}, 0},
+		{`{}`, "forward", 2, []string{"1", "2"}, 0},
+		{`{}`, "backward", 2, []string{"5", "4"}, 2},
+		{`{}`, "backward", 0, []string{"5", "4", "3", "2", "1"}, 0},
+		{`{} | line_format "{{ __line__ }}"`, "backward", 3, []string{"5", "4", "3"}, 3},
+		// Filter could drop records, so querier should return all of them.
+		{`{} != "5"`, "backward", 2, []string{"4", "3"}, 0},
+		{`{} | json | x = ""`, "backward", 1, []string{"5"}, 0},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			ctx := context.Background()
+
+			q := &mockQuerier{lines: lines}
+			e := NewEngine(q, Options{})
+
+			data, err := e.Eval(ctx, tt.query, EvalParams{
+				Start:     1,
+				End:       1,
+				Step:      time.Millisecond,
+				Direction: tt.direction,
+				Limit:     tt.limit,
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantTail, q.params.Tail)
+
+			streams, ok := data.GetStreamsResult()
+			require.True(t, ok)
+
+			// Every line is a separate stream, merge them.
+			var entries []lokiapi.LogEntry
+			for _, s := range streams.Result {
+				entries = append(entries, s.Values...)
+			}
+			slices.SortFunc(entries, func(a, b lokiapi.LogEntry) int {
+				if tt.direction == "backward" {
+					return cmp.Compare(b.T, a.T)
+				}
+				return cmp.Compare(a.T, b.T)
+			})
+
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.V)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		ctx := context.Background()
+		e := NewEngine(&mockQuerier{lines: lines}, Options{})
+
+		_, err := e.Eval(ctx, `{}`, EvalParams{Direction: "sideways"})
+		require.Error(t, err)
+	})
+}
+
+func TestEngineEvalStream(t *testing.T) {
+	lines := justLines("1", "2", "3", "4", "5")
+
+	tests := []struct {
+		query     string
+		direction string
+		limit     int
+		want      []string
+	}{
+		{`{}`, "", 0, []string{"1", "2", "3", "4", "5"}},
+		{`{}`, "forward", 2, []string{"1", "2"}},
+		{`{}`, "backward", 2, []string{"5", "4"}},
+		{`{}`, "backward", 0, []string{"5", "4", "3", "2", "1"}},
+		{`{} != "5" | line_format "line {{ __line__ }}"`, "backward", 2, []string{"line 4", "line 3"}},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			ctx := context.Background()
+			e := NewEngine(&mockQuerier{lines: lines}, Options{})
+
+			iter, err := e.EvalStream(ctx, tt.query, EvalParams{
+				Start:     1,
+				End:       1,
+				Step:      time.Millisecond,
+				Direction: tt.direction,
+				Limit:     tt.limit,
+			})
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, iter.Close())
+			}()
+
+			var (
+				entry Entry
+				got   []string
+				last  otelstorage.Timestamp
+			)
+			for iter.Next(&entry) {
+				if last != 0 {
+					if tt.direction == "backward" {
+						require.Less(t, entry.Timestamp, last)
+					} else {
+						require.Greater(t, entry.Timestamp, last)
+					}
+				}
+				last = entry.Timestamp
+
+				require.Equal(t, "test", entry.Labels["resource"])
+				got = append(got, entry.Line)
+			}
+			require.NoError(t, iter.Err())
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("MetricQuery", func(t *testing.T) {
+		ctx := context.Background()
+		e := NewEngine(&mockQuerier{lines: lines}, Options{})
+
+		_, err := e.EvalStream(ctx, `count_over_time({}[5m])`, EvalParams{})
+		require.Error(t, err)
+	})
+}
+
+func TestEngineEvalPipelineErrors(t *testing.T) {
+	lines := justLines(
+		`{"n": "1"}`,
+		`not json`,
+		`{"n": "abc"}`,
+	)
+	ts := otelstorage.NewTimestampFromTime(time.Unix(1700000000, 0))
+
+	tests := []struct {
+		query   string
+		want    string
+		wantErr string
+	}{
+		{`sum by (resource) (count_over_time({} | json [2m]))`, "", JSONParserErr},
+		{`sum by (resource) (count_over_time({} | json | __error__="" [2m]))`, "2", ""},
+		{`sum by (resource) (count_over_time({} | json | __error__!="JSONParserErr" [2m]))`, "2", ""},
+		{`sum by (resource) (count_over_time({} | json | drop __error__, __error_details__ [2m]))`, "3", ""},
+		// Line without label is skipped by unwrap, so conversion error is the first one.
+		{`sum by (resource) (sum_over_time({} | json | unwrap n [2m]))`, "", SampleExtractionErr},
+		{`sum by (resource) (sum_over_time({} | json | unwrap n | __error__="" [2m]))`, "1", ""},
+		{`sum by (resource) (count_over_time({} | json | n > 0 [2m]))`, "", LabelFilterErr},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			ctx := context.Background()
+			// Put lines into range of instant query.
+			e := NewEngine(&mockQuerier{lines: lines, step: 40 * time.Second}, Options{})
+
+			data, err := e.Eval(ctx, tt.query, EvalParams{
+				Start: ts,
+				End:   ts,
+			})
+			if tt.wantErr != "" {
+				var perr *PipelineError
+				require.ErrorAs(t, err, &perr)
+				require.Equal(t, tt.wantErr, perr.Type)
+				require.NotEmpty(t, perr.Details)
+				return
+			}
+			require.NoError(t, err)
+
+			vector, ok := data.GetVectorResult()
+			require.True(t, ok)
+			require.Len(t, vector.Result, 1)
+			require.Equal(t, tt.want, vector.Result[0].Value.V)
+		})
+	}
+
+	t.Run("LogQuery", func(t *testing.T) {
+		ctx := context.Background()
+		e := NewEngine(&mockQuerier{lines: lines}, Options{})
+
+		data, err := e.Eval(ctx, `{} | json`, EvalParams{
+			Start: ts,
+			End:   ts,
+		})
+		require.NoError(t, err)
+
+		streams, ok := data.GetStreamsResult()
+		require.True(t, ok)
+
+		errors := map[string]string{}
+		for _, s := range streams.Result {
+			for _, e := range s.Values {
+				errors[e.V] = s.Stream.Value[logql.ErrorLabel]
+			}
+		}
+		require.Equal(t, map[string]string{
+			`{"n": "1"}`:   "",
+			`not json`:     JSONParserErr,
+			`{"n": "abc"}`: "",
+		}, errors)
+	})
+}
+
+func TestEngineEvalVectorMatching(t *testing.T) {
+	lines := justLines(
+		`{"container": "a", "level": "error"}`,
+		`{"container": "a", "level": "info"}`,
+		`{"container": "b", "level": "error"}`,
+		`{"container": "b", "level": "info"}`,
+		`{"container": "b", "level": "info"}`,
+	)
+	ts := otelstorage.NewTimestampFromTime(time.Unix(1700000000, 0))
+
+	tests := []struct {
+		query string
+		want  map[string]string
+	}{
+		{
+			`sum by (container) (count_over_time({} | json | level="error" [3m]))
+				/ on(container)
+			sum by (container) (count_over_time({} | json [3m]))`,
+			map[string]string{
+				`{container="a"}`: "0.5",
+				`{container="b"}`: "0.3333333333333333",
+			},
+		},
+		{
+			`sum by (container, level) (count_over_time({} | json [3m]))
+				/ on(container) group_left
+			sum by (container) (count_over_time({} | json [3m]))`,
+			map[string]string{
+				`{container="a", level="error"}`: "0.5",
+				`{container="a", level="info"}`:  "0.5",
+				`{container="b", level="error"}`: "0.3333333333333333",
+				`{container="b", level="info"}`:  "0.6666666666666666",
+			},
+		},
+		{
+			`sum by (container, level) (count_over_time({} | json [3m]))
+				> bool ignoring(level)
+			sum by (container) (count_over_time({} | json | level="error" [3m]))`,
+			nil,
+		},
+		{
+			// Duplicate matches are filtered out by comparison, but still not allowed.
+			`sum by (container, level) (count_over_time({} | json [3m]))
+				> ignoring(level)
+			sum by (container) (count_over_time({} | json | level="error" [3m]))`,
+			nil,
+		},
+		{
+			`sum by (container, level) (count_over_time({} | json [3m]))
+				> bool ignoring(level) group_left
+			sum by (container) (count_over_time({} | json | level="error" [3m]))`,
+			map[string]string{
+				`{container="a", level="error"}`: "0",
+				`{container="a", level="info"}`:  "0",
+				`{container="b", level="error"}`: "0",
+				`{container="b", level="info"}`:  "1",
+			},
+		},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			ctx := context.Background()
+			// Put lines into range of instant query.
+			e := NewEngine(&mockQuerier{lines: lines, step: 40 * time.Second}, Options{})
+
+			data, err := e.Eval(ctx, tt.query, EvalParams{
+				Start: ts,
+				End:   ts,
+			})
+			if tt.want == nil {
+				var matchErr *logqlmetric.MatchingError
+				require.ErrorAs(t, err, &matchErr)
+				return
+			}
+			require.NoError(t, err)
+
+			vector, ok := data.GetVectorResult()
+			require.True(t, ok)
+
+			got := map[string]string{}
+			for _, s := range vector.Result {
+				got[formatLabelSet(s.Metric.Value)] = s.Value.V
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func formatLabelSet(set lokiapi.LabelSet) string {
+	keys := maps.Keys(set)
+	slices.Sort(keys)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s=%q", k, set[k])
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func TestEngineEvalSharedScan(t *testing.T) {
+	lines := justLines("a", "bb", "ab", "ccc")
+	ts := otelstorage.NewTimestampFromTime(time.Unix(1700000000, 0))
+
+	tests := []struct {
+		query     string
+		want      string
+		wantCalls int
+	}{
+		{
+			`sum by (resource) (count_over_time({} [3m])) / sum by (resource) (count_over_time({} [3m]))`,
+			"1",
+			1,
+		},
+		// Samples are extracted from the same scan differently.
+		{
+			`sum by (resource) (bytes_over_time({} |~ "a.*" [3m])) / sum by (resource) (count_over_time({} |~ "a.*" [3m]))`,
+			"1.5",
+			1,
+		},
+		{
+			`(sum by (resource) (count_over_time({} [3m])) - sum by (resource) (count_over_time({} [3m]))) + sum by (resource) (count_over_time({} [3m]))`,
+			"4",
+			1,
+		},
+		// Different pipelines.
+		{
+			`sum by (resource) (count_over_time({} |= "a" [3m])) / sum by (resource) (count_over_time({} [3m]))`,
+			"0.5",
+			2,
+		},
+		// Different ranges.
+		{
+			`sum by (resource) (count_over_time({} [3m])) / sum by (resource) (count_over_time({} [4m]))`,
+			"1",
+			2,
+		},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			ctx := context.Background()
+			// Put lines into range of instant query.
+			q := &mockQuerier{lines: lines, step: 40 * time.Second}
+			e := NewEngine(q, Options{})
+
+			data, err := e.Eval(ctx, tt.query, EvalParams{
+				Start: ts,
+				End:   ts,
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCalls, q.calls)
+
+			vector, ok := data.GetVectorResult()
+			require.True(t, ok)
+			require.Len(t, vector.Result, 1)
+			require.Equal(t, tt.want, vector.Result[0].Value.V)
+		})
+	}
+}
@@ -1,5 +1,11 @@
 package logqlengine
 
+import (
+	"fmt"
+
+	"github.com/tdakkota/docker-logql/internal/logql"
+)
+
 // UnsupportedError is an error that reports unsupported expressions.
 type UnsupportedError struct {
 	Msg string
@@ -9,3 +15,38 @@ type UnsupportedError struct {
 func (e *UnsupportedError) Error() string {
 	return e.Msg
 }
+
+// Error label values, compatible with Loki.
+const (
+	// JSONParserErr is set by json and unpack parsers, if line is not a valid JSON object.
+	JSONParserErr = "JSONParserErr"
+	// LogfmtParserErr is set by logfmt parser, if line is not a valid logfmt.
+	LogfmtParserErr = "LogfmtParserErr"
+	// LabelFilterErr is set by label filter, if label value cannot be converted to filter type.
+	LabelFilterErr = "LabelFilterErr"
+	// TemplateFormatErr is set by line_format and label_format, if template execution fails.
+	TemplateFormatErr = "TemplateFormatErr"
+	// SampleExtractionErr is set by unwrap, if label value cannot be converted to sample.
+	SampleExtractionErr = "SampleExtractionErr"
+)
+
+// PipelineError is returned by metric query, if a log pipeline error is not handled.
+type PipelineError struct {
+	// Type is an error type, value of [logql.ErrorLabel].
+	Type string
+	// Details is an error details, value of [logql.ErrorDetailsLabel].
+	Details string
+	// Series is a label set of entry that caused the error.
+	Series string
+}
+
+// Error implements error.
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("pipeline error: %q (%s) for series %s: "+
+		"use a label filter to skip this error (e.g. | %s!=%q), or "+
+		"to skip all errors (e.g. | %s=\"\"), it can be specified after unwrap too",
+		e.Type, e.Details, e.Series,
+		logql.ErrorLabel, e.Type,
+		logql.ErrorLabel,
+	)
+}
@@ -2,6 +2,7 @@ package logqlengine
 
 import (
 	"cmp"
+	"container/heap"
 	"context"
 	"slices"
 
@@ -72,6 +73,10 @@ type selectLogsParams struct {
 	Start, End otelstorage.Timestamp
 	Instant    bool
 	Limit      int
+	// Backward is true, if the newest entries should be selected.
+	//
+	// Iterator does not apply limit in this case, caller should keep the newest entries.
+	Backward bool
 }
 
 func (e *Engine) selectLogs(ctx context.Context, sel logql.Selector, stages []logql.PipelineStage, params selectLogsParams) (*entryIterator, error) {
@@ -80,14 +85,19 @@ func (e *Engine) selectLogs(ctx context.Context, sel logql.Selector, stages []lo
 		params.Start = addDuration(params.Start, e.lookbackDuration)
 	}
 
-	cond, err := extractQueryConditions(e.querierCaps, sel, stages)
+	cond, pipeline, err := e.buildLogPipeline(sel, stages)
 	if err != nil {
-		return nil, errors.Wrap(err, "extract preconditions")
+		return nil, err
 	}
 
-	pipeline, err := BuildPipeline(stages...)
-	if err != nil {
-		return nil, errors.Wrap(err, "build pipeline")
+	limit := params.Limit
+	if params.Backward {
+		if limit > 0 && cond.prefilter == NopProcessor && keepsAllEntries(stages) {
+			// Every selected record becomes an entry, so the querier
+			// can return only the newest ones.
+			cond.params.Tail = limit
+		}
+		limit = 0
 	}
 
 	iter, err := e.querier.SelectLogs(ctx,
@@ -104,27 +114,80 @@ func (e *Engine) selectLogs(ctx context.Context, sel logql.Selector, stages []lo
 		prefilter: cond.prefilter,
 		pipeline:  pipeline,
 		entries:   0,
-		limit:     params.Limit,
+		limit:     limit,
 	}, nil
 }
 
+// keepsAllEntries returns true, if given pipeline stages never drop entries.
+func keepsAllEntries(stages []logql.PipelineStage) bool {
+	for _, stage := range stages {
+		switch stage.(type) {
+		case *logql.JSONExpressionParser,
+			*logql.LogfmtExpressionParser,
+			*logql.RegexpLabelParser,
+			*logql.PatternLabelParser,
+			*logql.UnpackLabelParser,
+			*logql.LineFormat,
+			*logql.DecolorizeExpr,
+			*logql.LabelFormatExpr,
+			*logql.DropLabelsExpr,
+			*logql.KeepLabelsExpr:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) buildLogPipeline(sel logql.Selector, stages []logql.PipelineStage) (cond queryConditions, pipeline Processor, _ error) {
+	cond, err := extractQueryConditions(e.querierCaps, sel, stages)
+	if err != nil {
+		return cond, nil, errors.Wrap(err, "extract preconditions")
+	}
+
+	pipeline, err = BuildPipeline(stages...)
+	if err != nil {
+		return cond, nil, errors.Wrap(err, "build pipeline")
+	}
+	return cond, pipeline, nil
+}
+
 func (e *Engine) evalLogExpr(ctx context.Context, expr *logql.LogExpr, params EvalParams) (s lokiapi.Streams, _ error) {
-	iter, err := e.selectLogs(ctx, expr.Sel, expr.Pipeline, selectLogsParams{
-		Start:   params.Start,
-		End:     params.End,
-		Instant: params.IsInstant(),
-		Limit:   params.Limit,
-	})
+	iter, err := e.streamLogExpr(ctx, expr, params)
 	if err != nil {
-		return nil, errors.Wrap(err, "select logs")
+		return nil, err
 	}
 	defer func() {
 		_ = iter.Close()
 	}()
-	return groupEntries(iter)
+	return groupEntries(iter, params.Direction == string(lokiapi.DirectionBackward))
+}
+
+// streamLogExpr returns iterator of log query entries in timestamp order.
+//
+// Entries are ordered from the newest to the oldest, if direction is backward.
+func (e *Engine) streamLogExpr(ctx context.Context, expr *logql.LogExpr, params EvalParams) (iterators.Iterator[entry], error) {
+	backward := params.Direction == string(lokiapi.DirectionBackward)
+	iter, err := e.selectLogs(ctx, expr.Sel, expr.Pipeline, selectLogsParams{
+		Start:    params.Start,
+		End:      params.End,
+		Instant:  params.IsInstant(),
+		Limit:    params.Limit,
+		Backward: backward,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "select logs")
+	}
+	if backward {
+		return &newestIterator{
+			iter:  iter,
+			limit: params.Limit,
+		}, nil
+	}
+	return iter, nil
 }
 
-func groupEntries(iter *entryIterator) (s lokiapi.Streams, _ error) {
+func groupEntries(iter iterators.Iterator[entry], backward bool) (s lokiapi.Streams, _ error) {
 	var (
 		e       entry
 		streams = map[string]lokiapi.Stream{}
@@ -147,9 +210,112 @@ func groupEntries(iter *entryIterator) (s lokiapi.Streams, _ error) {
 
 	result := maps.Values(streams)
 	for _, stream := range result {
-		slices.SortFunc(stream.Values, func(a, b lokiapi.LogEntry) int {
+		// Querier returns records in timestamp order, but
+		// sort entries anyway to not depend on it.
+		slices.SortStableFunc(stream.Values, func(a, b lokiapi.LogEntry) int {
+			if backward {
+				return cmp.Compare(b.T, a.T)
+			}
 			return cmp.Compare(a.T, b.T)
 		})
 	}
 	return result, nil
 }
+
+// newestIterator returns the newest entries from the newest to the oldest.
+//
+// Iterator keeps at most limit entries in memory, every entry, if there is no limit.
+type newestIterator struct {
+	iter  *entryIterator
+	limit int
+
+	entries   []entry
+	collected bool
+}
+
+var _ iterators.Iterator[entry] = (*newestIterator)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *newestIterator) Next(e *entry) bool {
+	if !i.collected {
+		i.collected = true
+		i.collect()
+	}
+	if len(i.entries) == 0 {
+		return false
+	}
+	*e = i.entries[0]
+	i.entries = i.entries[1:]
+	return true
+}
+
+func (i *newestIterator) collect() {
+	var (
+		e      entry
+		newest newestEntries
+	)
+	for i.iter.Next(&e) {
+		full := i.limit > 0 && len(newest) >= i.limit
+		if full && e.ts < newest[0].ts {
+			// Older than every kept entry.
+			continue
+		}
+
+		kept := entry{
+			ts:   e.ts,
+			line: e.line,
+			set:  e.set.clone(),
+		}
+		if full {
+			// Replace the oldest entry.
+			newest[0] = kept
+			heap.Fix(&newest, 0)
+		} else {
+			heap.Push(&newest, kept)
+		}
+	}
+
+	slices.SortStableFunc(newest, func(a, b entry) int {
+		return cmp.Compare(b.ts, a.ts)
+	})
+	i.entries = newest
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *newestIterator) Err() error {
+	return i.iter.Err()
+}
+
+// Close closes iterator.
+func (i *newestIterator) Close() error {
+	return i.iter.Close()
+}
+
+// newestEntries is a min-heap of entries by timestamp.
+type newestEntries []entry
+
+var _ heap.Interface = (*newestEntries)(nil)
+
+func (h newestEntries) Len() int {
+	return len(h)
+}
+
+func (h newestEntries) Less(i, j int) bool {
+	return h[i].ts < h[j].ts
+}
+
+func (h newestEntries) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *newestEntries) Push(x any) {
+	*h = append(*h, x.(entry))
+}
+
+func (h *newestEntries) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
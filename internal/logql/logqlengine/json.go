@@ -63,7 +63,7 @@ func (e *JSONExtractor) Process(_ otelstorage.Timestamp, line string, set LabelS
 		err = extractAll(line, set)
 	}
 	if err != nil {
-		set.SetError("JSON parsing error", err)
+		set.SetError(JSONParserErr, err)
 	}
 	return line, true
 }
@@ -75,7 +75,7 @@ func extractExprs(paths map[logql.Label]jsonexpr.Path, line string, set LabelSet
 		d,
 		paths,
 		func(l logql.Label, s string) {
-			set.Set(l, pcommon.NewValueStr(s))
+			set.setParsed(l, pcommon.NewValueStr(s))
 		},
 	)
 }
@@ -96,7 +96,7 @@ func extractSome(labels map[logql.Label]struct{}, line string, set LabelSet) err
 		// TODO(tdakkota): try string interning
 		// TODO(tdakkota): probably, we can just use label name string
 		// 	instead of allocating a new string every time
-		set.Set(logql.Label(key), value)
+		set.setParsed(logql.Label(key), value)
 		return nil
 	})
 }
@@ -112,7 +112,7 @@ func extractAll(line string, set LabelSet) error {
 			return nil
 		}
 		// TODO(tdakkota): try string interning
-		set.Set(logql.Label(otelstorage.KeyToLabel(key)), value)
+		set.setParsed(logql.Label(otelstorage.KeyToLabel(key)), value)
 		return nil
 	})
 }
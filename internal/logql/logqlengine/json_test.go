@@ -77,6 +77,16 @@ func TestJSONExtractor(t *testing.T) {
 			},
 			false,
 		},
+		// Error labels could be set only by pipeline.
+		{
+			`{"__error__": "fake", "__error_details__": "fake", "foo": "extract"}`,
+			nil,
+			nil,
+			map[logql.Label]pcommon.Value{
+				"foo": pcommon.NewValueStr("extract"),
+			},
+			false,
+		},
 
 		{`{"label": "foo}`, nil, nil, nil, true},
 		{`{"label": "foo}`, []logql.Label{"label"}, nil, nil, true},
@@ -97,8 +107,9 @@ func TestJSONExtractor(t *testing.T) {
 			require.True(t, ok)
 
 			if tt.wantFilterErr {
-				_, ok = set.GetError()
+				typ, ok := set.GetError()
 				require.True(t, ok)
+				require.Equal(t, JSONParserErr, typ)
 				return
 			}
 			errMsg, ok := set.GetError()
@@ -169,7 +169,7 @@ func (lf *DurationLabelFilter[C]) Process(_ otelstorage.Timestamp, line string,
 	labelValue, err := time.ParseDuration(v)
 	if err != nil {
 		// Keep the line, but set error label.
-		set.SetError("duration parsing error", err)
+		set.SetError(LabelFilterErr, err)
 		return line, true
 	}
 
@@ -231,7 +231,7 @@ func (lf *BytesLabelFilter[C]) Process(_ otelstorage.Timestamp, line string, set
 	labelValue, err := humanize.ParseBytes(v)
 	if err != nil {
 		// Keep the line, but set error label.
-		set.SetError("bytes parsing error", err)
+		set.SetError(LabelFilterErr, err)
 		return line, true
 	}
 
@@ -288,7 +288,7 @@ func (lf *NumberLabelFilter[C]) Process(_ otelstorage.Timestamp, line string, se
 	switch val, ok, err := set.GetFloat(lf.name); {
 	case err != nil:
 		// Keep the line, but set error label.
-		set.SetError("number parsing error", err)
+		set.SetError(LabelFilterErr, err)
 		return line, true
 	case !ok:
 		// No such label, skip the line.
@@ -323,7 +323,7 @@ func (lf *IPLabelFilter) Process(_ otelstorage.Timestamp, line string, set Label
 	labelValue, err := netip.ParseAddr(v)
 	if err != nil {
 		// Keep the line, but set error label.
-		set.SetError("ip parsing error", err)
+		set.SetError(LabelFilterErr, err)
 		return line, true
 	}
 
@@ -93,7 +93,7 @@ func (lf *LabelFormat) Process(ts otelstorage.Timestamp, line string, set LabelS
 		lf.buf.Reset()
 
 		if err := p.Template.Execute(lf.buf, m); err != nil {
-			set.SetError("template error", err)
+			set.SetError(TemplateFormatErr, err)
 			continue
 		}
 
@@ -38,6 +38,19 @@ func (l *LabelSet) reset() {
 	maps.Clear(l.labels)
 }
 
+// clone returns a copy of label set.
+func (l *LabelSet) clone() LabelSet {
+	set := LabelSet{
+		labels: make(map[logql.Label]pcommon.Value, len(l.labels)),
+	}
+	for k, v := range l.labels {
+		cv := pcommon.NewValueEmpty()
+		v.CopyTo(cv)
+		set.labels[k] = cv
+	}
+	return set
+}
+
 // AsLokiAPI returns lokiapi.LabelSet
 func (l *LabelSet) AsLokiAPI() lokiapi.LabelSet {
 	return lokiapi.LabelSet(l.AsMap())
@@ -114,6 +127,16 @@ func (l *LabelSet) Set(s logql.Label, val pcommon.Value) {
 	l.labels[s] = val
 }
 
+// setParsed sets label extracted by a parser.
+//
+// Error labels are reserved for pipeline errors, so parser can't set them.
+func (l *LabelSet) setParsed(s logql.Label, val pcommon.Value) {
+	if s == logql.ErrorLabel || s == logql.ErrorDetailsLabel {
+		return
+	}
+	l.labels[s] = val
+}
+
 // Delete deletes label.
 func (l *LabelSet) Delete(s logql.Label) {
 	delete(l.labels, s)
@@ -55,7 +55,7 @@ func (lf *LineFormat) Process(ts otelstorage.Timestamp, line string, set LabelSe
 	lf.buf.Reset()
 
 	if err := lf.tmpl.Execute(lf.buf, set.AsMap()); err != nil {
-		set.SetError("template error", err)
+		set.SetError(TemplateFormatErr, err)
 		return line, true
 	}
 	return lf.buf.String(), true
@@ -50,7 +50,7 @@ func (e *LogfmtExtractor) Process(_ otelstorage.Timestamp, line string, set Labe
 		err = e.extractSome(line, set)
 	}
 	if err != nil {
-		set.SetError("logfmt parsing error", err)
+		set.SetError(LogfmtParserErr, err)
 	}
 	return line, true
 }
@@ -63,7 +63,7 @@ func (e *LogfmtExtractor) extractSome(line string, set LabelSet) error {
 		for d.ScanKeyval() {
 			if label, ok := e.labels[string(d.Key())]; ok {
 				// TODO(tdakkota): try string interning
-				set.Set(label, pcommon.NewValueStr(string(d.Value())))
+				set.setParsed(label, pcommon.NewValueStr(string(d.Value())))
 			}
 		}
 	}
@@ -78,7 +78,7 @@ func (e *LogfmtExtractor) extractAll(line string, set LabelSet) error {
 	for d.ScanRecord() {
 		for d.ScanKeyval() {
 			// TODO(tdakkota): try string interning
-			set.Set(logql.Label(d.Key()), pcommon.NewValueStr(string(d.Value())))
+			set.setParsed(logql.Label(d.Key()), pcommon.NewValueStr(string(d.Value())))
 		}
 	}
 
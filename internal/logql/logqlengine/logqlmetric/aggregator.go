@@ -1,11 +1,12 @@
 package logqlmetric
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/go-faster/errors"
 
 	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
 )
 
 // BatchAggregator is stateless batch aggregator.
@@ -24,9 +25,7 @@ func buildBatchAggregator(expr *logql.RangeAggregationExpr) (BatchAggregator, er
 		}
 		return &Rate[SumOverTime]{selRange: qrange.Range.Seconds()}, nil
 	case logql.RangeOpRateCounter:
-		// FIXME(tdakkota): implementation of rate_counter in Loki
-		// 	is buggy, so keep it unimplemented.
-		// return &rateCounter{selRange: qrange.Range}, nil
+		return &RateCounter{selRange: qrange.Range}, nil
 	case logql.RangeOpBytes:
 		return &SumOverTime{}, nil
 	case logql.RangeOpBytesRate:
@@ -54,10 +53,20 @@ func buildBatchAggregator(expr *logql.RangeAggregationExpr) (BatchAggregator, er
 	case logql.RangeOpLast:
 		return &LastOverTime{}, nil
 	case logql.RangeOpAbsent:
+		// Absent series are handled by range aggregation iterator.
+		return &CountOverTime{}, nil
 	default:
 		return nil, errors.Errorf("unexpected range operation %q", expr.Op)
 	}
-	return nil, &UnsupportedError{Msg: fmt.Sprintf("unsupported range operation %q", expr.Op)}
+}
+
+// WindowAggregator is a batch aggregator that depends on window boundaries.
+type WindowAggregator interface {
+	BatchAggregator
+	// AggregateWindow aggregates points of window (start, end].
+	//
+	// Series is skipped, if aggregator returns false.
+	AggregateWindow(points []FPoint, start, end otelstorage.Timestamp) (float64, bool)
 }
 
 // CountOverTime implements `count_over_time` aggregation.
@@ -79,6 +88,36 @@ func (a Rate[A]) Aggregate(points []FPoint) float64 {
 	return a.preAgg.Aggregate(points) / a.selRange
 }
 
+// RateCounter implements `rate_counter` aggregation.
+//
+// Unlike Loki, it follows Prometheus `rate` semantics: counter resets are
+// taken into account and the result is extrapolated to window boundaries.
+type RateCounter struct {
+	selRange time.Duration
+}
+
+var _ WindowAggregator = RateCounter{}
+
+// Aggregate implements BatchAggregator.
+//
+// Result is extrapolated to the first and the last points.
+func (a RateCounter) Aggregate(points []FPoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	v, _ := a.AggregateWindow(points, points[0].Timestamp, points[len(points)-1].Timestamp)
+	return v
+}
+
+// AggregateWindow implements WindowAggregator.
+func (a RateCounter) AggregateWindow(points []FPoint, start, end otelstorage.Timestamp) (float64, bool) {
+	// Rate cannot be computed from a single point.
+	if len(points) < 2 {
+		return 0, false
+	}
+	return extrapolatedRate(points, start, end, a.selRange), true
+}
+
 // BytesRate implements `bytes_rate` aggregation.
 type BytesRate = Rate[SumOverTime]
 
@@ -1,8 +1,14 @@
 package logqlmetric
 
 import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/go-faster/errors"
 	"go.uber.org/multierr"
+	"golang.org/x/exp/maps"
 
 	"github.com/tdakkota/docker-logql/internal/logql"
 )
@@ -12,13 +18,34 @@ func BinOp(
 	left, right StepIterator,
 	expr *logql.BinOpExpr,
 ) (StepIterator, error) {
-	if m := expr.Modifier; m.Op != "" || len(m.OpLabels) > 0 || m.Group != "" || len(m.Include) > 0 {
-		return nil, &UnsupportedError{Msg: "binary operation modifiers are unsupported yet"}
+	if err := checkBoolModifier(expr); err != nil {
+		return nil, err
+	}
+	m := expr.Modifier
+
+	var (
+		grouper     = nopGrouper
+		groupLabels = m.OpLabels
+	)
+	switch m.Op {
+	case "on":
+		if len(groupLabels) == 0 {
+			// Match all samples, e.g. "on()".
+			grouper = emptyGrouper
+		} else {
+			grouper = AggregatedLabels.By
+		}
+	case "ignoring":
+		grouper = AggregatedLabels.Without
 	}
 
 	switch expr.Op {
 	case logql.OpAnd, logql.OpOr, logql.OpUnless:
-		merge, err := buildMergeSamplesOp(expr.Op, nopGrouper, nil)
+		if m.Group != "" {
+			return nil, errors.Errorf("no grouping allowed for %q operation", expr.Op)
+		}
+
+		merge, err := buildMergeSamplesOp(expr.Op, grouper, groupLabels)
 		if err != nil {
 			return nil, errors.Wrap(err, "build binary merge operation")
 		}
@@ -35,17 +62,40 @@ func BinOp(
 		}
 
 		return &binOpIterator{
-			left:  left,
-			right: right,
-			op:    op,
+			left:        left,
+			right:       right,
+			op:          op,
+			grouper:     grouper,
+			groupLabels: groupLabels,
+			group:       m.Group,
+			include:     m.Include,
 		}, nil
 	}
 }
 
+func checkBoolModifier(expr *logql.BinOpExpr) error {
+	if expr.Modifier.ReturnBool && !isComparisonOp(expr.Op) {
+		return errors.Errorf("bool modifier can only be used on comparison operators, got %q", expr.Op)
+	}
+	return nil
+}
+
+var emptyGrouper = func(AggregatedLabels, ...logql.Label) AggregatedLabels {
+	return &emptyLabels{}
+}
+
 type binOpIterator struct {
 	left  StepIterator
 	right StepIterator
 	op    SampleOp
+
+	// Vector matching parameters.
+	grouper     grouperFunc
+	groupLabels []logql.Label
+	group       string // "", "left", "right"
+	include     []logql.Label
+
+	err error
 }
 
 func (i *binOpIterator) Next(r *Step) bool {
@@ -53,35 +103,91 @@ func (i *binOpIterator) Next(r *Step) bool {
 	if !i.left.Next(&left) || !i.right.Next(&right) {
 		return false
 	}
-	r.Samples = r.Samples[:0]
 	r.Timestamp = left.Timestamp
 
-	leftSamples := make(map[GroupingKey]Sample, len(left.Samples))
-	for _, s := range left.Samples {
-		key := s.Set.Key()
-		leftSamples[key] = s
+	samples, err := i.match(left.Samples, right.Samples, r.Samples[:0])
+	if err != nil {
+		i.err = err
+		return false
+	}
+	r.Samples = samples
+
+	return true
+}
+
+// match performs binary operation on matching samples.
+//
+// Every sample of the "one" side must have a unique set of matching labels.
+// Samples of the "many" side may share a set of matching labels only
+// if grouping modifier is used.
+func (i *binOpIterator) match(left, right, result []Sample) ([]Sample, error) {
+	many, one := left, right
+	oneSide := "right"
+	if i.group == "right" {
+		many, one = right, left
+		oneSide = "left"
 	}
 
-	for _, rsample := range right.Samples {
-		key := rsample.Set.Key()
-		lsample, ok := leftSamples[key]
+	oneSamples := make(map[GroupingKey]Sample, len(one))
+	for _, s := range one {
+		key := i.grouper(s.Set, i.groupLabels...).Key()
+		if _, ok := oneSamples[key]; ok {
+			return nil, &MatchingError{
+				Msg: fmt.Sprintf(
+					"found duplicate series for the match group %s on the %s hand-side of the operation: many-to-many matching not allowed: matching labels must be unique on one side",
+					formatLabels(i.grouper(s.Set, i.groupLabels...)), oneSide,
+				),
+			}
+		}
+		oneSamples[key] = s
+	}
+
+	matched := make(map[GroupingKey]struct{}, len(many))
+	for _, s := range many {
+		matching := i.grouper(s.Set, i.groupLabels...)
+		os, ok := oneSamples[matching.Key()]
 		if !ok {
 			continue
 		}
 
-		result, ok := i.op(lsample, rsample)
+		lsample, rsample := s, os
+		if i.group == "right" {
+			lsample, rsample = os, s
+		}
+
+		var set AggregatedLabels
+		if i.group == "" {
+			set = matching
+		} else {
+			set = s.Set.Include(os.Set, i.include...)
+		}
+
+		// Check matches before operation, since comparison may filter out duplicates.
+		key := set.Key()
+		if _, ok := matched[key]; ok {
+			msg := "multiple matches for labels: many-to-one matching must be explicit (group_left/group_right)"
+			if i.group != "" {
+				msg = "multiple matches for labels: grouping labels must ensure unique matches"
+			}
+			return nil, &MatchingError{Msg: msg}
+		}
+		matched[key] = struct{}{}
+
+		sample, ok := i.op(lsample, rsample)
 		if !ok {
 			continue
 		}
+		sample.Set = set
 
-		r.Samples = append(r.Samples, result)
+		result = append(result, sample)
 	}
 
-	return true
+	return result, nil
 }
 
 func (i *binOpIterator) Err() error {
-	return multierr.Append(
+	return multierr.Combine(
+		i.err,
 		i.left.Err(),
 		i.right.Err(),
 	)
@@ -94,6 +200,25 @@ func (i *binOpIterator) Close() error {
 	)
 }
 
+func formatLabels(set AggregatedLabels) string {
+	labels := set.AsLokiAPI()
+	keys := maps.Keys(labels)
+	slices.Sort(keys)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[k]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
 type mergeBinOpIterator struct {
 	left  StepIterator
 	right StepIterator
@@ -195,6 +320,8 @@ type literalBinOpIterator struct {
 	value float64
 	// left whether on which side literal is
 	left bool
+	// filter whether operation is a comparison without bool modifier
+	filter bool
 }
 
 // LiteralBinOp returns new step iterator performing binary operation with literal.
@@ -204,15 +331,26 @@ func LiteralBinOp(
 	value float64,
 	left bool,
 ) (StepIterator, error) {
+	if err := checkBoolModifier(expr); err != nil {
+		return nil, err
+	}
+	if m := expr.Modifier; m.Op != "" || m.Group != "" {
+		return nil, errors.New("vector matching is allowed only between vectors")
+	}
+	if expr.Op.IsLogic() {
+		return nil, errors.Errorf("%q operation is allowed only between vectors", expr.Op)
+	}
+
 	op, err := buildSampleBinOp(expr)
 	if err != nil {
 		return nil, errors.Wrap(err, "build binary sample operation")
 	}
 	return &literalBinOpIterator{
-		iter:  iter,
-		op:    op,
-		value: value,
-		left:  left,
+		iter:   iter,
+		op:     op,
+		value:  value,
+		left:   left,
+		filter: isComparisonOp(expr.Op) && !expr.Modifier.ReturnBool,
 	}, nil
 }
 
@@ -236,6 +374,10 @@ func (i *literalBinOpIterator) Next(r *Step) bool {
 		}
 
 		if val, ok := i.op(left, right); ok {
+			if i.filter {
+				// Comparison keeps the vector sample value.
+				val.Data = agg.Data
+			}
 			r.Samples[n] = val
 			n++
 		}
@@ -154,3 +154,214 @@ func TestMergeBinOp(t *testing.T) {
 		})
 	}
 }
+
+func TestBinOpMatching(t *testing.T) {
+	var (
+		levels = []Sample{
+			{Data: 10, Set: testLabels{"container": "a", "level": "error"}},
+			{Data: 20, Set: testLabels{"container": "a", "level": "info"}},
+			{Data: 30, Set: testLabels{"container": "b", "level": "error"}},
+		}
+		uniqueLevels = []Sample{
+			{Data: 10, Set: testLabels{"container": "a", "level": "error"}},
+			{Data: 30, Set: testLabels{"container": "b", "level": "error"}},
+		}
+		totals = []Sample{
+			{Data: 100, Set: testLabels{"container": "a", "host": "h1"}},
+			{Data: 200, Set: testLabels{"container": "b", "host": "h2"}},
+		}
+		thresholds = []Sample{
+			{Data: 10, Set: testLabels{"container": "a"}},
+			{Data: 40, Set: testLabels{"container": "b"}},
+		}
+	)
+	on := func(labels ...logql.Label) logql.BinOpModifier {
+		return logql.BinOpModifier{Op: "on", OpLabels: labels}
+	}
+
+	tests := []struct {
+		left, right []Sample
+		expr        *logql.BinOpExpr
+		expect      []Sample
+		wantErr     bool
+	}{
+		// One-to-one.
+		{
+			uniqueLevels, totals,
+			&logql.BinOpExpr{Op: logql.OpDiv, Modifier: on("container")},
+			[]Sample{
+				{Data: 0.1, Set: testLabels{"container": "a"}},
+				{Data: 0.15, Set: testLabels{"container": "b"}},
+			},
+			false,
+		},
+		{
+			uniqueLevels, totals,
+			&logql.BinOpExpr{Op: logql.OpDiv, Modifier: logql.BinOpModifier{
+				Op:       "ignoring",
+				OpLabels: []logql.Label{"level", "host"},
+			}},
+			[]Sample{
+				{Data: 0.1, Set: testLabels{"container": "a"}},
+				{Data: 0.15, Set: testLabels{"container": "b"}},
+			},
+			false,
+		},
+		{
+			uniqueLevels, totals,
+			&logql.BinOpExpr{Op: logql.OpDiv, Modifier: on()},
+			nil,
+			true,
+		},
+		{
+			uniqueLevels, totals[:1],
+			&logql.BinOpExpr{Op: logql.OpAdd, Modifier: on()},
+			nil,
+			true,
+		},
+		// Without modifiers, all labels must match.
+		{
+			uniqueLevels, totals,
+			&logql.BinOpExpr{Op: logql.OpDiv},
+			nil,
+			false,
+		},
+		// Many-to-one.
+		{
+			levels, totals,
+			&logql.BinOpExpr{Op: logql.OpDiv, Modifier: logql.BinOpModifier{
+				Op:       "on",
+				OpLabels: []logql.Label{"container"},
+				Group:    "left",
+				Include:  []logql.Label{"host"},
+			}},
+			[]Sample{
+				{Data: 0.1, Set: testLabels{"container": "a", "level": "error", "host": "h1"}},
+				{Data: 0.2, Set: testLabels{"container": "a", "level": "info", "host": "h1"}},
+				{Data: 0.15, Set: testLabels{"container": "b", "level": "error", "host": "h2"}},
+			},
+			false,
+		},
+		{
+			totals, levels,
+			&logql.BinOpExpr{Op: logql.OpSub, Modifier: logql.BinOpModifier{
+				Op:       "on",
+				OpLabels: []logql.Label{"container"},
+				Group:    "right",
+			}},
+			[]Sample{
+				{Data: 90, Set: testLabels{"container": "a", "level": "error"}},
+				{Data: 80, Set: testLabels{"container": "a", "level": "info"}},
+				{Data: 170, Set: testLabels{"container": "b", "level": "error"}},
+			},
+			false,
+		},
+		{
+			levels, totals,
+			&logql.BinOpExpr{Op: logql.OpDiv, Modifier: on("container")},
+			nil,
+			true,
+		},
+		{
+			totals, levels,
+			&logql.BinOpExpr{Op: logql.OpDiv, Modifier: logql.BinOpModifier{
+				Op:       "on",
+				OpLabels: []logql.Label{"container"},
+				Group:    "left",
+			}},
+			nil,
+			true,
+		},
+		// Comparison.
+		{
+			uniqueLevels, thresholds,
+			&logql.BinOpExpr{Op: logql.OpGte, Modifier: on("container")},
+			[]Sample{
+				{Data: 10, Set: testLabels{"container": "a"}},
+			},
+			false,
+		},
+		{
+			uniqueLevels, thresholds,
+			&logql.BinOpExpr{Op: logql.OpGte, Modifier: logql.BinOpModifier{
+				Op:         "on",
+				OpLabels:   []logql.Label{"container"},
+				ReturnBool: true,
+			}},
+			[]Sample{
+				{Data: 1, Set: testLabels{"container": "a"}},
+				{Data: 0, Set: testLabels{"container": "b"}},
+			},
+			false,
+		},
+		// Set operations.
+		{
+			levels, thresholds[:1],
+			&logql.BinOpExpr{Op: logql.OpAnd, Modifier: on("container")},
+			[]Sample{
+				{Data: 10, Set: testLabels{"container": "a", "level": "error"}},
+				{Data: 20, Set: testLabels{"container": "a", "level": "info"}},
+			},
+			false,
+		},
+		{
+			levels, totals,
+			&logql.BinOpExpr{Op: logql.OpUnless, Modifier: logql.BinOpModifier{
+				Op:       "ignoring",
+				OpLabels: []logql.Label{"level", "host"},
+			}},
+			nil,
+			false,
+		},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			left := iterators.Slice([]Step{{Timestamp: 1, Samples: tt.left}})
+			right := iterators.Slice([]Step{{Timestamp: 1, Samples: tt.right}})
+
+			iter, err := BinOp(left, right, tt.expr)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, iter.Close())
+			}()
+
+			var result Step
+			if tt.wantErr {
+				require.False(t, iter.Next(&result))
+
+				var matchErr *MatchingError
+				require.ErrorAs(t, iter.Err(), &matchErr)
+				return
+			}
+
+			require.True(t, iter.Next(&result))
+			require.Equal(t, tt.expect, result.Samples)
+
+			require.False(t, iter.Next(&result))
+			require.NoError(t, iter.Err())
+		})
+	}
+}
+
+func TestBinOpInvalidModifier(t *testing.T) {
+	tests := []*logql.BinOpExpr{
+		{Op: logql.OpAdd, Modifier: logql.BinOpModifier{ReturnBool: true}},
+		{Op: logql.OpAnd, Modifier: logql.BinOpModifier{ReturnBool: true}},
+		{Op: logql.OpOr, Modifier: logql.BinOpModifier{
+			Op:       "on",
+			OpLabels: []logql.Label{"container"},
+			Group:    "left",
+		}},
+	}
+	for i, expr := range tests {
+		expr := expr
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			left := iterators.Slice([]Step{{Timestamp: 1}})
+			right := iterators.Slice([]Step{{Timestamp: 1}})
+
+			_, err := BinOp(left, right, expr)
+			require.Error(t, err)
+		})
+	}
+}
@@ -1,31 +1,45 @@
 package logqlmetric
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/go-faster/errors"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/tdakkota/docker-logql/internal/iterators"
 	"github.com/tdakkota/docker-logql/internal/logql"
 )
 
 // SampleSelector creates new sampled entry iterator.
-type SampleSelector = func(expr *logql.RangeAggregationExpr, start, end time.Time) (iterators.Iterator[SampledEntry], error)
+//
+// SampleSelector may be called concurrently.
+type SampleSelector = func(ctx context.Context, expr *logql.RangeAggregationExpr, start, end time.Time) (iterators.Iterator[SampledEntry], error)
+
+// RangeSplitter evaluates range aggregation for steps from start to end by parts.
+//
+// RangeSplitter returns false, if expression cannot be split.
+// RangeSplitter may be called concurrently.
+type RangeSplitter = func(ctx context.Context, expr *logql.RangeAggregationExpr, start, end time.Time, step time.Duration) (StepIterator, bool, error)
 
 // EvalParams is a query evaluation params.
 type EvalParams struct {
 	Start, End time.Time
 	Step       time.Duration
+	// Split evaluates range aggregations, if it is not nil.
+	Split RangeSplitter
 }
 
 // Build builds new step iterator.
-func Build(expr logql.MetricExpr, sel SampleSelector, params EvalParams) (StepIterator, error) {
-	return build(expr, sel, params)
+//
+// Both sides of binary operations are built and evaluated concurrently.
+func Build(ctx context.Context, expr logql.MetricExpr, sel SampleSelector, params EvalParams) (StepIterator, error) {
+	return build(ctx, expr, sel, params)
 }
 
-func build(expr logql.Expr, sel SampleSelector, params EvalParams) (_ StepIterator, rerr error) {
+func build(ctx context.Context, expr logql.Expr, sel SampleSelector, params EvalParams) (_ StepIterator, rerr error) {
 	closeOnError := func(c io.Closer) {
 		if rerr != nil {
 			_ = c.Close()
@@ -43,10 +57,19 @@ func build(expr logql.Expr, sel SampleSelector, params EvalParams) (_ StepIterat
 			start = start.Add(-o.Duration)
 			end = end.Add(-o.Duration)
 		}
+		if split := params.Split; split != nil {
+			iter, ok, err := split(ctx, expr, start, end, params.Step)
+			if err != nil {
+				return nil, errors.Wrap(err, "split range aggregation")
+			}
+			if ok {
+				return iter, nil
+			}
+		}
 		// Query samples for first step.
 		qstart := start.Add(-qrange.Range)
 
-		iter, err := sel(expr, qstart, end)
+		iter, err := sel(ctx, expr, qstart, end)
 		if err != nil {
 			return nil, errors.Wrap(err, "get samples iterator")
 		}
@@ -54,7 +77,7 @@ func build(expr logql.Expr, sel SampleSelector, params EvalParams) (_ StepIterat
 
 		return RangeAggregation(iter, expr, start, end, params.Step)
 	case *logql.VectorAggregationExpr:
-		iter, err := build(expr.Expr, sel, params)
+		iter, err := build(ctx, expr.Expr, sel, params)
 		if err != nil {
 			return nil, err
 		}
@@ -62,42 +85,125 @@ func build(expr logql.Expr, sel SampleSelector, params EvalParams) (_ StepIterat
 
 		return VectorAggregation(iter, expr)
 	case *logql.LiteralExpr:
+		// Scalar used as instant vector, e.g. "sum(2)".
+		return Vector(&logql.VectorExpr{Value: expr.Value}, params.Start, params.End, params.Step), nil
 	case *logql.LabelReplaceExpr:
+		iter, err := build(ctx, expr.Expr, sel, params)
+		if err != nil {
+			return nil, err
+		}
+		defer closeOnError(iter)
+
+		return LabelReplace(iter, expr)
 	case *logql.VectorExpr:
 		return Vector(expr, params.Start, params.End, params.Step), nil
 	case *logql.BinOpExpr:
-		if lit, ok := expr.Left.(*logql.LiteralExpr); ok {
-			right, err := build(expr.Right, sel, params)
+		if v, ok, err := literalValue(expr); err != nil {
+			return nil, err
+		} else if ok {
+			return Vector(&logql.VectorExpr{Value: v}, params.Start, params.End, params.Step), nil
+		}
+
+		if v, ok, err := literalValue(expr.Left); err != nil {
+			return nil, err
+		} else if ok {
+			right, err := build(ctx, expr.Right, sel, params)
 			if err != nil {
 				return nil, err
 			}
-			return LiteralBinOp(right, expr, lit.Value, true)
+			defer closeOnError(right)
+
+			return LiteralBinOp(right, expr, v, true)
 		}
-		if lit, ok := expr.Right.(*logql.LiteralExpr); ok {
-			left, err := build(expr.Left, sel, params)
+		if v, ok, err := literalValue(expr.Right); err != nil {
+			return nil, err
+		} else if ok {
+			left, err := build(ctx, expr.Left, sel, params)
 			if err != nil {
 				return nil, err
 			}
-			return LiteralBinOp(left, expr, lit.Value, false)
-		}
+			defer closeOnError(left)
 
-		// TODO(tdakkota): build likely would make a query to storage, so
-		// probably we should do it concurrently.
-		left, err := build(expr.Left, sel, params)
-		if err != nil {
-			return nil, err
+			return LiteralBinOp(left, expr, v, false)
 		}
-		defer closeOnError(left)
 
-		right, err := build(expr.Right, sel, params)
+		left, right, err := buildBinOpSides(ctx, expr, sel, params)
 		if err != nil {
 			return nil, err
 		}
+		defer closeOnError(left)
 		defer closeOnError(right)
 
 		return BinOp(left, right, expr)
 	default:
 		return nil, errors.Errorf("unexpected expression %T", expr)
 	}
-	return nil, &UnsupportedError{Msg: fmt.Sprintf("expression %T is not supported yet", expr)}
+}
+
+// buildBinOpSides concurrently builds both sides of binary operation.
+//
+// Built iterators read steps concurrently, if one of them fails, the other one is canceled.
+func buildBinOpSides(ctx context.Context, expr *logql.BinOpExpr, sel SampleSelector, params EvalParams) (left, right StepIterator, _ error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var (
+		grp errgroup.Group
+
+		failOnce sync.Once
+		failErr  error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failErr = err
+			// Cancel building of the other side.
+			cancel()
+		})
+	}
+	grp.Go(func() (err error) {
+		if left, err = build(ctx, expr.Left, sel, params); err != nil {
+			fail(err)
+		}
+		return nil
+	})
+	grp.Go(func() (err error) {
+		if right, err = build(ctx, expr.Right, sel, params); err != nil {
+			fail(err)
+		}
+		return nil
+	})
+	_ = grp.Wait()
+
+	if err := failErr; err != nil {
+		for _, iter := range []StepIterator{left, right} {
+			if iter != nil {
+				_ = iter.Close()
+			}
+		}
+		cancel()
+		return nil, nil, err
+	}
+
+	g := &prefetchGroup{ctx: ctx, cancel: cancel}
+	return g.prefetch(left), g.prefetch(right), nil
+}
+
+// literalValue returns value of given expression, if it is constant.
+//
+// Binary operations between literals are folded.
+func literalValue(expr logql.Expr) (float64, bool, error) {
+	switch expr := logql.UnparenExpr(expr).(type) {
+	case *logql.LiteralExpr:
+		return expr.Value, true, nil
+	case *logql.BinOpExpr:
+		lit, err := logql.ReduceBinOp(expr)
+		if err != nil {
+			return 0, false, errors.Wrap(err, "reduce binary operation")
+		}
+		if lit == nil {
+			return 0, false, nil
+		}
+		return lit.Value, true, nil
+	default:
+		return 0, false, nil
+	}
 }
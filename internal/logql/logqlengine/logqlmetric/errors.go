@@ -9,3 +9,13 @@ type UnsupportedError struct {
 func (e *UnsupportedError) Error() string {
 	return e.Msg
 }
+
+// MatchingError reports that samples of binary operation cannot be matched.
+type MatchingError struct {
+	Msg string
+}
+
+// Error implements error.
+func (e *MatchingError) Error() string {
+	return e.Msg
+}
@@ -2,6 +2,10 @@ package logqlmetric
 
 import (
 	"regexp"
+	"slices"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/exp/maps"
 
 	"github.com/tdakkota/docker-logql/internal/logql"
 	"github.com/tdakkota/docker-logql/internal/lokiapi"
@@ -20,6 +24,10 @@ type AggregatedLabels interface {
 	Key() GroupingKey
 	// Replace replaces labels using given regexp.
 	Replace(dstLabel, replacement, srcLabel string, re *regexp.Regexp) AggregatedLabels
+	// Include returns new set of labels with given list of labels copied from other set.
+	//
+	// Label is deleted, if other set does not have it.
+	Include(other AggregatedLabels, labels ...logql.Label) AggregatedLabels
 
 	// AsLokiAPI returns API structure for label set.
 	AsLokiAPI() lokiapi.LabelSet
@@ -32,3 +40,85 @@ func (l *emptyLabels) Without(_ ...logql.Label) AggregatedLabels
 func (l *emptyLabels) Key() GroupingKey                                          { return 0 }
 func (l *emptyLabels) Replace(_, _, _ string, _ *regexp.Regexp) AggregatedLabels { return l }
 func (l *emptyLabels) AsLokiAPI() lokiapi.LabelSet                               { return lokiapi.LabelSet{} }
+
+func (l *emptyLabels) Include(other AggregatedLabels, labels ...logql.Label) AggregatedLabels {
+	if len(labels) == 0 {
+		return l
+	}
+	return other.By(labels...)
+}
+
+// mapLabels is a set of labels backed by map.
+type mapLabels map[string]string
+
+func (l mapLabels) By(labels ...logql.Label) AggregatedLabels {
+	r := make(mapLabels, len(labels))
+	for _, label := range labels {
+		if v, ok := l[string(label)]; ok {
+			r[string(label)] = v
+		}
+	}
+	return r
+}
+
+func (l mapLabels) Without(labels ...logql.Label) AggregatedLabels {
+	r := maps.Clone(l)
+	for _, label := range labels {
+		delete(r, string(label))
+	}
+	return r
+}
+
+// Key computes grouping key from set of labels.
+//
+// Key is computed from sorted label names and values, the same way as
+// engine label set does, to match samples with selected ones.
+func (l mapLabels) Key() GroupingKey {
+	keys := maps.Keys(l)
+	slices.Sort(keys)
+
+	h := xxhash.New()
+	for _, k := range keys {
+		_, _ = h.WriteString(k)
+		_, _ = h.WriteString(l[k])
+	}
+	return h.Sum64()
+}
+
+func (l mapLabels) Replace(dstLabel, replacement, srcLabel string, re *regexp.Regexp) AggregatedLabels {
+	src := l[srcLabel]
+
+	idxs := re.FindStringSubmatchIndex(src)
+	if idxs == nil {
+		return l
+	}
+
+	r := maps.Clone(l)
+	if dst := re.ExpandString(nil, replacement, src, idxs); len(dst) > 0 {
+		r[dstLabel] = string(dst)
+	} else {
+		delete(r, dstLabel)
+	}
+	return r
+}
+
+func (l mapLabels) Include(other AggregatedLabels, labels ...logql.Label) AggregatedLabels {
+	if len(labels) == 0 {
+		return l
+	}
+	values := other.By(labels...).AsLokiAPI()
+
+	r := maps.Clone(l)
+	for _, label := range labels {
+		if v, ok := values[string(label)]; ok {
+			r[string(label)] = v
+		} else {
+			delete(r, string(label))
+		}
+	}
+	return r
+}
+
+func (l mapLabels) AsLokiAPI() lokiapi.LabelSet {
+	return lokiapi.LabelSet(maps.Clone(l))
+}
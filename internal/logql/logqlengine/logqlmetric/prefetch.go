@@ -0,0 +1,139 @@
+package logqlmetric
+
+import (
+	"context"
+	"sync"
+)
+
+// prefetchGroup is a group of step iterators evaluated concurrently.
+//
+// If one of iterators fails, other ones are canceled.
+type prefetchGroup struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	failOnce sync.Once
+
+	iters     []*prefetchIterator
+	startOnce sync.Once
+}
+
+// start starts reading of all iterators of the group.
+func (g *prefetchGroup) start() {
+	g.startOnce.Do(func() {
+		for _, iter := range g.iters {
+			iter.started = true
+			go iter.run()
+		}
+	})
+}
+
+// fail cancels other iterators of the group.
+//
+// Only the first failure is reported by the failed iterator: other iterators
+// of the group fail just because they are canceled. Error is saved before
+// cancellation, so it is visible once other iterators are stopped.
+func (g *prefetchGroup) fail(iter *prefetchIterator, err error) {
+	g.failOnce.Do(func() {
+		iter.errMux.Lock()
+		iter.err = err
+		iter.errMux.Unlock()
+
+		g.cancel()
+	})
+}
+
+// prefetch returns new iterator that reads steps of given iterator concurrently.
+func (g *prefetchGroup) prefetch(iter StepIterator) StepIterator {
+	i := &prefetchIterator{
+		iter:   iter,
+		group:  g,
+		steps:  make(chan Step, 1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	g.iters = append(g.iters, i)
+	return i
+}
+
+// prefetchIterator reads steps of underlying iterator in a separate goroutine.
+//
+// Reading of all iterators of the group starts on the first Next call, so all
+// iterators of the query are built before any of them starts reading logs.
+type prefetchIterator struct {
+	iter  StepIterator
+	group *prefetchGroup
+
+	started bool
+	steps   chan Step
+	done    chan struct{}
+	exited  chan struct{}
+
+	errMux sync.Mutex
+	err    error
+}
+
+var _ StepIterator = (*prefetchIterator)(nil)
+
+func (i *prefetchIterator) run() {
+	defer close(i.exited)
+	defer close(i.steps)
+
+	for {
+		// Do not reuse step, it is sent to the reader.
+		var step Step
+		if !i.iter.Next(&step) {
+			break
+		}
+
+		select {
+		case i.steps <- step:
+		case <-i.done:
+			return
+		}
+	}
+
+	err := i.iter.Err()
+	if err == nil {
+		// Iterator may stop without error, if it is canceled.
+		err = i.group.ctx.Err()
+	}
+	if err != nil {
+		i.group.fail(i, err)
+	}
+}
+
+// Next returns true, if there is element and fills t.
+func (i *prefetchIterator) Next(r *Step) bool {
+	i.group.start()
+
+	step, ok := <-i.steps
+	if !ok {
+		return false
+	}
+	*r = step
+	return true
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *prefetchIterator) Err() error {
+	i.errMux.Lock()
+	defer i.errMux.Unlock()
+	return i.err
+}
+
+// Close closes iterator.
+func (i *prefetchIterator) Close() error {
+	select {
+	case <-i.done:
+		return nil
+	default:
+	}
+	close(i.done)
+
+	// Cancel reading and wait for the reader to exit.
+	i.group.cancel()
+	if i.started {
+		<-i.exited
+	}
+	return i.iter.Close()
+}
@@ -0,0 +1,153 @@
+package logqlmetric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+)
+
+type failingIterator struct {
+	err error
+}
+
+func (i *failingIterator) Next(*SampledEntry) bool { return false }
+func (i *failingIterator) Err() error              { return i.err }
+func (i *failingIterator) Close() error            { return nil }
+
+// blockingIterator blocks until context is canceled.
+type blockingIterator struct {
+	ctx context.Context
+}
+
+func (i *blockingIterator) Next(*SampledEntry) bool {
+	<-i.ctx.Done()
+	return false
+}
+func (i *blockingIterator) Err() error   { return i.ctx.Err() }
+func (i *blockingIterator) Close() error { return nil }
+
+func TestBinOpCancel(t *testing.T) {
+	testErr := errors.New("test error")
+	sel := func(ctx context.Context, expr *logql.RangeAggregationExpr, _, _ time.Time) (iterators.Iterator[SampledEntry], error) {
+		if expr.Range.Sel.Matchers[0].Value == "fail" {
+			return &failingIterator{err: testErr}, nil
+		}
+		return &blockingIterator{ctx: ctx}, nil
+	}
+
+	for _, query := range []string{
+		`count_over_time({side="fail"} [1s]) + count_over_time({side="block"} [1s])`,
+		`count_over_time({side="block"} [1s]) + count_over_time({side="fail"} [1s])`,
+		`sum(count_over_time({side="block"} [1s])) / (count_over_time({side="block"} [1s]) and count_over_time({side="fail"} [1s]))`,
+	} {
+		query := query
+		t.Run(query, func(t *testing.T) {
+			expr, err := logql.Parse(query, logql.ParseOptions{})
+			require.NoError(t, err)
+
+			for _, instant := range []bool{true, false} {
+				params := EvalParams{
+					Start: time.Unix(1700000000, 0),
+					End:   time.Unix(1700000000, 0),
+				}
+				if !instant {
+					params.End = params.Start.Add(time.Minute)
+					params.Step = time.Second
+				}
+
+				iter, err := Build(context.Background(), expr.(logql.MetricExpr), sel, params)
+				require.NoError(t, err)
+
+				_, err = ReadStepResponse(iter, instant)
+				require.ErrorIs(t, err, testErr)
+				require.NotErrorIs(t, err, context.Canceled)
+				require.NoError(t, iter.Close())
+			}
+		})
+	}
+}
+
+// readingStepIterator returns steps until context is canceled.
+//
+// It stops without error, like iterators that do not check context error.
+type readingStepIterator struct {
+	ctx context.Context
+}
+
+func (i *readingStepIterator) Next(r *Step) bool {
+	if i.ctx.Err() != nil {
+		return false
+	}
+	*r = Step{Timestamp: 1}
+	return true
+}
+func (i *readingStepIterator) Err() error   { return nil }
+func (i *readingStepIterator) Close() error { return nil }
+
+// failingStepIterator returns n steps and fails.
+type failingStepIterator struct {
+	n   int
+	err error
+}
+
+func (i *failingStepIterator) Next(r *Step) bool {
+	if i.n <= 0 {
+		return false
+	}
+	i.n--
+	*r = Step{Timestamp: 1}
+	return true
+}
+func (i *failingStepIterator) Err() error   { return i.err }
+func (i *failingStepIterator) Close() error { return nil }
+
+func TestPrefetchFail(t *testing.T) {
+	testErr := errors.New("test error")
+
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		g := &prefetchGroup{ctx: ctx, cancel: cancel}
+		var (
+			reading = g.prefetch(&readingStepIterator{ctx: ctx})
+			failing = g.prefetch(&failingStepIterator{n: 1, err: testErr})
+		)
+
+		// Read the side that is still reading, while the other one fails.
+		var step Step
+		for reading.Next(&step) {
+		}
+		err := errors.Join(reading.Err(), failing.Err())
+		require.ErrorIs(t, err, testErr)
+		require.NotErrorIs(t, err, context.Canceled)
+
+		require.NoError(t, reading.Close())
+		require.NoError(t, failing.Close())
+	}
+}
+
+func TestPrefetchCancel(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
+	g := &prefetchGroup{ctx: ctx, cancel: cancel}
+	var (
+		left  = g.prefetch(&readingStepIterator{ctx: ctx})
+		right = g.prefetch(&readingStepIterator{ctx: ctx})
+	)
+
+	var step Step
+	require.True(t, left.Next(&step))
+	cancelParent()
+	for left.Next(&step) {
+	}
+	// Canceled iterator must not be reported as successfully finished.
+	require.ErrorIs(t, errors.Join(left.Err(), right.Err()), context.Canceled)
+
+	require.NoError(t, left.Close())
+	require.NoError(t, right.Close())
+}
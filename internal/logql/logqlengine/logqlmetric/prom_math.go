@@ -4,6 +4,9 @@ import (
 	"cmp"
 	"math"
 	"slices"
+	"time"
+
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
 )
 
 // Note: this file contains stats functions from Prometheus.
@@ -45,3 +48,57 @@ func quantile(q float64, values []FPoint) float64 {
 	upper := values[int(upperIndex)]
 	return lower.Value*(1-weight) + upper.Value*weight
 }
+
+// extrapolatedRate calculates per-second rate of counter over window (start, end].
+//
+// Points must be sorted by timestamp, at least two points are required.
+func extrapolatedRate(points []FPoint, start, end otelstorage.Timestamp, selRange time.Duration) float64 {
+	var (
+		first = points[0]
+		last  = points[len(points)-1]
+
+		result = last.Value - first.Value
+	)
+	// Handle counter resets.
+	prev := first.Value
+	for _, p := range points[1:] {
+		if p.Value < prev {
+			result += prev
+		}
+		prev = p.Value
+	}
+
+	var (
+		durationToStart = first.Timestamp.AsTime().Sub(start.AsTime()).Seconds()
+		durationToEnd   = end.AsTime().Sub(last.Timestamp.AsTime()).Seconds()
+
+		sampledInterval               = last.Timestamp.AsTime().Sub(first.Timestamp.AsTime()).Seconds()
+		averageDurationBetweenSamples = sampledInterval / float64(len(points)-1)
+		extrapolationThreshold        = averageDurationBetweenSamples * 1.1
+		extrapolateToInterval         = sampledInterval
+	)
+	if sampledInterval == 0 {
+		return 0
+	}
+
+	// Counter cannot be negative, so do not extrapolate below zero.
+	if result > 0 && first.Value >= 0 {
+		durationToZero := sampledInterval * (first.Value / result)
+		if durationToZero < durationToStart {
+			durationToStart = durationToZero
+		}
+	}
+
+	if durationToStart < extrapolationThreshold {
+		extrapolateToInterval += durationToStart
+	} else {
+		extrapolateToInterval += averageDurationBetweenSamples / 2
+	}
+	if durationToEnd < extrapolationThreshold {
+		extrapolateToInterval += durationToEnd
+	} else {
+		extrapolateToInterval += averageDurationBetweenSamples / 2
+	}
+
+	return result * (extrapolateToInterval / sampledInterval) / selRange.Seconds()
+}
@@ -2,6 +2,7 @@ package logqlmetric
 
 import (
 	"cmp"
+	"context"
 	"fmt"
 	"hash/fnv"
 	"io"
@@ -19,7 +20,7 @@ import (
 )
 
 func testSampler(samples []SampledEntry) SampleSelector {
-	return func(_ *logql.RangeAggregationExpr, _, _ time.Time) (iterators.Iterator[SampledEntry], error) {
+	return func(_ context.Context, _ *logql.RangeAggregationExpr, _, _ time.Time) (iterators.Iterator[SampledEntry], error) {
 		slices.SortStableFunc(samples, func(a, b SampledEntry) int {
 			return cmp.Compare(a.Timestamp, b.Timestamp)
 		})
@@ -42,7 +43,7 @@ func evaluateQuery(t *testing.T, samples []SampledEntry, query string, params Ev
 	require.Implements(t, (*logql.MetricExpr)(nil), expr)
 	metricExpr := expr.(logql.MetricExpr)
 
-	agg, err := Build(metricExpr, testSampler(samples), params)
+	agg, err := Build(context.Background(), metricExpr, testSampler(samples), params)
 	require.NoError(t, err)
 	defer func() {
 		require.NoError(t, agg.Close())
@@ -126,20 +127,26 @@ func TestInstantAggregation(t *testing.T) {
 		{`vector(2) ^ 4`, "16"},
 		{`2 ^ vector(3)`, "8"},
 		// Comparison operations.
-		{`vector(2) == 2`, "1"},
-		{`vector(2) == 1`, "0"},
-		{`vector(2) != 1`, "1"},
-		{`vector(2) != 2`, "0"},
-		{`vector(2) > 1`, "1"},
-		{`vector(2) > 2`, "0"},
-		{`vector(2) >= 1`, "1"},
-		{`vector(2) >= 2`, "1"},
-		{`vector(2) >= 3`, "0"},
-		{`vector(2) < 3`, "1"},
-		{`vector(2) < 2`, "0"},
-		{`vector(2) <= 3`, "1"},
-		{`vector(2) <= 2`, "1"},
-		{`vector(2) <= 1`, "0"},
+		{`vector(2) == bool 2`, "1"},
+		{`vector(2) == bool 1`, "0"},
+		{`vector(2) != bool 1`, "1"},
+		{`vector(2) != bool 2`, "0"},
+		{`vector(2) > bool 1`, "1"},
+		{`vector(2) > bool 2`, "0"},
+		{`vector(2) >= bool 1`, "1"},
+		{`vector(2) >= bool 2`, "1"},
+		{`vector(2) >= bool 3`, "0"},
+		{`vector(2) < bool 3`, "1"},
+		{`vector(2) < bool 2`, "0"},
+		{`vector(2) <= bool 3`, "1"},
+		{`vector(2) <= bool 2`, "1"},
+		{`vector(2) <= bool 1`, "0"},
+
+		// Filtering comparison keeps the vector value.
+		{`vector(2) == 2`, "2"},
+		{`vector(2) > 1`, "2"},
+		{`3 > vector(2)`, "2"},
+		{`2 <= bool vector(3)`, "1"},
 
 		// Operations with range.
 		{`count_over_time({} [2s]) * 2`, "6"},
@@ -205,6 +212,17 @@ func TestRangeAggregation(t *testing.T) {
 		{`max_over_time({} | unwrap foo [2s])`, []string{"3", "6", "4"}},
 		{`first_over_time({} | unwrap foo [2s])`, []string{"1", "4", "1"}},
 		{`last_over_time({} | unwrap foo [2s])`, []string{"3", "6", "4"}},
+		{`rate_counter({} | unwrap foo [2s])`, []string{"1", "1", "1.5"}},
+		// Counter is reset in the third window.
+		{`rate_counter({} | unwrap foo [5s])`, []string{"0.6", "1", "1.1"}},
+		// The first window has no samples.
+		{`absent_over_time({} [2s])`, []string{"1"}},
+
+		// Literals.
+		{`2 * count_over_time({} [2s])`, []string{"6", "6", "8"}},
+		{`(2 * 3) * count_over_time({} [2s])`, []string{"18", "18", "24"}},
+		{`count_over_time({} [2s]) / ((4))`, []string{"0.75", "0.75", "1"}},
+		{`count_over_time({} [2s]) * 2 ^ 2`, []string{"12", "12", "16"}},
 	}
 	for i, tt := range tests {
 		tt := tt
@@ -292,6 +310,22 @@ func (l testLabels) Replace(dstLabel, replacement, srcLabel string, re *regexp.R
 	return newLabels
 }
 
+// Include returns new set of labels with given list of labels copied from other set.
+func (l testLabels) Include(other AggregatedLabels, labels ...logql.Label) AggregatedLabels {
+	values := other.AsLokiAPI()
+
+	newLabels := maps.Clone(l)
+	for _, label := range labels {
+		k := string(label)
+		if v, ok := values[k]; ok {
+			newLabels[k] = v
+		} else {
+			delete(newLabels, k)
+		}
+	}
+	return newLabels
+}
+
 // AsLokiAPI returns API structure for label set.
 func (l testLabels) AsLokiAPI() lokiapi.LabelSet {
 	return lokiapi.LabelSet(maps.Clone(l))
@@ -474,6 +508,23 @@ func TestGroupedAggregation(t *testing.T) {
 				},
 			},
 		},
+		{
+			`label_replace(sum by (foo) ( count_over_time({} [4s]) ), "foo", "x$1", "foo", "(.*)")`,
+			[]series{
+				{
+					map[string]string{
+						"foo": "xa",
+					},
+					[]string{"3", "3", "3"},
+				},
+				{
+					map[string]string{
+						"foo": "xb",
+					},
+					[]string{"3", "3", "3"},
+				},
+			},
+		},
 		{
 			`sum without (method) ( count_over_time({} [4s]) )`,
 			[]series{
@@ -565,3 +616,46 @@ func TestKHeapAggregation(t *testing.T) {
 		})
 	}
 }
+
+func TestAbsentOverTime(t *testing.T) {
+	testParams := EvalParams{
+		Start: time.Unix(1700000000, 0),
+		End:   time.Unix(1700000000, 0),
+	}
+
+	tests := []struct {
+		query  string
+		labels map[string]string
+	}{
+		{`absent_over_time({} [5s])`, map[string]string{}},
+		{`absent_over_time({container="worker"} [5s])`, map[string]string{"container": "worker"}},
+		{`absent_over_time({container="worker", job=~"api.+"} | json [5s])`, map[string]string{"container": "worker"}},
+		{`absent_over_time({container="worker", container!="api"} [5s])`, map[string]string{}},
+		{`absent_over_time({container="worker", container="api", job="w"} [5s])`, map[string]string{"job": "w"}},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			data := evaluateQuery(t, nil, tt.query, testParams, true)
+
+			v, ok := data.GetVectorResult()
+			require.True(t, ok)
+			require.Len(t, v.Result, 1)
+
+			sample := v.Result[0]
+			require.Equal(t, "1", sample.Value.V)
+			require.Equal(t, tt.labels, map[string]string(sample.Metric.Value))
+		})
+	}
+
+	t.Run("NotAbsent", func(t *testing.T) {
+		samples := []SampledEntry{
+			{Sample: 1, Timestamp: 1699999999_000000000, Set: &emptyLabels{}},
+		}
+		data := evaluateQuery(t, samples, `absent_over_time({container="worker"} [5s])`, testParams, true)
+
+		v, ok := data.GetVectorResult()
+		require.True(t, ok)
+		require.Empty(t, v.Result)
+	})
+}
@@ -25,6 +25,8 @@ type rangeAggIterator struct {
 
 	grouper     grouperFunc
 	groupLabels []logql.Label
+	// absent is a set of labels of absent series, if operation is absent_over_time.
+	absent AggregatedLabels
 	// window state
 	window   map[GroupingKey]Series
 	interval time.Duration
@@ -62,6 +64,11 @@ func RangeAggregation(
 		}
 	}
 
+	var absent AggregatedLabels
+	if expr.Op == logql.RangeOpAbsent {
+		absent = absentLabels(expr.Range.Sel)
+	}
+
 	return &rangeAggIterator{
 		iter: iter,
 
@@ -70,6 +77,7 @@ func RangeAggregation(
 
 		grouper:     grouper,
 		groupLabels: groupLabels,
+		absent:      absent,
 
 		window:   map[GroupingKey]Series{},
 		interval: expr.Range.Range,
@@ -86,13 +94,42 @@ func (i *rangeAggIterator) Next(r *Step) bool {
 	windowStart := current.Add(-i.interval)
 	windowEnd := current
 	i.fillWindow(windowStart, windowEnd)
+	if err := i.iter.Err(); err != nil {
+		// Do not aggregate incomplete window.
+		return false
+	}
 
 	// Aggregate the window.
 	r.Timestamp = otelstorage.NewTimestampFromTime(current)
 	r.Samples = r.Samples[:0]
+	if i.absent != nil {
+		if len(i.window) == 0 {
+			r.Samples = append(r.Samples, Sample{
+				Data: 1,
+				Set:  i.absent,
+			})
+		}
+		return true
+	}
+
+	wagg, isWindow := i.agg.(WindowAggregator)
 	for _, s := range i.window {
+		var data float64
+		if isWindow {
+			v, ok := wagg.AggregateWindow(s.Data,
+				otelstorage.NewTimestampFromTime(windowStart),
+				otelstorage.NewTimestampFromTime(windowEnd),
+			)
+			if !ok {
+				continue
+			}
+			data = v
+		} else {
+			data = i.agg.Aggregate(s.Data)
+		}
+
 		r.Samples = append(r.Samples, Sample{
-			Data: i.agg.Aggregate(s.Data),
+			Data: data,
 			Set:  s.Set,
 		})
 	}
@@ -100,6 +137,29 @@ func (i *rangeAggIterator) Next(r *Step) bool {
 	return true
 }
 
+// absentLabels returns labels of absent series.
+//
+// Like in Prometheus, labels are taken from equality matchers of selector,
+// label is skipped, if there is any other matcher for it.
+func absentLabels(sel logql.Selector) AggregatedLabels {
+	var (
+		labels  = mapLabels{}
+		skipped = map[logql.Label]struct{}{}
+	)
+	for _, m := range sel.Matchers {
+		if _, ok := skipped[m.Label]; ok {
+			continue
+		}
+		if _, ok := labels[string(m.Label)]; ok || m.Op != logql.OpEq {
+			delete(labels, string(m.Label))
+			skipped[m.Label] = struct{}{}
+			continue
+		}
+		labels[string(m.Label)] = m.Value
+	}
+	return labels
+}
+
 func (i *rangeAggIterator) clearWindow(windowStart time.Time) {
 	for key, s := range i.window {
 		// Filter series data in place: timestamp should be >= windowStart.
@@ -12,13 +12,17 @@ import (
 type SampleOp = func(left, right Sample) (Sample, bool)
 
 func buildSampleBinOp(expr *logql.BinOpExpr) (SampleOp, error) {
-	filter := expr.Modifier.ReturnBool
-	boolOp := func(v, filter bool) (float64, bool) {
+	// Comparison filters samples, unless bool modifier is set.
+	filter := !expr.Modifier.ReturnBool
+	boolOp := func(left float64, v, filter bool) (float64, bool) {
+		if filter {
+			// Keep the sample value, if comparison is true.
+			return left, v
+		}
 		if v {
 			return 1., true
 		}
-		// Do not keep the sample, if filter mode is enabled
-		return 0., !filter
+		return 0., true
 	}
 
 	switch expr.Op {
@@ -69,40 +73,49 @@ func buildSampleBinOp(expr *logql.BinOpExpr) (SampleOp, error) {
 	case logql.OpEq:
 		return func(left, right Sample) (result Sample, keep bool) {
 			result = left
-			result.Data, keep = boolOp(left.Data == right.Data, filter)
+			result.Data, keep = boolOp(left.Data, left.Data == right.Data, filter)
 			return
 		}, nil
 	case logql.OpNotEq:
 		return func(left, right Sample) (result Sample, keep bool) {
 			result = left
-			result.Data, keep = boolOp(left.Data != right.Data, filter)
+			result.Data, keep = boolOp(left.Data, left.Data != right.Data, filter)
 			return
 		}, nil
 	case logql.OpGt:
 		return func(left, right Sample) (result Sample, keep bool) {
 			result = left
-			result.Data, keep = boolOp(left.Data > right.Data, filter)
+			result.Data, keep = boolOp(left.Data, left.Data > right.Data, filter)
 			return
 		}, nil
 	case logql.OpGte:
 		return func(left, right Sample) (result Sample, keep bool) {
 			result = left
-			result.Data, keep = boolOp(left.Data >= right.Data, filter)
+			result.Data, keep = boolOp(left.Data, left.Data >= right.Data, filter)
 			return
 		}, nil
 	case logql.OpLt:
 		return func(left, right Sample) (result Sample, keep bool) {
 			result = left
-			result.Data, keep = boolOp(left.Data < right.Data, filter)
+			result.Data, keep = boolOp(left.Data, left.Data < right.Data, filter)
 			return
 		}, nil
 	case logql.OpLte:
 		return func(left, right Sample) (result Sample, keep bool) {
 			result = left
-			result.Data, keep = boolOp(left.Data <= right.Data, filter)
+			result.Data, keep = boolOp(left.Data, left.Data <= right.Data, filter)
 			return
 		}, nil
 	default:
 		return nil, errors.Errorf("unexpected operation %q", expr.Op)
 	}
 }
+
+func isComparisonOp(op logql.BinOp) bool {
+	switch op {
+	case logql.OpEq, logql.OpNotEq, logql.OpGt, logql.OpGte, logql.OpLt, logql.OpLte:
+		return true
+	default:
+		return false
+	}
+}
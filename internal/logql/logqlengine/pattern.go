@@ -28,7 +28,7 @@ func buildPatternExtractor(stage *logql.PatternLabelParser) (Processor, error) {
 // Process implements Processor.
 func (e *PatternExtractor) Process(_ otelstorage.Timestamp, line string, set LabelSet) (string, bool) {
 	logqlpattern.Match(e.pattern, line, func(l logql.Label, s string) {
-		set.Set(l, pcommon.NewValueStr(s))
+		set.setParsed(l, pcommon.NewValueStr(s))
 	})
 	return line, true
 }
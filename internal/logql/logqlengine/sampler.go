@@ -14,11 +14,12 @@ import (
 	"github.com/tdakkota/docker-logql/internal/otelstorage"
 )
 
-func (e *Engine) sampleSelector(ctx context.Context, params EvalParams) logqlmetric.SampleSelector {
-	return func(expr *logql.RangeAggregationExpr, start, end time.Time) (_ iterators.Iterator[logqlmetric.SampledEntry], rerr error) {
+func (e *Engine) sampleSelector(params EvalParams) logqlmetric.SampleSelector {
+	scans := &sharedScans{}
+	return func(ctx context.Context, expr *logql.RangeAggregationExpr, start, end time.Time) (_ iterators.Iterator[logqlmetric.SampledEntry], rerr error) {
 		qrange := expr.Range
 
-		iter, err := e.selectLogs(ctx, qrange.Sel, qrange.Pipeline, selectLogsParams{
+		iter, err := scans.selectLogs(ctx, e, qrange.Sel, qrange.Pipeline, selectLogsParams{
 			Start:   otelstorage.NewTimestampFromTime(start),
 			End:     otelstorage.NewTimestampFromTime(end),
 			Instant: params.IsInstant(),
@@ -41,6 +42,7 @@ func (e *Engine) sampleSelector(ctx context.Context, params EvalParams) logqlmet
 type sampleIterator struct {
 	iter    iterators.Iterator[entry]
 	sampler sampleExtractor
+	err     error
 
 	// grouping parameters.
 	by      map[string]struct{}
@@ -85,6 +87,17 @@ func (i *sampleIterator) Next(s *logqlmetric.SampledEntry) bool {
 			continue
 		}
 
+		if typ, ok := e.set.GetError(); ok {
+			// Metric query fails on unhandled pipeline errors, like Loki does.
+			details, _ := e.set.GetString(logql.ErrorDetailsLabel)
+			i.err = &PipelineError{
+				Type:    typ,
+				Details: details,
+				Series:  e.set.String(),
+			}
+			return false
+		}
+
 		s.Timestamp = e.ts
 		s.Sample = v
 		s.Set = newAggregatedLabels(e.set, i.by, i.without)
@@ -93,6 +106,9 @@ func (i *sampleIterator) Next(s *logqlmetric.SampledEntry) bool {
 }
 
 func (i *sampleIterator) Err() error {
+	if i.err != nil {
+		return i.err
+	}
 	return i.iter.Err()
 }
 
@@ -211,8 +227,11 @@ func (l *labelsExtractor) Extract(e entry) (p float64, _ bool) {
 		return p, false
 	}
 
-	p, _ = l.converter(v)
-	// TODO(tdakkota): save error
+	p, err := l.converter(v)
+	if err != nil {
+		// Keep the sample, query fails, if error is not filtered out.
+		e.set.SetError(SampleExtractionErr, err)
+	}
 
 	_, ok = l.postfilter.Process(e.ts, e.line, e.set)
 	return p, ok
@@ -271,3 +271,26 @@ func TestSampleExtractor(t *testing.T) {
 		})
 	}
 }
+
+func TestSampleExtractorError(t *testing.T) {
+	e, err := buildSampleExtractor(&logql.RangeAggregationExpr{
+		Op: logql.RangeOpSum,
+		Range: logql.LogRangeExpr{
+			Unwrap: &logql.UnwrapExpr{Label: "n", Op: "bytes"},
+		},
+	})
+	require.NoError(t, err)
+
+	set := newLabelSet()
+	set.Set("n", pcommon.NewValueStr("foobar"))
+
+	_, ok := e.Extract(entry{ts: 1, line: "foo", set: set})
+	require.True(t, ok)
+
+	typ, ok := set.GetError()
+	require.True(t, ok)
+	require.Equal(t, SampleExtractionErr, typ)
+	details, ok := set.GetString(logql.ErrorDetailsLabel)
+	require.True(t, ok)
+	require.NotEmpty(t, details)
+}
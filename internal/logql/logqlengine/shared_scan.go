@@ -0,0 +1,186 @@
+package logqlengine
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+)
+
+// sharedScans shares log scans between range aggregations of the same query.
+//
+// Range aggregations with the same selector, pipeline and time range,
+// e.g. both sides of "count_over_time({} [5m]) / count_over_time({} [5m])",
+// read entries of a single scan.
+type sharedScans struct {
+	mux   sync.Mutex
+	scans []*sharedScan
+}
+
+// selectLogs returns new iterator of selected entries.
+//
+// Scan is shared with other iterators using the same parameters, if reading is not started yet.
+func (s *sharedScans) selectLogs(
+	ctx context.Context,
+	e *Engine,
+	sel logql.Selector,
+	stages []logql.PipelineStage,
+	params selectLogsParams,
+) (iterators.Iterator[entry], error) {
+	scan, c := s.subscribe(sel, stages, params)
+
+	scan.openOnce.Do(func() {
+		scan.iter, scan.openErr = e.selectLogs(ctx, sel, stages, params)
+	})
+	if err := scan.openErr; err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *sharedScans) subscribe(sel logql.Selector, stages []logql.PipelineStage, params selectLogsParams) (*sharedScan, *scanConsumer) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, scan := range s.scans {
+		if !scan.matches(sel, stages, params) {
+			continue
+		}
+		if c, ok := scan.subscribe(); ok {
+			return scan, c
+		}
+	}
+
+	scan := &sharedScan{
+		sel:    sel,
+		stages: stages,
+		params: params,
+	}
+	s.scans = append(s.scans, scan)
+
+	c, _ := scan.subscribe()
+	return scan, c
+}
+
+// sharedScan is a scan of entries read by multiple consumers.
+type sharedScan struct {
+	sel    logql.Selector
+	stages []logql.PipelineStage
+	params selectLogsParams
+
+	openOnce sync.Once
+	iter     *entryIterator
+	openErr  error
+
+	mux       sync.Mutex
+	consumers []*scanConsumer
+	closed    int
+	// started is true, if reading is started, so scan cannot be shared anymore.
+	started bool
+	done    bool
+}
+
+func (s *sharedScan) matches(sel logql.Selector, stages []logql.PipelineStage, params selectLogsParams) bool {
+	return s.params == params &&
+		reflect.DeepEqual(s.sel, sel) &&
+		reflect.DeepEqual(s.stages, stages)
+}
+
+func (s *sharedScan) subscribe() (*scanConsumer, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.started {
+		return nil, false
+	}
+	c := &scanConsumer{scan: s}
+	s.consumers = append(s.consumers, c)
+	return c, true
+}
+
+// scanConsumer is an iterator of shared scan entries.
+//
+// Every consumer reads all entries of the scan. Entries read by one consumer
+// are buffered for other ones.
+type scanConsumer struct {
+	scan   *sharedScan
+	buf    []entry
+	closed bool
+}
+
+var _ iterators.Iterator[entry] = (*scanConsumer)(nil)
+
+// Next returns true, if there is element and fills t.
+func (c *scanConsumer) Next(e *entry) bool {
+	s := c.scan
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.started = true
+
+	if len(c.buf) > 0 {
+		*e = c.buf[0]
+		c.buf[0] = entry{}
+		c.buf = c.buf[1:]
+		return true
+	}
+	if s.done {
+		return false
+	}
+
+	if !s.iter.Next(e) {
+		s.done = true
+		return false
+	}
+	for _, other := range s.consumers {
+		if other == c || other.closed {
+			continue
+		}
+		other.buf = append(other.buf, entry{
+			ts:   e.ts,
+			line: e.line,
+			set:  e.set.clone(),
+		})
+	}
+	return true
+}
+
+// Err returns an error caused during iteration, if any.
+func (c *scanConsumer) Err() error {
+	s := c.scan
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.iter == nil {
+		return nil
+	}
+	return s.iter.Err()
+}
+
+// Close closes iterator.
+//
+// Scan is closed, when all consumers are closed.
+func (c *scanConsumer) Close() error {
+	s := c.scan
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.buf = nil
+
+	s.closed++
+	if s.closed < len(s.consumers) {
+		return nil
+	}
+	// Do not share closed scan.
+	s.started = true
+	if s.iter == nil {
+		return nil
+	}
+	return s.iter.Close()
+}
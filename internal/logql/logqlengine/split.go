@@ -0,0 +1,323 @@
+package logqlengine
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/multierr"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine/logqlmetric"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// rangeSplitter splits range aggregation into time shards evaluated in parallel.
+//
+// Every shard aggregates samples of its own time slice for every step which window
+// intersects the slice, results of shards are merged step by step.
+// So only aggregations which partial results could be merged are split.
+type rangeSplitter struct {
+	sel         logqlmetric.SampleSelector
+	interval    time.Duration
+	parallelism int
+}
+
+// mergeFunc merges partial results of range aggregation.
+type mergeFunc = func(a, b float64) float64
+
+func mergeSum(a, b float64) float64 {
+	return a + b
+}
+
+func mergeMin(a, b float64) float64 {
+	if b < a || math.IsNaN(b) {
+		return b
+	}
+	return a
+}
+
+func mergeMax(a, b float64) float64 {
+	if b > a || math.IsNaN(b) {
+		return b
+	}
+	return a
+}
+
+// Split implements [logqlmetric.RangeSplitter].
+func (s *rangeSplitter) Split(ctx context.Context, expr *logql.RangeAggregationExpr, start, end time.Time, step time.Duration) (logqlmetric.StepIterator, bool, error) {
+	if step <= 0 || end.Before(start) {
+		return nil, false, nil
+	}
+
+	partial := *expr
+	var merge mergeFunc
+	switch expr.Op {
+	case logql.RangeOpCount,
+		logql.RangeOpRate,
+		logql.RangeOpBytes,
+		logql.RangeOpBytesRate,
+		logql.RangeOpSum:
+		merge = mergeSum
+	case logql.RangeOpAvg:
+		// Average is a sum of samples divided by their count.
+		partial.Op = logql.RangeOpSum
+		merge = mergeSum
+	case logql.RangeOpMin:
+		merge = mergeMin
+	case logql.RangeOpMax:
+		merge = mergeMax
+	default:
+		return nil, false, nil
+	}
+
+	var (
+		steps = int(end.Sub(start)/step) + 1
+		// Number of steps owned by shard.
+		shardSteps = max(int((s.interval+step-1)/step), 1)
+		// Number of steps which window intersects slice of the previous shard.
+		overlap = int((expr.Range.Range + step - 1) / step)
+	)
+	if steps <= shardSteps {
+		return nil, false, nil
+	}
+
+	var shards []*rangeShard
+	for first := 0; first < steps; first += shardSteps {
+		last := min(first+shardSteps, steps) - 1
+		shard := &rangeShard{
+			first: first,
+			last:  min(last+overlap-1, steps-1),
+		}
+		if first == 0 {
+			shard.sliceStart = start.Add(-expr.Range.Range)
+		} else {
+			// Slice follows slice of the previous shard.
+			shard.sliceStart = start.Add(time.Duration(first-1)*step + 1)
+		}
+		shard.sliceEnd = start.Add(time.Duration(last) * step)
+		shards = append(shards, shard)
+	}
+
+	return &splitIterator{
+		ctx:         ctx,
+		splitter:    s,
+		expr:        &partial,
+		avg:         expr.Op == logql.RangeOpAvg,
+		merge:       merge,
+		shards:      shards,
+		start:       start,
+		step:        step,
+		steps:       steps,
+		parallelism: s.parallelism,
+	}, true, nil
+}
+
+// rangeShard is a part of split range aggregation.
+type rangeShard struct {
+	// first and last are indexes of steps to aggregate.
+	first, last int
+	// sliceStart and sliceEnd define time slice of samples to aggregate.
+	sliceStart, sliceEnd time.Time
+
+	steps []logqlmetric.Step
+	// counts are numbers of aggregated samples, if average is calculated.
+	counts []logqlmetric.Step
+}
+
+// splitIterator evaluates shards of range aggregation and merges their results.
+type splitIterator struct {
+	ctx      context.Context
+	splitter *rangeSplitter
+	// expr is a partial aggregation expression.
+	expr  *logql.RangeAggregationExpr
+	avg   bool
+	merge mergeFunc
+
+	shards      []*rangeShard
+	start       time.Time
+	step        time.Duration
+	steps       int
+	parallelism int
+
+	evaluated bool
+	current   int
+	err       error
+}
+
+var _ logqlmetric.StepIterator = (*splitIterator)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *splitIterator) Next(r *logqlmetric.Step) bool {
+	if !i.evaluated {
+		i.evaluated = true
+		if err := i.eval(); err != nil {
+			i.err = err
+			return false
+		}
+	}
+	if i.current >= i.steps {
+		return false
+	}
+	idx := i.current
+	i.current++
+
+	r.Timestamp = otelstorage.NewTimestampFromTime(i.stepTime(idx))
+	r.Samples = r.Samples[:0]
+
+	var (
+		merged = map[logqlmetric.GroupingKey]int{}
+		counts map[logqlmetric.GroupingKey]float64
+	)
+	if i.avg {
+		counts = map[logqlmetric.GroupingKey]float64{}
+	}
+	for _, shard := range i.shards {
+		if idx < shard.first || idx-shard.first >= len(shard.steps) {
+			continue
+		}
+
+		for _, s := range shard.steps[idx-shard.first].Samples {
+			key := s.Set.Key()
+			if j, ok := merged[key]; ok {
+				r.Samples[j].Data = i.merge(r.Samples[j].Data, s.Data)
+				continue
+			}
+			merged[key] = len(r.Samples)
+			r.Samples = append(r.Samples, s)
+		}
+		if i.avg {
+			for _, s := range shard.counts[idx-shard.first].Samples {
+				counts[s.Set.Key()] += s.Data
+			}
+		}
+	}
+	if i.avg {
+		for j, s := range r.Samples {
+			r.Samples[j].Data = s.Data / counts[s.Set.Key()]
+		}
+	}
+	return true
+}
+
+func (i *splitIterator) stepTime(idx int) time.Time {
+	return i.start.Add(time.Duration(idx) * i.step)
+}
+
+// eval evaluates shards in parallel.
+func (i *splitIterator) eval() error {
+	grp, ctx := errgroup.WithContext(i.ctx)
+	grp.SetLimit(i.parallelism)
+	for _, shard := range i.shards {
+		shard := shard
+		grp.Go(func() error {
+			if err := i.evalShard(ctx, shard); err != nil {
+				return errors.Wrapf(err, "evaluate shard [%s, %s]",
+					shard.sliceStart.Format(time.RFC3339Nano),
+					shard.sliceEnd.Format(time.RFC3339Nano),
+				)
+			}
+			return nil
+		})
+	}
+	return grp.Wait()
+}
+
+// evalShard evaluates partial aggregation of shard.
+func (i *splitIterator) evalShard(ctx context.Context, shard *rangeShard) (rerr error) {
+	var iters []logqlmetric.StepIterator
+	defer func() {
+		for _, iter := range iters {
+			rerr = multierr.Append(rerr, iter.Close())
+		}
+	}()
+
+	build := func(count bool) error {
+		samples, err := i.splitter.sel(ctx, i.expr, shard.sliceStart, shard.sliceEnd)
+		if err != nil {
+			return errors.Wrap(err, "get samples iterator")
+		}
+		if count {
+			samples = &countingSampleIterator{iter: samples}
+		}
+
+		iter, err := logqlmetric.RangeAggregation(samples, i.expr,
+			i.stepTime(shard.first),
+			i.stepTime(shard.last),
+			i.step,
+		)
+		if err != nil {
+			_ = samples.Close()
+			return err
+		}
+		iters = append(iters, iter)
+		return nil
+	}
+	if err := build(false); err != nil {
+		return err
+	}
+	if i.avg {
+		// Samples are selected using the same scan, so read both iterators step by step.
+		if err := build(true); err != nil {
+			return err
+		}
+	}
+
+	for {
+		results := make([]logqlmetric.Step, len(iters))
+		for idx, iter := range iters {
+			if !iter.Next(&results[idx]) {
+				for _, iter := range iters {
+					if err := iter.Err(); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+
+		shard.steps = append(shard.steps, results[0])
+		if i.avg {
+			shard.counts = append(shard.counts, results[1])
+		}
+	}
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *splitIterator) Err() error {
+	return i.err
+}
+
+// Close closes iterator.
+func (i *splitIterator) Close() error {
+	return nil
+}
+
+// countingSampleIterator replaces every sample value with one, so sum of samples is their count.
+type countingSampleIterator struct {
+	iter iterators.Iterator[logqlmetric.SampledEntry]
+}
+
+var _ iterators.Iterator[logqlmetric.SampledEntry] = (*countingSampleIterator)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *countingSampleIterator) Next(s *logqlmetric.SampledEntry) bool {
+	if !i.iter.Next(s) {
+		return false
+	}
+	s.Sample = 1
+	return true
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *countingSampleIterator) Err() error {
+	return i.iter.Err()
+}
+
+// Close closes iterator.
+func (i *countingSampleIterator) Close() error {
+	return i.iter.Close()
+}
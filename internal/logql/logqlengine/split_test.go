@@ -0,0 +1,167 @@
+package logqlengine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// rangeQuerier returns records of requested time range.
+type rangeQuerier struct {
+	records []logstorage.Record
+
+	mux sync.Mutex
+	// calls is a number of SelectLogs calls.
+	calls int
+}
+
+func (q *rangeQuerier) Capabilities() (caps QuerierCapabilities) {
+	return caps
+}
+
+func (q *rangeQuerier) SelectLogs(_ context.Context, start, end otelstorage.Timestamp, _ SelectLogsParams) (iterators.Iterator[logstorage.Record], error) {
+	q.mux.Lock()
+	q.calls++
+	q.mux.Unlock()
+
+	var records []logstorage.Record
+	for _, r := range q.records {
+		if r.Timestamp >= start && r.Timestamp <= end {
+			records = append(records, r)
+		}
+	}
+	return iterators.Slice(records), nil
+}
+
+func TestEngineEvalSplit(t *testing.T) {
+	var (
+		base    = time.Unix(1700000000, 0)
+		levels  = []string{"info", "warn", "error"}
+		records []logstorage.Record
+	)
+	for i := 0; i < 1000; i++ {
+		attrs := pcommon.NewMap()
+		attrs.PutStr("level", levels[i%len(levels)])
+		// Do not put records on window boundaries.
+		ts := base.Add(time.Duration(i)*7*time.Second + 500*time.Millisecond)
+		records = append(records, logstorage.Record{
+			Timestamp: otelstorage.NewTimestampFromTime(ts),
+			Body:      fmt.Sprintf(`{"n": %d, "pad": %q}`, i%10, levels[i%7%len(levels)]),
+			Attrs:     otelstorage.Attrs(attrs),
+		})
+	}
+
+	tests := []struct {
+		query string
+		split bool
+	}{
+		{`count_over_time({} [5m])`, true},
+		{`count_over_time({} [30s])`, true},
+		{`sum by (level) (rate({} [1m]))`, true},
+		{`bytes_over_time({} [10m])`, true},
+		{`bytes_rate({} [10m])`, true},
+		{`sum_over_time({} | json | unwrap n [5m])`, true},
+		{`min_over_time({} | json | unwrap n [3m]) by (level)`, true},
+		{`max_over_time({} | json | unwrap n [3m])`, true},
+		{`avg_over_time({} | json | unwrap n [7m]) by (level)`, true},
+		{`sum(count_over_time({} [5m] offset 10m))`, true},
+		{`count_over_time({} [5m]) / bytes_over_time({} [5m])`, true},
+		// Results of these aggregations cannot be merged.
+		{`quantile_over_time(0.5, {} | json | unwrap n [5m])`, false},
+		{`stddev_over_time({} | json | unwrap n [5m])`, false},
+		{`last_over_time({} | json | unwrap n [5m])`, false},
+		{`absent_over_time({level="debug"} [5m])`, false},
+	}
+	for i, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Test%d", i+1), func(t *testing.T) {
+			ctx := context.Background()
+			params := EvalParams{
+				Start: otelstorage.NewTimestampFromTime(base.Add(time.Hour)),
+				End:   otelstorage.NewTimestampFromTime(base.Add(2 * time.Hour)),
+				Step:  time.Minute,
+			}
+
+			eval := func(opts Options) (lokiapi.Matrix, int) {
+				q := &rangeQuerier{records: records}
+				data, err := NewEngine(q, opts).Eval(ctx, tt.query, params)
+				require.NoError(t, err)
+
+				matrix, ok := data.GetMatrixResult()
+				require.True(t, ok)
+				return matrix.Result, q.calls
+			}
+
+			want, wantCalls := eval(Options{})
+			got, gotCalls := eval(Options{SplitInterval: 10 * time.Minute})
+			if tt.split {
+				require.Greater(t, gotCalls, wantCalls)
+			} else {
+				require.Equal(t, wantCalls, gotCalls)
+			}
+			require.NotEmpty(t, want)
+
+			series := func(m lokiapi.Matrix) map[string]lokiapi.Series {
+				r := map[string]lokiapi.Series{}
+				for _, s := range m {
+					key := formatLabelSet(s.Metric.Value)
+					require.NotContains(t, r, key)
+					r[key] = s
+				}
+				return r
+			}
+			wantSeries, gotSeries := series(want), series(got)
+			require.Len(t, gotSeries, len(wantSeries))
+			for key, w := range wantSeries {
+				g, ok := gotSeries[key]
+				require.True(t, ok, "series %s not found", key)
+				require.Len(t, g.Values, len(w.Values), key)
+				for j, wp := range w.Values {
+					gp := g.Values[j]
+					require.Equal(t, wp.T, gp.T, key)
+
+					wv, err := strconv.ParseFloat(wp.V, 64)
+					require.NoError(t, err)
+					gv, err := strconv.ParseFloat(gp.V, 64)
+					require.NoError(t, err)
+					require.InDelta(t, wv, gv, 1e-9, "%s at %v", key, wp.T)
+				}
+			}
+		})
+	}
+}
+
+func TestEngineEvalSplitError(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	attrs := pcommon.NewMap()
+	attrs.PutStr("level", "info")
+	q := &rangeQuerier{
+		records: []logstorage.Record{
+			{
+				Timestamp: otelstorage.NewTimestampFromTime(base.Add(90 * time.Minute)),
+				Body:      "line",
+				Attrs:     otelstorage.Attrs(attrs),
+			},
+		},
+	}
+	e := NewEngine(q, Options{SplitInterval: 10 * time.Minute})
+
+	_, err := e.Eval(context.Background(), `sum_over_time({} | unwrap level [5m])`, EvalParams{
+		Start: otelstorage.NewTimestampFromTime(base.Add(time.Hour)),
+		End:   otelstorage.NewTimestampFromTime(base.Add(2 * time.Hour)),
+		Step:  time.Minute,
+	})
+	var pipelineErr *PipelineError
+	require.ErrorAs(t, err, &pipelineErr)
+}
@@ -39,11 +39,30 @@ type Querier interface {
 	// 	Capabilities should not change over time.
 	Capabilities() QuerierCapabilities
 	// SelectLogs selects log records from storage.
+	//
+	// Records should be sorted by timestamp, engine relies on it to stream results.
+	//
+	// Querier may skip unavailable data and report it using [AddWarning].
+	//
+	// SelectLogs may be called concurrently.
 	SelectLogs(ctx context.Context, start, end otelstorage.Timestamp, params SelectLogsParams) (iterators.Iterator[logstorage.Record], error)
 }
 
+// TailQuerier is a Querier that can follow new log records.
+type TailQuerier interface {
+	Querier
+	// TailLogs follows log records from storage, starting from given timestamp.
+	//
+	// Iterator blocks until new record arrives or context is canceled.
+	TailLogs(ctx context.Context, start otelstorage.Timestamp, params SelectLogsParams) (iterators.Iterator[logstorage.Record], error)
+}
+
 // SelectLogsParams is a storage query params.
 type SelectLogsParams struct {
 	Labels []logql.LabelMatcher
 	Line   []logql.LineFilter
+	// Tail is a hint to select only given number of the newest records, if positive.
+	//
+	// Querier may return more records, engine keeps the newest ones anyway.
+	Tail int
 }
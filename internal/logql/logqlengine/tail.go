@@ -0,0 +1,110 @@
+package logqlengine
+
+import (
+	"context"
+
+	"github.com/go-faster/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+// Entry is a log query result entry.
+type Entry struct {
+	Timestamp otelstorage.Timestamp
+	Line      string
+	Labels    lokiapi.LabelSet
+}
+
+// TailParams sets tail parameters.
+type TailParams struct {
+	// Start defines timestamp to follow records from.
+	//
+	// Querier follows only new records, if it is zero.
+	Start otelstorage.Timestamp
+}
+
+// Tail parses log query and follows new entries.
+//
+// Querier must implement [TailQuerier].
+func (e *Engine) Tail(ctx context.Context, query string, params TailParams) (_ iterators.Iterator[Entry], rerr error) {
+	ctx, span := e.tracer.Start(ctx, "Tail",
+		trace.WithAttributes(
+			attribute.String("logql.query", query),
+			attribute.Int64("logql.start", int64(params.Start)),
+		),
+	)
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	tq, ok := e.querier.(TailQuerier)
+	if !ok {
+		return nil, &UnsupportedError{Msg: "querier does not support tailing"}
+	}
+
+	expr, err := logql.Parse(query, e.parseOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse")
+	}
+
+	logExpr, ok := logql.UnparenExpr(expr).(*logql.LogExpr)
+	if !ok {
+		return nil, errors.Errorf("tail requires a log query, got %T", expr)
+	}
+
+	cond, pipeline, err := e.buildLogPipeline(logExpr.Sel, logExpr.Pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := tq.TailLogs(ctx, params.Start, cond.params)
+	if err != nil {
+		return nil, errors.Wrap(err, "tail logs")
+	}
+
+	return &resultIterator{
+		iter: &entryIterator{
+			iter:      iter,
+			prefilter: cond.prefilter,
+			pipeline:  pipeline,
+			limit:     -1,
+		},
+	}, nil
+}
+
+// resultIterator converts internal entries to Entry.
+type resultIterator struct {
+	iter iterators.Iterator[entry]
+	e    entry
+}
+
+var _ iterators.Iterator[Entry] = (*resultIterator)(nil)
+
+// Next returns true, if there is element and fills t.
+func (i *resultIterator) Next(r *Entry) bool {
+	if !i.iter.Next(&i.e) {
+		return false
+	}
+	r.Timestamp = i.e.ts
+	r.Line = i.e.line
+	r.Labels = i.e.set.AsLokiAPI()
+	return true
+}
+
+// Err returns an error caused during iteration, if any.
+func (i *resultIterator) Err() error {
+	return i.iter.Err()
+}
+
+// Close closes iterator.
+func (i *resultIterator) Close() error {
+	return i.iter.Close()
+}
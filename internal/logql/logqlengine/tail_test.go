@@ -0,0 +1,75 @@
+package logqlengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+type mockTailQuerier struct {
+	mockQuerier
+}
+
+func (m *mockTailQuerier) TailLogs(ctx context.Context, start otelstorage.Timestamp, params SelectLogsParams) (iterators.Iterator[logstorage.Record], error) {
+	return m.SelectLogs(ctx, start, 0, params)
+}
+
+func TestEngineTail(t *testing.T) {
+	ctx := context.Background()
+
+	q := &mockTailQuerier{
+		mockQuerier: mockQuerier{
+			lines: inputLines,
+		},
+	}
+	e := NewEngine(q, Options{})
+
+	iter, err := e.Tail(ctx, `{resource="test"} | json | id != 2`, TailParams{
+		Start: 1700000000_000000000,
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, iter.Close())
+	}()
+
+	var (
+		entry Entry
+		got   []resultLine
+	)
+	for iter.Next(&entry) {
+		require.NotZero(t, entry.Timestamp)
+		require.Equal(t, "test", entry.Labels["resource"])
+		got = append(got, resultLine{
+			line: entry.Line,
+			labels: map[string]string{
+				"id": entry.Labels["id"],
+			},
+		})
+	}
+	require.NoError(t, iter.Err())
+	require.Equal(t, []resultLine{
+		{resultLines[0].line, map[string]string{"id": "1"}},
+		{resultLines[2].line, map[string]string{"id": "3"}},
+	}, got)
+}
+
+func TestEngineTailErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Unsupported", func(t *testing.T) {
+		e := NewEngine(&mockQuerier{}, Options{})
+		_, err := e.Tail(ctx, `{}`, TailParams{})
+		var unsupported *UnsupportedError
+		require.ErrorAs(t, err, &unsupported)
+	})
+	t.Run("MetricQuery", func(t *testing.T) {
+		e := NewEngine(&mockTailQuerier{}, Options{})
+		_, err := e.Tail(ctx, `count_over_time({}[5m])`, TailParams{})
+		require.Error(t, err)
+	})
+}
@@ -20,7 +20,7 @@ func buildUnpackExtractor(*logql.UnpackLabelParser) (Processor, error) {
 func (e *UnpackExtractor) Process(_ otelstorage.Timestamp, line string, set LabelSet) (string, bool) {
 	newLine, err := parsePackEntry(line, set)
 	if err != nil {
-		set.SetError("unpack JSON parsing error", err)
+		set.SetError(JSONParserErr, err)
 		return line, true
 	}
 	return newLine, true
@@ -50,7 +50,7 @@ func parsePackEntry(oldLine string, set LabelSet) (string, error) {
 		if err := logql.IsValidLabel(key, set.allowDots()); err != nil {
 			return errors.Wrapf(err, "invalid label %q", key)
 		}
-		set.Set(logql.Label(key), pcommon.NewValueStr(parsed))
+		set.setParsed(logql.Label(key), pcommon.NewValueStr(parsed))
 
 		return nil
 	}); err != nil {
@@ -0,0 +1,63 @@
+package logqlengine
+
+import (
+	"context"
+	"sync"
+)
+
+// Warnings collects query warnings.
+//
+// Warning reports a non-fatal problem, e.g. a container that was skipped,
+// so the result may be incomplete.
+type Warnings struct {
+	// Handler is called for every new warning, if not nil.
+	//
+	// Calls are serialized.
+	Handler func(msg string)
+
+	mux  sync.Mutex
+	list []string
+	seen map[string]struct{}
+}
+
+// Add adds warning, if it is not added yet.
+func (w *Warnings) Add(msg string) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if _, ok := w.seen[msg]; ok {
+		return
+	}
+	if w.seen == nil {
+		w.seen = map[string]struct{}{}
+	}
+	w.seen[msg] = struct{}{}
+	w.list = append(w.list, msg)
+
+	if h := w.Handler; h != nil {
+		h(msg)
+	}
+}
+
+// List returns collected warnings in order of addition.
+func (w *Warnings) List() []string {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return append([]string(nil), w.list...)
+}
+
+type warningsKey struct{}
+
+// WithWarnings returns a new context that collects query warnings to w.
+func WithWarnings(ctx context.Context, w *Warnings) context.Context {
+	return context.WithValue(ctx, warningsKey{}, w)
+}
+
+// AddWarning adds warning to the collector of given context.
+//
+// Warning is dropped, if context has no collector.
+func AddWarning(ctx context.Context, msg string) {
+	if w, ok := ctx.Value(warningsKey{}).(*Warnings); ok && w != nil {
+		w.Add(msg)
+	}
+}
@@ -0,0 +1,30 @@
+package logqlengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarnings(t *testing.T) {
+	var (
+		handled  []string
+		warnings = Warnings{
+			Handler: func(msg string) {
+				handled = append(handled, msg)
+			},
+		}
+	)
+	ctx := WithWarnings(context.Background(), &warnings)
+
+	AddWarning(ctx, "first")
+	AddWarning(ctx, "second")
+	AddWarning(ctx, "first")
+	require.Equal(t, []string{"first", "second"}, warnings.List())
+	require.Equal(t, []string{"first", "second"}, handled)
+
+	// Warning is dropped, if there is no collector.
+	AddWarning(context.Background(), "third")
+	require.Equal(t, []string{"first", "second"}, warnings.List())
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
 	"github.com/tdakkota/docker-logql/internal/otelstorage"
 )
 
@@ -14,6 +15,8 @@ type Querier interface {
 	LabelNames(ctx context.Context, opts LabelsOptions) ([]string, error)
 	// LabelValues returns all available label values for given label.
 	LabelValues(ctx context.Context, labelName string, opts LabelsOptions) (iterators.Iterator[Label], error)
+	// Series returns all available log series.
+	Series(ctx context.Context, opts SeriesOptions) (Series, error)
 }
 
 // LabelsOptions defines options for Labels and LabelValues methods.
@@ -26,8 +29,31 @@ type LabelsOptions struct {
 	//
 	// Querier ignores parameter, if it is zero.
 	End otelstorage.Timestamp
+	// Query is a set of matchers to select streams.
+	//
+	// Querier ignores parameter, if it is empty.
+	Query logql.Selector
 }
 
+// SeriesOptions defines options for Series method.
+type SeriesOptions struct {
+	// Start defines time range for search.
+	//
+	// Querier ignores parameter, if it is zero.
+	Start otelstorage.Timestamp
+	// End defines time range for search.
+	//
+	// Querier ignores parameter, if it is zero.
+	End otelstorage.Timestamp
+	// Selectors defines a list of matchers to select series.
+	//
+	// Querier returns all series, if it is empty.
+	Selectors []logql.Selector
+}
+
+// Series is a list of series label sets.
+type Series []map[string]string
+
 // Inserter is a log storage insert interface.
 type Inserter interface {
 	// InsertRecords inserts given records.
@@ -0,0 +1,305 @@
+// Package lokihandler provides Loki API implementation.
+package lokihandler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-faster/errors"
+	ht "github.com/ogen-go/ogen/http"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine/logqlmetric"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+// LokiAPI implements lokiapi.Handler.
+type LokiAPI struct {
+	q         logstorage.Querier
+	engine    *logqlengine.Engine
+	parseOpts logql.ParseOptions
+}
+
+var _ lokiapi.Handler = (*LokiAPI)(nil)
+
+// NewLokiAPI creates new LokiAPI.
+func NewLokiAPI(q logstorage.Querier, engine *logqlengine.Engine, parseOpts logql.ParseOptions) *LokiAPI {
+	return &LokiAPI{
+		q:         q,
+		engine:    engine,
+		parseOpts: parseOpts,
+	}
+}
+
+// IndexStats implements indexStats operation.
+//
+// Get index stats.
+//
+// GET /loki/api/v1/index/stats
+func (h *LokiAPI) IndexStats(context.Context, lokiapi.IndexStatsParams) (*lokiapi.IndexStats, error) {
+	// No index stats for Docker logs.
+	return &lokiapi.IndexStats{}, nil
+}
+
+// LabelValues implements labelValues operation.
+//
+// Get values of label.
+//
+// GET /loki/api/v1/label/{name}/values
+func (h *LokiAPI) LabelValues(ctx context.Context, params lokiapi.LabelValuesParams) (*lokiapi.Values, error) {
+	start, end, err := ParseTimeRange(
+		time.Now(),
+		params.Start,
+		params.End,
+		params.Since,
+	)
+	if err != nil {
+		return nil, validationErr(err, "parse time range")
+	}
+
+	var sel logql.Selector
+	if q, ok := params.Query.Get(); ok && q != "" {
+		sel, err = logql.ParseSelector(q, h.parseOpts)
+		if err != nil {
+			return nil, validationErr(err, "parse query")
+		}
+	}
+
+	iter, err := h.q.LabelValues(ctx, params.Name, logstorage.LabelsOptions{
+		Start: pcommon.NewTimestampFromTime(start),
+		End:   pcommon.NewTimestampFromTime(end),
+		Query: sel,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get label values")
+	}
+	defer func() {
+		_ = iter.Close()
+	}()
+
+	values := []string{}
+	if err := iterators.ForEach(iter, func(tag logstorage.Label) error {
+		values = append(values, tag.Value)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "map tags")
+	}
+
+	return &lokiapi.Values{
+		Status: "success",
+		Data:   values,
+	}, nil
+}
+
+// Labels implements labels operation.
+//
+// Get labels.
+// Used by Grafana to test connection to Loki.
+//
+// GET /loki/api/v1/labels
+func (h *LokiAPI) Labels(ctx context.Context, params lokiapi.LabelsParams) (*lokiapi.Labels, error) {
+	start, end, err := ParseTimeRange(
+		time.Now(),
+		params.Start,
+		params.End,
+		params.Since,
+	)
+	if err != nil {
+		return nil, validationErr(err, "parse time range")
+	}
+
+	names, err := h.q.LabelNames(ctx, logstorage.LabelsOptions{
+		Start: pcommon.NewTimestampFromTime(start),
+		End:   pcommon.NewTimestampFromTime(end),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get label names")
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	return &lokiapi.Labels{
+		Status: "success",
+		Data:   names,
+	}, nil
+}
+
+// Push implements push operation.
+//
+// Push data.
+//
+// POST /loki/api/v1/push
+func (h *LokiAPI) Push(context.Context, lokiapi.PushReq) error {
+	// Docker logs are read-only.
+	return ht.ErrNotImplemented
+}
+
+// Query implements query operation.
+//
+// Query.
+//
+// GET /loki/api/v1/query
+func (h *LokiAPI) Query(ctx context.Context, params lokiapi.QueryParams) (*lokiapi.QueryResponse, error) {
+	ts, err := ParseTimestamp(params.Time.Or(""), time.Now())
+	if err != nil {
+		return nil, validationErr(err, "parse time")
+	}
+
+	return h.eval(ctx, params.Query, logqlengine.EvalParams{
+		Start:     pcommon.NewTimestampFromTime(ts),
+		End:       pcommon.NewTimestampFromTime(ts),
+		Step:      0,
+		Direction: string(params.Direction.Or(lokiapi.DirectionBackward)),
+		Limit:     params.Limit.Or(100),
+	})
+}
+
+// QueryRange implements queryRange operation.
+//
+// Query range.
+//
+// GET /loki/api/v1/query_range
+func (h *LokiAPI) QueryRange(ctx context.Context, params lokiapi.QueryRangeParams) (*lokiapi.QueryResponse, error) {
+	start, end, err := ParseTimeRange(
+		time.Now(),
+		params.Start,
+		params.End,
+		params.Since,
+	)
+	if err != nil {
+		return nil, validationErr(err, "parse time range")
+	}
+
+	step, err := ParseStep(params.Step, start, end)
+	if err != nil {
+		return nil, validationErr(err, "parse step")
+	}
+
+	return h.eval(ctx, params.Query, logqlengine.EvalParams{
+		Start:     pcommon.NewTimestampFromTime(start),
+		End:       pcommon.NewTimestampFromTime(end),
+		Step:      step,
+		Direction: string(params.Direction.Or(lokiapi.DirectionBackward)),
+		Limit:     params.Limit.Or(100),
+	})
+}
+
+func (h *LokiAPI) eval(ctx context.Context, query string, params logqlengine.EvalParams) (*lokiapi.QueryResponse, error) {
+	// Parse query to report syntax errors as bad request.
+	if _, err := logql.Parse(query, h.parseOpts); err != nil {
+		return nil, validationErr(err, "parse query")
+	}
+
+	data, err := h.engine.Eval(ctx, query, params)
+	if err != nil {
+		return nil, errors.Wrap(err, "eval")
+	}
+
+	return &lokiapi.QueryResponse{
+		Status: "success",
+		Data:   data,
+	}, nil
+}
+
+// Series implements series operation.
+//
+// Get series.
+//
+// GET /loki/api/v1/series
+func (h *LokiAPI) Series(ctx context.Context, params lokiapi.SeriesParams) (*lokiapi.Maps, error) {
+	start, end, err := ParseTimeRange(
+		time.Now(),
+		params.Start,
+		params.End,
+		params.Since,
+	)
+	if err != nil {
+		return nil, validationErr(err, "parse time range")
+	}
+
+	selectors := make([]logql.Selector, len(params.Match))
+	for i, m := range params.Match {
+		selectors[i], err = logql.ParseSelector(m, h.parseOpts)
+		if err != nil {
+			return nil, validationErr(err, fmt.Sprintf("parse match[%d]", i))
+		}
+	}
+
+	series, err := h.q.Series(ctx, logstorage.SeriesOptions{
+		Start:     pcommon.NewTimestampFromTime(start),
+		End:       pcommon.NewTimestampFromTime(end),
+		Selectors: selectors,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get series")
+	}
+
+	data := make([]lokiapi.MapsDataItem, len(series))
+	for i, set := range series {
+		data[i] = set
+	}
+
+	return &lokiapi.Maps{
+		Status: "success",
+		Data:   data,
+	}, nil
+}
+
+// NewError creates *ErrorStatusCode from error returned by handler.
+//
+// Used for common default response.
+func (h *LokiAPI) NewError(_ context.Context, err error) *lokiapi.ErrorStatusCode {
+	code := http.StatusInternalServerError
+
+	var (
+		validation  *validationError
+		unsupported *logqlengine.UnsupportedError
+		metricErr   *logqlmetric.UnsupportedError
+		pipelineErr *logqlengine.PipelineError
+		matchingErr *logqlmetric.MatchingError
+	)
+	switch {
+	case errors.As(err, &validation),
+		errors.As(err, &unsupported),
+		errors.As(err, &metricErr),
+		errors.As(err, &pipelineErr),
+		errors.As(err, &matchingErr):
+		code = http.StatusBadRequest
+	case errors.Is(err, ht.ErrNotImplemented):
+		code = http.StatusNotImplemented
+	case errors.Is(err, context.Canceled):
+		// Client closed the connection.
+		code = 499
+	}
+
+	return &lokiapi.ErrorStatusCode{
+		StatusCode: code,
+		Response:   lokiapi.Error(err.Error()),
+	}
+}
+
+// validationError reports invalid request parameters.
+type validationError struct {
+	err error
+}
+
+func validationErr(err error, msg string) error {
+	return &validationError{err: errors.Wrap(err, msg)}
+}
+
+// Error implements error.
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap implements errors.Unwrap.
+func (e *validationError) Unwrap() error {
+	return e.err
+}
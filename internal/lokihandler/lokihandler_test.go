@@ -0,0 +1,256 @@
+package lokihandler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/tdakkota/docker-logql/internal/iterators"
+	"github.com/tdakkota/docker-logql/internal/logql"
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+	"github.com/tdakkota/docker-logql/internal/logstorage"
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+	"github.com/tdakkota/docker-logql/internal/otelstorage"
+)
+
+type mockQuerier struct {
+	records []logstorage.Record
+	// warnings to report on every SelectLogs call.
+	warnings []string
+}
+
+func (m *mockQuerier) Capabilities() (caps logqlengine.QuerierCapabilities) {
+	return caps
+}
+
+func (m *mockQuerier) SelectLogs(ctx context.Context, start, end otelstorage.Timestamp, _ logqlengine.SelectLogsParams) (iterators.Iterator[logstorage.Record], error) {
+	for _, msg := range m.warnings {
+		logqlengine.AddWarning(ctx, msg)
+	}
+
+	var records []logstorage.Record
+	for _, r := range m.records {
+		if r.Timestamp < start || r.Timestamp > end {
+			continue
+		}
+		records = append(records, r)
+	}
+	return iterators.Slice(records), nil
+}
+
+func (m *mockQuerier) series(sel logql.Selector) (r []map[string]string) {
+	seen := map[string]struct{}{}
+	for _, rec := range m.records {
+		set := map[string]string{}
+		rec.ResourceAttrs.AsMap().Range(func(k string, v pcommon.Value) bool {
+			set[k] = v.AsString()
+			return true
+		})
+		matches := true
+		for _, m := range sel.Matchers {
+			if set[string(m.Label)] != m.Value {
+				matches = false
+			}
+		}
+		key := fmt.Sprint(set)
+		if _, ok := seen[key]; ok || !matches {
+			continue
+		}
+		seen[key] = struct{}{}
+		r = append(r, set)
+	}
+	return r
+}
+
+func (m *mockQuerier) LabelNames(_ context.Context, opts logstorage.LabelsOptions) (r []string, _ error) {
+	for _, set := range m.series(opts.Query) {
+		for k := range set {
+			if !slices.Contains(r, k) {
+				r = append(r, k)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (m *mockQuerier) LabelValues(_ context.Context, name string, opts logstorage.LabelsOptions) (iterators.Iterator[logstorage.Label], error) {
+	var r []logstorage.Label
+	for _, set := range m.series(opts.Query) {
+		if v, ok := set[name]; ok {
+			r = append(r, logstorage.Label{Name: name, Value: v})
+		}
+	}
+	return iterators.Slice(r), nil
+}
+
+func (m *mockQuerier) Series(_ context.Context, opts logstorage.SeriesOptions) (r logstorage.Series, _ error) {
+	for _, sel := range opts.Selectors {
+		r = append(r, m.series(sel)...)
+	}
+	return r, nil
+}
+
+func testLokiAPI() *LokiAPI {
+	var records []logstorage.Record
+	for i, line := range []string{"first", "second", "third"} {
+		res := pcommon.NewMap()
+		res.PutStr("container", "api")
+		res.PutStr("container_image", "api:latest")
+		records = append(records, logstorage.Record{
+			Timestamp:     otelstorage.Timestamp(1700000000_000000000 + int64(i)*int64(time.Second)),
+			Body:          line,
+			Attrs:         otelstorage.Attrs(pcommon.NewMap()),
+			ResourceAttrs: otelstorage.Attrs(res),
+		})
+	}
+
+	q := &mockQuerier{records: records}
+	eng := logqlengine.NewEngine(q, logqlengine.Options{})
+	return NewLokiAPI(q, eng, logql.ParseOptions{})
+}
+
+func TestLokiAPIQueryRange(t *testing.T) {
+	ctx := context.Background()
+	h := testLokiAPI()
+
+	t.Run("Logs", func(t *testing.T) {
+		resp, err := h.QueryRange(ctx, lokiapi.QueryRangeParams{
+			Query: `{container="api"} != "second"`,
+			Start: lokiapi.NewOptLokiTime("1700000000"),
+			End:   lokiapi.NewOptLokiTime("1700000010"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, "success", resp.Status)
+
+		streams, ok := resp.Data.GetStreamsResult()
+		require.True(t, ok)
+
+		var lines []string
+		for _, s := range streams.Result {
+			require.Equal(t, "api", s.Stream.Value["container"])
+			for _, e := range s.Values {
+				lines = append(lines, e.V)
+			}
+		}
+		slices.Sort(lines)
+		require.Equal(t, []string{"first", "third"}, lines)
+	})
+	t.Run("Metric", func(t *testing.T) {
+		resp, err := h.QueryRange(ctx, lokiapi.QueryRangeParams{
+			Query: `sum by (container) (count_over_time({container="api"}[10s]))`,
+			Start: lokiapi.NewOptLokiTime("1700000005"),
+			End:   lokiapi.NewOptLokiTime("1700000010"),
+			Step:  lokiapi.NewOptPrometheusDuration("5s"),
+		})
+		require.NoError(t, err)
+
+		matrix, ok := resp.Data.GetMatrixResult()
+		require.True(t, ok)
+		require.Len(t, matrix.Result, 1)
+		require.Equal(t, lokiapi.LabelSet{"container": "api"}, matrix.Result[0].Metric.Value)
+		require.Equal(t, []lokiapi.FPoint{
+			{T: 1700000005, V: "3"},
+			{T: 1700000010, V: "2"},
+		}, matrix.Result[0].Values)
+	})
+}
+
+func TestLokiAPIQuery(t *testing.T) {
+	ctx := context.Background()
+	h := testLokiAPI()
+
+	resp, err := h.Query(ctx, lokiapi.QueryParams{
+		Query: `sum by (container) (count_over_time({container="api"}[5s]))`,
+		Time:  lokiapi.NewOptLokiTime("1700000003"),
+	})
+	require.NoError(t, err)
+
+	vector, ok := resp.Data.GetVectorResult()
+	require.True(t, ok)
+	require.Len(t, vector.Result, 1)
+	require.Equal(t, lokiapi.FPoint{T: 1700000003, V: "3"}, vector.Result[0].Value)
+}
+
+func TestLokiAPILabels(t *testing.T) {
+	ctx := context.Background()
+	h := testLokiAPI()
+
+	labels, err := h.Labels(ctx, lokiapi.LabelsParams{})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"container", "container_image"}, labels.Data)
+
+	values, err := h.LabelValues(ctx, lokiapi.LabelValuesParams{
+		Name:  "container_image",
+		Query: lokiapi.NewOptString(`{container="api"}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"api:latest"}, values.Data)
+
+	values, err = h.LabelValues(ctx, lokiapi.LabelValuesParams{
+		Name:  "container_image",
+		Query: lokiapi.NewOptString(`{container="db"}`),
+	})
+	require.NoError(t, err)
+	require.Empty(t, values.Data)
+
+	series, err := h.Series(ctx, lokiapi.SeriesParams{
+		Match: []string{`{container="api"}`},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []lokiapi.MapsDataItem{
+		{"container": "api", "container_image": "api:latest"},
+	}, series.Data)
+
+	_, err = h.Series(ctx, lokiapi.SeriesParams{
+		Match: []string{`{container=}`},
+	})
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, h.NewError(ctx, err).StatusCode)
+}
+
+func TestLokiAPIErrors(t *testing.T) {
+	ctx := context.Background()
+	h := testLokiAPI()
+
+	for _, tt := range []struct {
+		params   lokiapi.QueryRangeParams
+		wantCode int
+	}{
+		{lokiapi.QueryRangeParams{Query: `{`}, http.StatusBadRequest},
+		{lokiapi.QueryRangeParams{Query: `{}`, Start: lokiapi.NewOptLokiTime("foo")}, http.StatusBadRequest},
+		{lokiapi.QueryRangeParams{Query: `{}`, Step: lokiapi.NewOptPrometheusDuration("foo")}, http.StatusBadRequest},
+		// Lines are not JSON, pipeline error is not handled.
+		{
+			lokiapi.QueryRangeParams{
+				Query: `count_over_time({container="api"} | json [10s])`,
+				Start: lokiapi.NewOptLokiTime("1700000005"),
+				End:   lokiapi.NewOptLokiTime("1700000010"),
+				Step:  lokiapi.NewOptPrometheusDuration("5s"),
+			},
+			http.StatusBadRequest,
+		},
+		// Every line is a separate series, so both sides have duplicate matches.
+		{
+			lokiapi.QueryRangeParams{
+				Query: `count_over_time({container="api"} [10s]) / on() count_over_time({container="api"} [10s])`,
+				Start: lokiapi.NewOptLokiTime("1700000005"),
+				End:   lokiapi.NewOptLokiTime("1700000010"),
+				Step:  lokiapi.NewOptPrometheusDuration("5s"),
+			},
+			http.StatusBadRequest,
+		},
+	} {
+		_, err := h.QueryRange(ctx, tt.params)
+		require.Error(t, err)
+		require.Equal(t, tt.wantCode, h.NewError(ctx, err).StatusCode)
+	}
+
+	err := h.Push(ctx, &lokiapi.Push{})
+	require.Equal(t, http.StatusNotImplemented, h.NewError(ctx, err).StatusCode)
+}
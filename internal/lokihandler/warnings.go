@@ -0,0 +1,78 @@
+package lokihandler
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/go-faster/jx"
+
+	"github.com/tdakkota/docker-logql/internal/logql/logqlengine"
+)
+
+// WithWarnings wraps Loki API server to add query warnings to responses.
+//
+// Generated Loki API has no "warnings" field of response, so the middleware
+// collects warnings reported while handling request and adds the field to
+// the successful JSON response, like Loki does.
+func WithWarnings(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var warnings logqlengine.Warnings
+		rw := &bufferedWriter{
+			ResponseWriter: w,
+			code:           http.StatusOK,
+		}
+		next.ServeHTTP(rw, r.WithContext(logqlengine.WithWarnings(r.Context(), &warnings)))
+
+		body := rw.buf.Bytes()
+		if list := warnings.List(); len(list) > 0 && rw.code == http.StatusOK {
+			body = appendWarnings(body, list)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(rw.code)
+		_, _ = w.Write(body)
+	})
+}
+
+// appendWarnings adds "warnings" field to given JSON object.
+//
+// Body is returned as is, if it is not a JSON object.
+func appendWarnings(body []byte, warnings []string) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		return body
+	}
+	fields := bytes.TrimSpace(trimmed[1 : len(trimmed)-1])
+
+	e := &jx.Encoder{}
+	e.RawStr("{")
+	if len(fields) > 0 {
+		e.Raw(fields)
+		e.RawStr(",")
+	}
+	e.RawStr(`"warnings":`)
+	e.ArrStart()
+	for _, msg := range warnings {
+		e.Str(msg)
+	}
+	e.ArrEnd()
+	e.RawStr("}")
+	return e.Bytes()
+}
+
+// bufferedWriter buffers response to add warnings collected after it is written.
+type bufferedWriter struct {
+	http.ResponseWriter
+	code int
+	buf  bytes.Buffer
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+// Write implements http.ResponseWriter.
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
@@ -0,0 +1,76 @@
+package lokihandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/docker-logql/internal/lokiapi"
+)
+
+func TestWithWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		warnings []string
+		wantCode int
+		wantJSON string
+	}{
+		{
+			"NoWarnings",
+			`/loki/api/v1/query_range?query={container="db"}&start=1700000000&end=1700000010`,
+			nil,
+			http.StatusOK,
+			`{"status":"success","data":{"result":[],"resultType":"streams"}}`,
+		},
+		{
+			"Warnings",
+			`/loki/api/v1/query_range?query={container="db"}&start=1700000000&end=1700000010`,
+			[]string{`container "db" is skipped`},
+			http.StatusOK,
+			`{"status":"success","data":{"result":[],"resultType":"streams"},"warnings":["container \"db\" is skipped"]}`,
+		},
+		{
+			"Error",
+			`/loki/api/v1/query_range?query={`,
+			[]string{`container "db" is skipped`},
+			http.StatusBadRequest,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := testLokiAPI()
+			h.q.(*mockQuerier).warnings = tt.warnings
+
+			api, err := lokiapi.NewServer(h)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			WithWarnings(api).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, http.NoBody))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantJSON != "" {
+				require.JSONEq(t, tt.wantJSON, w.Body.String())
+			} else {
+				require.NotContains(t, w.Body.String(), "warnings")
+			}
+		})
+	}
+}
+
+func TestAppendWarnings(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		want string
+	}{
+		{`{"status":"success"}`, `{"status":"success","warnings":["w"]}`},
+		{"{}\n", `{"warnings":["w"]}`},
+		{`"text"`, `"text"`},
+		{``, ``},
+	} {
+		require.Equal(t, tt.want, string(appendWarnings([]byte(tt.body), []string{"w"})), tt.body)
+	}
+}